@@ -0,0 +1,113 @@
+package audit
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/webcore-go/webcore/port"
+	"github.com/webcore-go/webcore/port/auth"
+)
+
+// AuditRow is one event in the audit table
+type AuditRow struct {
+	Time       string `db:"event_time" bson:"event_time" json:"event_time"` // RFC 3339
+	RequestID  string `db:"request_id" bson:"request_id" json:"request_id"`
+	Decision   string `db:"decision" bson:"decision" json:"decision"`
+	Reason     string `db:"reason" bson:"reason" json:"reason"`
+	Code       string `db:"code" bson:"code" json:"code"`
+	Status     int    `db:"status" bson:"status" json:"status"`
+	Principal  string `db:"principal" bson:"principal" json:"principal"`
+	Credential string `db:"credential" bson:"credential" json:"credential"`
+	Actor      string `db:"actor" bson:"actor" json:"actor"`
+	Scheme     string `db:"scheme" bson:"scheme" json:"scheme"`
+	Method     string `db:"method" bson:"method" json:"method"`
+	Path       string `db:"path" bson:"path" json:"path"`
+	Resource   string `db:"resource" bson:"resource" json:"resource"`
+	Action     string `db:"action" bson:"action" json:"action"`
+	IP         string `db:"ip" bson:"ip" json:"ip"`
+	LatencyUs  int64  `db:"latency_us" bson:"latency_us" json:"latency_us"`
+}
+
+// DatabaseSink inserts events into a table of the configured IDatabase
+type DatabaseSink struct {
+	Context  context.Context
+	Database port.IDatabase
+	Table    string
+	Timeout  time.Duration
+}
+
+func NewDatabaseSink(ctx context.Context, database port.IDatabase, table string) (*DatabaseSink, error) {
+	if table == "" {
+		return nil, fmt.Errorf("auth.audit.table is empty")
+	}
+
+	// document databases create the collection on first insert
+	if executor, ok := database.GetConnection().(interface {
+		ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	}); ok {
+		if _, err := executor.ExecContext(ctx, Schema(table)); err != nil {
+			return nil, fmt.Errorf("Create audit table: %v", err)
+		}
+	}
+
+	return &DatabaseSink{
+		Context:  ctx,
+		Database: database,
+		Table:    table,
+		Timeout:  5 * time.Second,
+	}, nil
+}
+
+// Schema returns the CREATE TABLE statement of the audit table. The column
+// types are accepted by PostgreSQL, MySQL and SQLite.
+func Schema(table string) string {
+	return fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+	event_time VARCHAR(64) NOT NULL,
+	request_id VARCHAR(255) NOT NULL,
+	decision VARCHAR(16) NOT NULL,
+	reason TEXT NOT NULL,
+	code VARCHAR(64) NOT NULL,
+	status INTEGER NOT NULL,
+	principal VARCHAR(255) NOT NULL,
+	credential VARCHAR(255) NOT NULL,
+	actor VARCHAR(255) NOT NULL DEFAULT '',
+	scheme VARCHAR(64) NOT NULL,
+	method VARCHAR(16) NOT NULL,
+	path VARCHAR(1024) NOT NULL,
+	resource VARCHAR(1024) NOT NULL,
+	action VARCHAR(255) NOT NULL,
+	ip VARCHAR(64) NOT NULL,
+	latency_us BIGINT NOT NULL
+)`, table)
+}
+
+func (d *DatabaseSink) Name() string {
+	return SinkDB
+}
+
+func (d *DatabaseSink) Write(event *auth.AuditEvent) error {
+	ctx, cancel := context.WithTimeout(d.Context, d.Timeout)
+	defer cancel()
+
+	_, err := d.Database.InsertOne(ctx, d.Table, AuditRow{
+		Time:       event.Time.UTC().Format(time.RFC3339Nano),
+		RequestID:  event.RequestID,
+		Decision:   event.Decision,
+		Reason:     event.Reason,
+		Code:       event.Code,
+		Status:     event.Status,
+		Principal:  event.Principal,
+		Credential: event.Credential,
+		Actor:      event.Actor,
+		Scheme:     event.Scheme,
+		Method:     event.Method,
+		Path:       event.Path,
+		Resource:   event.Resource,
+		Action:     event.Action,
+		IP:         event.IP,
+		LatencyUs:  event.Latency.Microseconds(),
+	})
+	return err
+}
@@ -0,0 +1,27 @@
+package audit
+
+import (
+	"github.com/webcore-go/webcore/app/core"
+	"github.com/webcore-go/webcore/port/auth"
+)
+
+// EventSink publishes every event as auth.EventAuthDecision on the EventBus,
+// so modules can forward them, e.g. to Kafka or PubSub
+type EventSink struct {
+	Bus *core.EventBus
+}
+
+func NewEventSink(bus *core.EventBus) *EventSink {
+	return &EventSink{
+		Bus: bus,
+	}
+}
+
+func (e *EventSink) Name() string {
+	return SinkEvent
+}
+
+func (e *EventSink) Write(event *auth.AuditEvent) error {
+	e.Bus.Publish(auth.EventAuthDecision, *event)
+	return nil
+}
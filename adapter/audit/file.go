@@ -0,0 +1,70 @@
+package audit
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"sync"
+
+	"github.com/webcore-go/webcore/app/helper"
+	"github.com/webcore-go/webcore/port/auth"
+)
+
+// FileSink appends one JSON object per line. The file is only readable by
+// the owner, because it shows who accessed what.
+type FileSink struct {
+	Path string
+
+	file   *os.File
+	writer *bufio.Writer
+	mu     sync.Mutex
+}
+
+func NewFileSink(path string) (*FileSink, error) {
+	if path == "" {
+		return nil, fmt.Errorf("auth.audit.file is empty")
+	}
+
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("Open audit file: %v", err)
+	}
+
+	return &FileSink{
+		Path:   path,
+		file:   file,
+		writer: bufio.NewWriter(file),
+	}, nil
+}
+
+func (f *FileSink) Name() string {
+	return SinkFile
+}
+
+func (f *FileSink) Write(event *auth.AuditEvent) error {
+	line, err := helper.JSONMarshal(event)
+	if err != nil {
+		return err
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if _, err := f.writer.Write(append(line, '\n')); err != nil {
+		return err
+	}
+
+	// flushed per event, a crash loses only the events still queued in the Auditor
+	return f.writer.Flush()
+}
+
+func (f *FileSink) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if err := f.writer.Flush(); err != nil {
+		f.file.Close()
+		return err
+	}
+	return f.file.Close()
+}
@@ -0,0 +1,83 @@
+package audit
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/webcore-go/webcore/app/core"
+	"github.com/webcore-go/webcore/infra/config"
+	"github.com/webcore-go/webcore/port"
+	"github.com/webcore-go/webcore/port/auth"
+)
+
+// Names of auth.audit.sinks
+const (
+	SinkFile  = "file"
+	SinkDB    = "db"
+	SinkEvent = "event"
+)
+
+type AuditLoader struct {
+	name string
+}
+
+func (a *AuditLoader) SetName(name string) {
+	a.name = name
+}
+
+func (a *AuditLoader) Name() string {
+	return a.name
+}
+
+func (l *AuditLoader) Init(args ...any) (port.Library, error) {
+	context := args[0].(*core.AppContext)
+	config := args[1].(config.AuthConfig)
+
+	sinks := make([]auth.IAuditSink, 0, len(config.Audit.Sinks))
+	for _, name := range config.Audit.Sinks {
+		sink, err := newSink(context, config.Audit, name)
+		if err != nil {
+			for _, opened := range sinks {
+				if closer, ok := opened.(io.Closer); ok {
+					closer.Close()
+				}
+			}
+			return nil, err
+		}
+		sinks = append(sinks, sink)
+	}
+
+	if config.Audit.SampleRate < 0 || config.Audit.SampleRate > 1 {
+		return nil, fmt.Errorf("auth.audit.sample_rate must be between 0 and 1, got %v", config.Audit.SampleRate)
+	}
+
+	auditor := auth.NewAuditor(sinks, config.Audit.SampleRate, config.Audit.Buffer)
+	if err := auditor.Install(args...); err != nil {
+		return nil, err
+	}
+
+	return auditor, nil
+}
+
+func newSink(context *core.AppContext, config config.AuditConfig, name string) (auth.IAuditSink, error) {
+	switch name {
+	case SinkFile:
+		return NewFileSink(config.File)
+	case SinkDB:
+		library, ok := context.GetDefaultSingletonInstance("database")
+		if !ok {
+			return nil, fmt.Errorf("Audit sink db requires a configured database")
+		}
+
+		database, ok := library.(port.IDatabase)
+		if !ok {
+			return nil, fmt.Errorf("Library %s does not implement IDatabase", library)
+		}
+
+		return NewDatabaseSink(context.Context, database, config.Table)
+	case SinkEvent:
+		return NewEventSink(context.EventBus), nil
+	default:
+		return nil, fmt.Errorf("Unknown audit sink %s, use file, db or event", name)
+	}
+}
@@ -0,0 +1,165 @@
+package apikey
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/webcore-go/webcore/app/helper"
+	"github.com/webcore-go/webcore/port/auth"
+)
+
+// fileKey is the stored form of a key, including the hash that APIKey hides from JSON
+type fileKey struct {
+	auth.APIKey
+	Hash string `json:"hash"`
+}
+
+// FileKeyStore keeps API keys in a JSON file. It is used when the auth store
+// (e.g. access.yaml) has no key table.
+type FileKeyStore struct {
+	Path string
+
+	mu   sync.RWMutex
+	keys map[string]*auth.APIKey
+}
+
+func NewFileKeyStore(path string) (*FileKeyStore, error) {
+	s := &FileKeyStore{
+		Path: path,
+		keys: make(map[string]*auth.APIKey),
+	}
+
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Read API key file %s: %v", path, err)
+	}
+
+	var list []fileKey
+	if len(data) > 0 {
+		if err := helper.JSONUnmarshal(data, &list); err != nil {
+			return nil, fmt.Errorf("Parse API key file %s: %v", path, err)
+		}
+	}
+
+	for i := range list {
+		key := list[i].APIKey
+		key.Hash = list[i].Hash
+		s.keys[key.Id] = &key
+	}
+
+	return s, nil
+}
+
+func (s *FileKeyStore) CreateAPIKey(ctx context.Context, key *auth.APIKey) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.keys[key.Id]; ok {
+		return fmt.Errorf("API key %s already exists", key.Id)
+	}
+
+	copied := *key
+	s.keys[key.Id] = &copied
+	return s.save()
+}
+
+func (s *FileKeyStore) GetAPIKey(ctx context.Context, id string) (*auth.APIKey, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	key, ok := s.keys[id]
+	if !ok {
+		return nil, fmt.Errorf("API key %s not found", id)
+	}
+
+	copied := *key
+	return &copied, nil
+}
+
+func (s *FileKeyStore) ListAPIKeys(ctx context.Context, userId string) ([]*auth.APIKey, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	list := make([]*auth.APIKey, 0, len(s.keys))
+	for _, key := range s.keys {
+		if userId == "" || key.UserId == userId {
+			copied := *key
+			list = append(list, &copied)
+		}
+	}
+
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].CreatedAt.Before(list[j].CreatedAt)
+	})
+	return list, nil
+}
+
+func (s *FileKeyStore) UpdateAPIKey(ctx context.Context, key *auth.APIKey) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.keys[key.Id]; !ok {
+		return fmt.Errorf("API key %s not found", key.Id)
+	}
+
+	copied := *key
+	s.keys[key.Id] = &copied
+	return s.save()
+}
+
+func (s *FileKeyStore) TouchAPIKey(ctx context.Context, id string, at time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key, ok := s.keys[id]
+	if !ok {
+		return fmt.Errorf("API key %s not found", id)
+	}
+
+	key.LastUsedAt = &at
+	return s.save()
+}
+
+// save writes all keys to a temporary file and renames it, so a crash never leaves a partial file
+func (s *FileKeyStore) save() error {
+	list := make([]fileKey, 0, len(s.keys))
+	for _, key := range s.keys {
+		list = append(list, fileKey{APIKey: *key, Hash: key.Hash})
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].CreatedAt.Before(list[j].CreatedAt)
+	})
+
+	data, err := helper.JSONMarshalIndent(list, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(s.Path), filepath.Base(s.Path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Chmod(0600); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), s.Path)
+}
@@ -0,0 +1,111 @@
+package apikey
+
+import (
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/webcore-go/webcore/app/core"
+	"github.com/webcore-go/webcore/app/out"
+	"github.com/webcore-go/webcore/infra/config"
+	"github.com/webcore-go/webcore/infra/logger"
+	"github.com/webcore-go/webcore/port/auth"
+)
+
+type CreateKeyRequest struct {
+	UserId    string   `json:"user_id"`
+	Name      string   `json:"name"`
+	Scopes    []string `json:"scopes"`
+	ExpiresIn string   `json:"expires_in"` // duration, e.g. "720h"; empty uses auth.api_keys.default_ttl
+}
+
+type KeyResponse struct {
+	Key    string       `json:"key"` // plain key, only returned once
+	APIKey *auth.APIKey `json:"api_key"`
+}
+
+// KeyHandler serves the key management endpoints
+type KeyHandler struct {
+	Keys *KeyManager
+}
+
+func NewKeyHandler(keys *KeyManager) *KeyHandler {
+	return &KeyHandler{
+		Keys: keys,
+	}
+}
+
+// Register mounts the endpoints below the protected prefix, limited to the admin roles
+func (h *KeyHandler) Register(root fiber.Router, config config.APIKeysConfig) {
+	if config.AdminPath == "" {
+		return
+	}
+
+	// without admin roles the routes would be open to every authenticated user
+	if len(config.AdminRoles) == 0 {
+		logger.Error("auth.api_keys.admin_roles is empty, the key management endpoints are not registered")
+		return
+	}
+
+	// keys are credentials, an impersonating admin must not create them for the user
+	security := &auth.RouteSecurity{Roles: config.AdminRoles, NoImpersonation: true}
+	for _, route := range []*core.ModuleRoute{
+		{Method: fiber.MethodPost, Path: config.AdminPath, Handler: h.Create},
+		{Method: fiber.MethodGet, Path: config.AdminPath, Handler: h.List},
+		{Method: fiber.MethodDelete, Path: config.AdminPath + "/:id", Handler: h.Revoke},
+		{Method: fiber.MethodPost, Path: config.AdminPath + "/:id/rotate", Handler: h.Rotate},
+	} {
+		route.Root = root
+		route.Security = security
+		core.AppendRouteToArray(nil, route)
+	}
+}
+
+func (h *KeyHandler) Create(c *fiber.Ctx) error {
+	var req CreateKeyRequest
+	if err := c.BodyParser(&req); err != nil || req.UserId == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(out.Error(fiber.StatusBadRequest, 1, "BAD_REQUEST", "user_id is required"))
+	}
+
+	var ttl time.Duration
+	if req.ExpiresIn != "" {
+		var err error
+		ttl, err = time.ParseDuration(req.ExpiresIn)
+		if err != nil || ttl < 0 {
+			return c.Status(fiber.StatusBadRequest).JSON(out.Error(fiber.StatusBadRequest, 1, "BAD_REQUEST", "expires_in must be a positive duration"))
+		}
+	}
+
+	raw, key, err := h.Keys.Issue(c.UserContext(), req.UserId, req.Name, req.Scopes, ttl)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(out.ErrorDetail(fiber.StatusInternalServerError, 1, "UNKNOWN", "Failed to create API key", err))
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(out.SuccessData(KeyResponse{Key: raw, APIKey: key}))
+}
+
+func (h *KeyHandler) List(c *fiber.Ctx) error {
+	keys, err := h.Keys.Store.ListAPIKeys(c.UserContext(), c.Query("user_id"))
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(out.ErrorDetail(fiber.StatusInternalServerError, 1, "UNKNOWN", "Failed to list API keys", err))
+	}
+
+	return c.JSON(out.SuccessData(keys))
+}
+
+func (h *KeyHandler) Revoke(c *fiber.Ctx) error {
+	key, err := h.Keys.Revoke(c.UserContext(), c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(out.Error(fiber.StatusNotFound, 1, "NOT_FOUND", err.Error()))
+	}
+
+	return c.JSON(out.SuccessData(key))
+}
+
+func (h *KeyHandler) Rotate(c *fiber.Ctx) error {
+	raw, key, err := h.Keys.Rotate(c.UserContext(), c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(out.Error(fiber.StatusNotFound, 1, "NOT_FOUND", err.Error()))
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(out.SuccessData(KeyResponse{Key: raw, APIKey: key}))
+}
@@ -0,0 +1,199 @@
+package apikey
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/webcore-go/webcore/infra/config"
+	"github.com/webcore-go/webcore/infra/logger"
+	"github.com/webcore-go/webcore/port/auth"
+)
+
+// last used time is written at most once per interval and key
+const lastUsedInterval = time.Minute
+
+// KeyManager issues, verifies, rotates and revokes managed API keys. A key
+// looks like "<prefix>_<id>_<secret>"; the id is used for the lookup and only
+// the SHA-256 hash of the secret is stored.
+type KeyManager struct {
+	Store       auth.IAPIKeyStore
+	Prefix      string
+	DefaultTTL  time.Duration
+	GracePeriod time.Duration
+}
+
+func NewKeyManager(store auth.IAPIKeyStore, config config.APIKeysConfig) (*KeyManager, error) {
+	if config.Prefix == "" || strings.Contains(config.Prefix, "_") {
+		return nil, fmt.Errorf("API key prefix %q must be set and must not contain '_'", config.Prefix)
+	}
+
+	return &KeyManager{
+		Store:       store,
+		Prefix:      config.Prefix,
+		DefaultTTL:  config.DefaultTTL,
+		GracePeriod: config.GracePeriod,
+	}, nil
+}
+
+// IsManagedKey reports whether the raw key has the format of an issued key
+func (m *KeyManager) IsManagedKey(raw string) bool {
+	parts := strings.SplitN(raw, "_", 3)
+	return len(parts) == 3 && parts[0] == m.Prefix && parts[1] != "" && parts[2] != ""
+}
+
+// Issue creates a key for the user and returns the plain key, which is not stored
+func (m *KeyManager) Issue(ctx context.Context, userId string, name string, scopes []string, ttl time.Duration) (string, *auth.APIKey, error) {
+	if userId == "" {
+		return "", nil, fmt.Errorf("user_id is required")
+	}
+
+	idBytes := make([]byte, 6)
+	secretBytes := make([]byte, 32)
+	if _, err := rand.Read(idBytes); err != nil {
+		return "", nil, err
+	}
+	if _, err := rand.Read(secretBytes); err != nil {
+		return "", nil, err
+	}
+
+	id := hex.EncodeToString(idBytes)
+	secret := base64.RawURLEncoding.EncodeToString(secretBytes)
+
+	if ttl == 0 {
+		ttl = m.DefaultTTL
+	}
+
+	now := time.Now().UTC()
+	key := &auth.APIKey{
+		Id:        id,
+		Prefix:    m.Prefix + "_" + id,
+		Hash:      hashSecret(secret),
+		UserId:    userId,
+		Name:      name,
+		Scopes:    scopes,
+		CreatedAt: now,
+	}
+	if ttl > 0 {
+		expiresAt := now.Add(ttl)
+		key.ExpiresAt = &expiresAt
+	}
+
+	if err := m.Store.CreateAPIKey(ctx, key); err != nil {
+		return "", nil, err
+	}
+
+	return key.Prefix + "_" + secret, key, nil
+}
+
+// Verify checks a raw key, records its use and returns its record
+func (m *KeyManager) Verify(ctx context.Context, raw string) (*auth.APIKey, error) {
+	key, err := m.Check(ctx, raw)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now().UTC()
+	if key.LastUsedAt == nil || now.Sub(*key.LastUsedAt) > lastUsedInterval {
+		key.LastUsedAt = &now
+		if err := m.Store.TouchAPIKey(ctx, key.Id, now); err != nil {
+			logger.Warn("Update API key last used failed", "id", key.Id, "error", err)
+		}
+	}
+
+	return key, nil
+}
+
+// Check checks a raw key like Verify without recording its use, e.g. for dry runs
+func (m *KeyManager) Check(ctx context.Context, raw string) (*auth.APIKey, error) {
+	parts := strings.SplitN(raw, "_", 3)
+	if len(parts) != 3 || parts[0] != m.Prefix {
+		return nil, auth.ErrCredentialsMalformed.Withf("API key has no %s prefix", m.Prefix)
+	}
+
+	key, err := m.Store.GetAPIKey(ctx, parts[1])
+	if err != nil || key == nil {
+		return nil, auth.ErrCredentialsInvalid.Withf("API key %s not found", parts[1])
+	}
+
+	if subtle.ConstantTimeCompare([]byte(hashSecret(parts[2])), []byte(key.Hash)) != 1 {
+		return nil, auth.ErrCredentialsInvalid.Withf("API key %s secret does not match", key.Id)
+	}
+
+	now := time.Now().UTC()
+	switch {
+	case key.RevokedAt != nil:
+		return nil, auth.ErrCredentialsRevoked.Withf("API key %s is revoked", key.Id)
+	case key.ExpiresAt != nil && now.After(*key.ExpiresAt):
+		return nil, auth.ErrCredentialsExpired.Withf("API key %s is expired", key.Id)
+	case key.GraceUntil != nil && now.After(*key.GraceUntil):
+		return nil, auth.ErrCredentialsExpired.Withf("API key %s was rotated to %s", key.Id, key.ReplacedBy)
+	}
+
+	return key, nil
+}
+
+// Revoke disables a key immediately
+func (m *KeyManager) Revoke(ctx context.Context, id string) (*auth.APIKey, error) {
+	key, err := m.Store.GetAPIKey(ctx, id)
+	if err != nil || key == nil {
+		return nil, fmt.Errorf("API key %s not found", id)
+	}
+
+	if key.RevokedAt == nil {
+		now := time.Now().UTC()
+		key.RevokedAt = &now
+		if err := m.Store.UpdateAPIKey(ctx, key); err != nil {
+			return nil, err
+		}
+	}
+
+	return key, nil
+}
+
+// Rotate issues a new key with the same owner, name, scopes and lifetime. The
+// old key keeps working for the grace period.
+func (m *KeyManager) Rotate(ctx context.Context, id string) (string, *auth.APIKey, error) {
+	old, err := m.Store.GetAPIKey(ctx, id)
+	if err != nil || old == nil {
+		return "", nil, fmt.Errorf("API key %s not found", id)
+	}
+
+	now := time.Now().UTC()
+	if !old.IsActive(now) {
+		return "", nil, fmt.Errorf("API key %s is not active", id)
+	}
+	if old.ReplacedBy != "" {
+		return "", nil, fmt.Errorf("API key %s was already rotated to %s", id, old.ReplacedBy)
+	}
+
+	var ttl time.Duration
+	if old.ExpiresAt != nil {
+		ttl = old.ExpiresAt.Sub(old.CreatedAt)
+	}
+
+	raw, key, err := m.Issue(ctx, old.UserId, old.Name, old.Scopes, ttl)
+	if err != nil {
+		return "", nil, err
+	}
+
+	graceUntil := now.Add(m.GracePeriod)
+	old.ReplacedBy = key.Id
+	old.GraceUntil = &graceUntil
+	if err := m.Store.UpdateAPIKey(ctx, old); err != nil {
+		return "", nil, err
+	}
+
+	return raw, key, nil
+}
+
+func hashSecret(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
@@ -7,6 +7,7 @@ import (
 	"github.com/gofiber/fiber/v2"
 	"github.com/webcore-go/webcore/adapter/auth/authn"
 	"github.com/webcore-go/webcore/infra/config"
+	"github.com/webcore-go/webcore/infra/logger"
 	"github.com/webcore-go/webcore/port"
 	"github.com/webcore-go/webcore/port/auth"
 )
@@ -25,56 +26,155 @@ func (a *ApiKeyLoader) Name() string {
 
 func (a *ApiKeyLoader) Init(args ...any) (port.Library, error) {
 	config := args[1].(config.AuthConfig)
+	validator := NewApiKeyValidator(config)
+	if validator.AllowPlain {
+		logger.Warn("auth.api_keys.allow_plain is enabled, the user key of a store user authenticates as API key")
+	}
+
 	authn := &authn.AuthN{}
-	authn.SetValidator(NewApiKeyValidator(config))
+	authn.SetValidator(validator)
 	err := authn.Install(args...)
 	if err != nil {
 		return nil, err
 	}
 
+	// managed keys live in the auth store when it has a key table, otherwise in a JSON file
+	keyStore, ok := authn.Store.(auth.IAPIKeyStore)
+	if !ok && config.APIKeys.File != "" {
+		keyStore, err = NewFileKeyStore(config.APIKeys.File)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if keyStore != nil {
+		validator.Keys, err = NewKeyManager(keyStore, config.APIKeys)
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	return authn, nil
 }
 
+// key in fiber.Ctx locals where the managed key of the current request is stored
+const keyLocal = "api_key_record"
+
 type ApiKeyValidator struct {
-	Header string
-	Prefix string
-	Key    string
+	Header     string
+	Prefix     string
+	Realm      string
+	AllowPlain bool
+	Keys       *KeyManager
+	Config     config.APIKeysConfig
 }
 
 func (a *ApiKeyValidator) Name() string {
 	return "apikey"
 }
 
-func (a *ApiKeyValidator) ValidateKey(ctx *fiber.Ctx) error {
+func (a *ApiKeyValidator) ValidateKey(ctx *fiber.Ctx) (string, error) {
 	apiKey := ctx.Get(a.Header)
 	if apiKey == "" {
 		// Coba dapatkan dari Authorization
 		authHeader := ctx.Get("Authorization")
 		if authHeader == "" {
-			return fmt.Errorf("Authorization header required")
+			return "", auth.ErrCredentialsMissing.Withf("Authorization header required")
 		}
 
 		// konten dimulai dengan prefiks "APIKey "
 		if strings.HasPrefix(authHeader, "APIKey ") {
 			apiKey = strings.TrimPrefix(authHeader, "APIKey ")
 		} else {
-			return fmt.Errorf("Required prefix in Authorization header is missing")
+			return "", auth.ErrCredentialsMalformed.Withf("Required prefix in Authorization header is missing")
 		}
 	}
 
 	if a.Prefix != "" {
 		if !strings.HasPrefix(apiKey, a.Prefix) {
-			return fmt.Errorf("Required prefix in Authorization header is missing")
+			return "", auth.ErrCredentialsInvalid.Withf("Required API key prefix is missing")
 		}
 		apiKey = strings.TrimPrefix(apiKey, a.Prefix)
 	}
 
-	a.Key = apiKey
-	return nil
+	// issued keys are verified against their hash, the owner becomes the user key
+	if a.Keys != nil && a.Keys.IsManagedKey(apiKey) {
+		verify := a.Keys.Verify
+		if auth.IsDryRun(ctx) {
+			verify = a.Keys.Check
+		}
+
+		key, err := verify(ctx.UserContext(), apiKey)
+		if err != nil {
+			return "", err
+		}
+
+		ctx.Locals(keyLocal, key)
+		ctx.Locals(auth.LocalAPIKey, key.Prefix)
+		return key.UserId, nil
+	}
+
+	if !a.AllowPlain {
+		return "", auth.ErrCredentialsInvalid.Withf("Plain API keys are disabled")
+	}
+
+	ctx.Locals(auth.LocalAPIKey, apiKey)
+	return apiKey, nil
 }
 
-func (a *ApiKeyValidator) GetValue() string {
-	return a.Key
+func (a *ApiKeyValidator) Challenge(err *auth.AuthError) string {
+	return auth.BearerChallenge("APIKey", a.Realm, err) + fmt.Sprintf(", header=%q", a.Header)
+}
+
+// ExtendPrincipal adds id and scopes of a managed key
+func (a *ApiKeyValidator) ExtendPrincipal(ctx *fiber.Ctx, principal *auth.Principal) {
+	key := GetKey(ctx)
+	if key == nil {
+		return
+	}
+
+	principal.CredentialId = key.Id
+	if len(key.Scopes) > 0 {
+		principal.Scopes = key.Scopes
+	}
+}
+
+// RegisterRoutes mounts the key management endpoints
+func (a *ApiKeyValidator) RegisterRoutes(root fiber.Router) {
+	if a.Keys != nil {
+		NewKeyHandler(a.Keys).Register(root, a.Config)
+	}
+}
+
+// GetKey returns the managed key of the current request, nil for plain keys
+func GetKey(ctx *fiber.Ctx) *auth.APIKey {
+	key, ok := ctx.Locals(keyLocal).(*auth.APIKey)
+	if !ok {
+		return nil
+	}
+	return key
+}
+
+// AttemptIdentity returns the id of a managed key, or a hash of a plain key,
+// failed attempts are counted per key
+func (a *ApiKeyValidator) AttemptIdentity(ctx *fiber.Ctx) string {
+	apiKey := ctx.Get(a.Header)
+	if apiKey == "" {
+		apiKey = strings.TrimPrefix(ctx.Get("Authorization"), "APIKey ")
+	}
+	apiKey = strings.TrimPrefix(apiKey, a.Prefix)
+	if apiKey == "" {
+		return ""
+	}
+
+	if a.Keys != nil && a.Keys.IsManagedKey(apiKey) {
+		return "apikey:" + strings.SplitN(apiKey, "_", 3)[1]
+	}
+	return "apikey:" + hashSecret(apiKey)[:16]
+}
+
+func (a *ApiKeyValidator) HasCredential(ctx *fiber.Ctx) bool {
+	return ctx.Get(a.Header) != "" || strings.HasPrefix(ctx.Get("Authorization"), "APIKey ")
 }
 
 func (a *ApiKeyValidator) VerifyUser(ctx *fiber.Ctx, userKey string, userInfo auth.IUserAuthInfo) (bool, error) {
@@ -95,9 +195,16 @@ func (a *ApiKeyValidator) VerifyUser(ctx *fiber.Ctx, userKey string, userInfo au
 	return false, nil
 }
 
+func (a *ApiKeyValidator) UserLookups(ctx *fiber.Ctx, userKey string) []auth.UserLookup {
+	return []auth.UserLookup{{Field: "key", Value: userKey}}
+}
+
 func NewApiKeyValidator(config config.AuthConfig) *ApiKeyValidator {
 	return &ApiKeyValidator{
-		Header: config.APIKeyHeader,
-		Prefix: config.APIKeyPrefix,
+		Header:     config.APIKeyHeader,
+		Prefix:     config.APIKeyPrefix,
+		Realm:      config.Realm,
+		AllowPlain: config.APIKeys.AllowPlain,
+		Config:     config.APIKeys,
 	}
 }
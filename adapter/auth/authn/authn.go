@@ -2,18 +2,21 @@ package authn
 
 import (
 	"fmt"
+	"slices"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/webcore-go/webcore/app/core"
-	"github.com/webcore-go/webcore/app/out"
 	"github.com/webcore-go/webcore/infra/config"
 	"github.com/webcore-go/webcore/port/auth"
 )
 
 type AuthN struct {
 	Validator     auth.IAuthValidator
+	Store         auth.IStore
 	Authenticator *auth.Authenticator
 	Authorizer    *auth.Authorization
+	Security      *auth.SecurityRegistry
+	MFA           *auth.MFA // verifies the code header of per-request schemes, nil when auth.mfa.enabled is false
 }
 
 func NewAuthN() *AuthN {
@@ -32,11 +35,13 @@ func (a *AuthN) Install(args ...any) error {
 		return fmt.Errorf("Authentication validator is not set")
 	}
 
-	if config.Type != a.Validator.Name() {
-		return fmt.Errorf("Type in Config(%s) and Validator Name(%s) does not match", config.Type, a.Validator.Name())
+	if !slices.Contains(config.Type, a.Validator.Name()) {
+		return fmt.Errorf("Type in Config(%v) does not contain Validator Name(%s)", config.Type, a.Validator.Name())
 	}
 
 	context := args[0].(*core.AppContext)
+	a.Security = context.Security
+	a.MFA = context.MFA
 	libmanager := core.Instance().LibraryManager
 	// lName := "authstorage:" + context.Config.Auth.Store
 	// loader, ok := libmanager.GetLoader(lName)
@@ -52,7 +57,8 @@ func (a *AuthN) Install(args ...any) error {
 	}
 
 	authstore := library.(auth.IAuthStore)
-	storeWrapper := auth.NewStoreWrapper(authstore.GetStore())
+	a.Store = authstore.GetStore()
+	storeWrapper := auth.NewStoreWrapper(a.Store)
 	a.Authenticator = auth.NewAuthenticator(a.Validator, storeWrapper)
 
 	// lzName := "authz:" + strings.ToLower(context.Config.Auth.Control)
@@ -72,29 +78,172 @@ func (a *AuthN) Install(args ...any) error {
 	if err != nil {
 		return err
 	}
+
+	switch config.DefaultPolicy {
+	case auth.DefaultPolicyAllow, auth.DefaultPolicyDeny:
+		authorizer.DefaultPolicy = config.DefaultPolicy
+	default:
+		return fmt.Errorf("Unknown auth.default_policy %s, use allow or deny", config.DefaultPolicy)
+	}
+	authorizer.Security = context.Security
 	a.Authorizer = authorizer
 
 	return nil
 }
 
-func (a *AuthN) GetAuthenticatonHandler() fiber.Handler {
-	return func(c *fiber.Ctx) error {
-		if err := a.Validator.ValidateKey(c); err != nil {
-			return c.Status(fiber.StatusUnauthorized).JSON(out.Error(fiber.StatusUnauthorized, 2, "UNAUTHORIZED", err.Error()))
+// Name returns the authentication type of the validator
+func (a *AuthN) Name() string {
+	return a.Validator.Name()
+}
+
+// HasCredential reports whether the request carries a credential of this type,
+// validators that cannot tell are always tried
+func (a *AuthN) HasCredential(c *fiber.Ctx) bool {
+	detector, ok := a.Validator.(auth.ICredentialDetector)
+	if !ok {
+		return true
+	}
+	return detector.HasCredential(c)
+}
+
+// Authenticate validates the credential and loads the user of the request
+func (a *AuthN) Authenticate(c *fiber.Ctx) (*auth.Principal, error) {
+	userKey, err := a.Validator.ValidateKey(c)
+	if err != nil {
+		return nil, auth.AsAuthError(err, auth.ErrCredentialsInvalid)
+	}
+
+	// store errors may contain the credential, they are only logged
+	userInfo, err := a.Authenticator.Check(c, userKey)
+	if err != nil {
+		if checker, ok := a.Validator.(auth.IDummyPasswordChecker); ok {
+			checker.CheckDummyPassword(c)
+		}
+		return nil, auth.AsAuthError(err, auth.ErrCredentialsInvalid)
+	}
+
+	auth.UpgradePassword(c, a.Store, userInfo)
+
+	principal := auth.NewPrincipal(a.Validator.Name(), userInfo)
+	if extender, ok := a.Validator.(auth.IPrincipalExtender); ok {
+		extender.ExtendPrincipal(c, principal)
+	}
+
+	// a wrong code fails the authentication, a missing one only the resources that require it
+	if a.MFA != nil {
+		if err := a.MFA.VerifyRequest(c, principal); err != nil {
+			return nil, auth.AsAuthError(err, auth.ErrMFAInvalid)
 		}
+	}
+
+	return principal, nil
+}
+
+// Authorize checks the principal against the resources of the store
+func (a *AuthN) Authorize(c *fiber.Ctx, principal *auth.Principal) error {
+	resourceInfo, err := a.Authorizer.Check(principal.User, auth.NewAccessRequest(c))
+	principal.Resource = resourceInfo
+	if err != nil {
+		return auth.AsAuthError(err, auth.ErrForbidden)
+	}
+
+	if err := a.checkScopes(principal, resourceInfo, c.Method(), c.Path()); err != nil {
+		return err
+	}
+
+	// also without auth.mfa.enabled, a resource that requires a second factor is never served without
+	if auth.ResourceRequiresMFA(resourceInfo) && !principal.MFA {
+		return auth.ErrMFARequired.Withf("Resource %s requires a second factor", resourceInfo.GetAction())
+	}
+
+	return nil
+}
 
-		if err := a.Authenticator.Check(c); err != nil {
-			return c.Status(fiber.StatusUnauthorized).JSON(out.Error(fiber.StatusUnauthorized, 2, "UNAUTHORIZED", err.Error()))
+// checkScopes limits a scoped credential to the actions of its scopes. A path
+// without resource and without route action has no action a scope could
+// allow, so it is denied also when auth.default_policy is allow.
+func (a *AuthN) checkScopes(principal *auth.Principal, resourceInfo auth.IResourceInfo, method string, path string) error {
+	if principal.Scopes == nil {
+		return nil
+	}
+
+	if resourceInfo != nil {
+		if !auth.ScopeAllows(principal.Scopes, resourceInfo.GetAction()) {
+			return auth.ErrInsufficientScope.WithScope(resourceInfo.GetAction())
 		}
+		return nil
+	}
+
+	// the actions of the route metadata are checked by RouteSecurity.Check
+	if a.Security == nil || len(a.Security.Actions(method, path)) == 0 {
+		return auth.ErrInsufficientScope.Withf("Path %s %s has no action for scoped credentials", method, path)
+	}
+	return nil
+}
+
+// FindPrincipal loads a user of the store by user id or username, for dry runs
+func (a *AuthN) FindPrincipal(c *fiber.Ctx, identity string) (*auth.Principal, error) {
+	userInfo, err := a.Authenticator.Loader.CheckUser(c, auth.NewIdentityValidator(a.Validator.Name()), identity)
+	if err != nil {
+		return nil, fmt.Errorf("User %s not found", identity)
+	}
+
+	return auth.NewPrincipal(a.Validator.Name(), userInfo), nil
+}
+
+// Explain is the dry run of Authorize
+func (a *AuthN) Explain(principal *auth.Principal, request *auth.AccessRequest, explanation *auth.Explanation) error {
+	resourceInfo, err := a.Authorizer.ExplainAuthorization(principal.User, request, explanation)
+	principal.Resource = resourceInfo
+	if err != nil {
+		return auth.AsAuthError(err, auth.ErrForbidden)
+	}
+
+	if err := a.checkScopes(principal, resourceInfo, request.Method, request.Path); err != nil {
+		return err
+	}
+	if principal.Scopes != nil && resourceInfo != nil {
+		explanation.Tracef("scopes %v allow action %s", principal.Scopes, resourceInfo.GetAction())
+	}
 
-		if err := a.Authorizer.Check(a.Authenticator.Loader.GetLoadedUser(), c.Method(), c.Path()); err != nil {
-			return c.Status(fiber.StatusUnauthorized).JSON(out.Error(fiber.StatusUnauthorized, 2, "UNAUTHORIZED", err.Error()))
+	if auth.ResourceRequiresMFA(resourceInfo) {
+		if !principal.MFA {
+			return auth.ErrMFARequired.Withf("Resource %s requires a second factor", resourceInfo.GetAction())
 		}
+		explanation.Tracef("second factor verified for action %s", resourceInfo.GetAction())
+	}
+
+	return nil
+}
+
+// AttemptIdentity returns the identity failed attempts are counted for,
+// empty when the credential of the validator cannot be guessed
+func (a *AuthN) AttemptIdentity(c *fiber.Ctx) string {
+	if identifier, ok := a.Validator.(auth.IAttemptIdentifier); ok {
+		return identifier.AttemptIdentity(c)
+	}
+	return ""
+}
+
+// Challenge returns the WWW-Authenticate challenge of the validator
+func (a *AuthN) Challenge(err *auth.AuthError) string {
+	if challenger, ok := a.Validator.(auth.IChallenger); ok {
+		return challenger.Challenge(err)
+	}
+	return ""
+}
 
-		return c.Next()
+// RegisterRoutes mounts the endpoints of the validator below the protected prefix
+func (a *AuthN) RegisterRoutes(root fiber.Router) {
+	if registrar, ok := a.Validator.(auth.IRouteRegistrar); ok {
+		registrar.RegisterRoutes(root)
 	}
 }
 
+func (a *AuthN) GetAuthenticatonHandler() fiber.Handler {
+	return auth.NewSchemeChain([]auth.IAuthScheme{a}, a.Security).Handler()
+}
+
 func (a *AuthN) Uninstall() error {
 	return nil
 }
@@ -7,6 +7,8 @@ import (
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/webcore-go/webcore/adapter/auth/authn"
+	"github.com/webcore-go/webcore/app/helper"
+	"github.com/webcore-go/webcore/infra/config"
 	"github.com/webcore-go/webcore/infra/logger"
 	"github.com/webcore-go/webcore/port"
 	"github.com/webcore-go/webcore/port/auth"
@@ -25,10 +27,15 @@ func (a *BasicAuthLoader) Name() string {
 }
 
 func (a *BasicAuthLoader) Init(args ...any) (port.Library, error) {
+	config := args[1].(config.AuthConfig)
+	validator, err := NewBasicAuthValidator(config)
+	if err != nil {
+		return nil, err
+	}
 
 	authn := &authn.AuthN{}
-	authn.SetValidator(&BasicAuthValidator{})
-	err := authn.Install(args...)
+	authn.SetValidator(validator)
+	err = authn.Install(args...)
 	if err != nil {
 		return nil, err
 	}
@@ -39,35 +46,58 @@ func (a *BasicAuthLoader) Init(args ...any) (port.Library, error) {
 type BasicAuthValidator struct {
 	Header string
 	Prefix string
-	Key    string
+	Realm  string
+	Hasher *helper.PasswordHasher
+}
+
+func NewBasicAuthValidator(config config.AuthConfig) (*BasicAuthValidator, error) {
+	hasher, err := helper.NewPasswordHasher(config.Password.Algorithm)
+	if err != nil {
+		return nil, err
+	}
+
+	// Basic auth sends the password with every request
+	hasher.CacheTTL = config.Password.CacheTTL
+
+	return &BasicAuthValidator{
+		Realm:  config.Realm,
+		Hasher: hasher,
+	}, nil
 }
 
 func (a *BasicAuthValidator) Name() string {
 	return "basic"
 }
 
-func (a *BasicAuthValidator) ValidateKey(ctx *fiber.Ctx) error {
+func (a *BasicAuthValidator) ValidateKey(ctx *fiber.Ctx) (string, error) {
 	var apiKey string
 
 	// Coba dapatkan dari Authorization
 	authHeader := ctx.Get("Authorization")
 	if authHeader == "" {
-		return fmt.Errorf("Authorization header required")
+		return "", auth.ErrCredentialsMissing.Withf("Authorization header required")
 	}
 
 	// konten dimulai dengan prefiks "Basic "
 	if strings.HasPrefix(authHeader, "Basic ") {
 		apiKey = strings.TrimPrefix(authHeader, "Basic ")
 	} else {
-		return fmt.Errorf("Required prefix in Authorization header is missing")
+		return "", auth.ErrCredentialsMalformed.Withf("Required prefix in Authorization header is missing")
+	}
+
+	if username, password := a.GetUserPassword(apiKey); username == "" || password == "" {
+		return "", auth.ErrCredentialsMalformed.Withf("Basic credentials are not base64 encoded username:password")
 	}
 
-	a.Key = apiKey
-	return nil
+	return apiKey, nil
 }
 
-func (a *BasicAuthValidator) GetValue() string {
-	return a.Key
+func (a *BasicAuthValidator) Challenge(err *auth.AuthError) string {
+	return fmt.Sprintf("Basic realm=%q, charset=\"UTF-8\"", a.Realm)
+}
+
+func (a *BasicAuthValidator) HasCredential(ctx *fiber.Ctx) bool {
+	return strings.HasPrefix(ctx.Get("Authorization"), "Basic ")
 }
 
 func (a *BasicAuthValidator) GetUserPassword(userKey string) (string, string) {
@@ -85,6 +115,30 @@ func (a *BasicAuthValidator) GetUserPassword(userKey string) (string, string) {
 	return parts[0], parts[1]
 }
 
+// AttemptIdentity returns the username, failed attempts are counted per user
+func (a *BasicAuthValidator) AttemptIdentity(ctx *fiber.Ctx) string {
+	username, _ := a.GetUserPassword(strings.TrimPrefix(ctx.Get("Authorization"), "Basic "))
+	if username == "" {
+		return ""
+	}
+	return "user:" + username
+}
+
+func (a *BasicAuthValidator) UserLookups(ctx *fiber.Ctx, userKey string) []auth.UserLookup {
+	username, _ := a.GetUserPassword(userKey)
+	if username == "" {
+		return nil
+	}
+	return []auth.UserLookup{{Field: "user", Value: username}}
+}
+
+func (a *BasicAuthValidator) CheckDummyPassword(ctx *fiber.Ctx) {
+	_, password := a.GetUserPassword(strings.TrimPrefix(ctx.Get("Authorization"), "Basic "))
+	if password != "" {
+		auth.CheckDummyPassword(ctx, a.Hasher, password)
+	}
+}
+
 func (a *BasicAuthValidator) VerifyUser(ctx *fiber.Ctx, userKey string, userInfo auth.IUserAuthInfo) (bool, error) {
 	if userKey == "" {
 		return false, nil
@@ -97,28 +151,22 @@ func (a *BasicAuthValidator) VerifyUser(ctx *fiber.Ctx, userKey string, userInfo
 
 	rbac, ok1 := userInfo.(*auth.UserAuthInfoRBAC)
 	if ok1 {
-		if rbac.Username != nil && *rbac.Username != username {
-			return false, nil
-		}
-
-		if rbac.Password != nil && *rbac.Password != password {
+		// users without username or password (e.g. API key users) cannot use Basic auth
+		if rbac.Username == nil || *rbac.Username != username {
 			return false, nil
 		}
 
-		return true, nil
+		return auth.CheckPassword(ctx, a.Hasher, rbac.Password, password), nil
 	}
 
 	abac, ok2 := userInfo.(*auth.UserAuthInfoABAC)
 	if ok2 {
-		if abac.Username != nil && *abac.Username != username {
-			return false, nil
-		}
-
-		if abac.Password != nil && *abac.Password != password {
+		// users without username or password (e.g. API key users) cannot use Basic auth
+		if abac.Username == nil || *abac.Username != username {
 			return false, nil
 		}
 
-		return true, nil
+		return auth.CheckPassword(ctx, a.Hasher, abac.Password, password), nil
 	}
 
 	return false, nil
@@ -0,0 +1,270 @@
+package hmac
+
+import (
+	gohmac "crypto/hmac"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/webcore-go/webcore/adapter/auth/authn"
+	"github.com/webcore-go/webcore/app/core"
+	"github.com/webcore-go/webcore/app/helper"
+	"github.com/webcore-go/webcore/infra/config"
+	"github.com/webcore-go/webcore/infra/logger"
+	"github.com/webcore-go/webcore/port"
+	"github.com/webcore-go/webcore/port/auth"
+)
+
+// key in fiber.Ctx locals with the signed request that is checked against the store
+const requestLocal = "hmac_request"
+
+// maxNonceLength limits the keys a client can put into the nonce store
+const maxNonceLength = 128
+
+type HmacLoader struct {
+	name string
+}
+
+func (a *HmacLoader) SetName(name string) {
+	a.name = name
+}
+
+func (a *HmacLoader) Name() string {
+	return a.name
+}
+
+func (l *HmacLoader) Init(args ...any) (port.Library, error) {
+	context := args[0].(*core.AppContext)
+	config := args[1].(config.AuthConfig)
+
+	nonces, err := nonceStore(context, config.HMAC.Store)
+	if err != nil {
+		return nil, err
+	}
+
+	validator, err := NewHmacValidator(config, nonces)
+	if err != nil {
+		return nil, err
+	}
+	validator.Revocation = context.Revocation
+
+	authn := &authn.AuthN{}
+	authn.SetValidator(validator)
+	err = authn.Install(args...)
+	if err != nil {
+		return nil, err
+	}
+
+	return authn, nil
+}
+
+// nonceStore returns the store of auth.hmac.store
+func nonceStore(context *core.AppContext, name string) (auth.INonceStore, error) {
+	switch name {
+	case "", "memory":
+		return auth.NewMemoryNonceStore(), nil
+	case "cache":
+		library, ok := context.GetSingletonInstance("redis")
+		if !ok {
+			library, ok = context.GetSingletonInstance("cache:redis")
+		}
+		cache, isCache := library.(port.IMemoryCache)
+		if !ok || !isCache {
+			return nil, fmt.Errorf("auth.hmac.store cache requires a memory cache library, configure redis")
+		}
+		return auth.NewCacheNonceStore(cache)
+	}
+	return nil, fmt.Errorf("Unknown auth.hmac.store %s, use memory or cache", name)
+}
+
+// signedRequest is a request whose signature is checked with the secret of each candidate user
+type signedRequest struct {
+	Credential   string
+	StringToSign string
+	Signature    string
+	Nonce        string
+	Date         time.Time
+}
+
+// HmacValidator authenticates server-to-server requests signed with a shared
+// secret. The credential is the username of the store, the secret is its
+// hmac_secret, stored encrypted with auth.hmac.secret_key. The secret never
+// travels over the wire and a captured request is accepted once and only
+// within the clock skew.
+type HmacValidator struct {
+	Realm           string
+	SecretKey       []byte // decrypts the hmac_secret of the users
+	ClockSkew       time.Duration
+	RequiredHeaders []string // lowercase, includes host, x-content-sha256, x-date and x-nonce
+	Nonces          auth.INonceStore
+	Revocation      *auth.Revocation // rejects revoked credentials (by subject), nil when auth.revocation.enabled is false
+}
+
+func NewHmacValidator(config config.AuthConfig, nonces auth.INonceStore) (*HmacValidator, error) {
+	if config.HMAC.ClockSkew <= 0 {
+		return nil, fmt.Errorf("auth.hmac.clock_skew must be positive")
+	}
+
+	secretKey, err := helper.ParseSecretKey(config.HMAC.SecretKey)
+	if err != nil {
+		return nil, fmt.Errorf("auth.hmac.secret_key: %v", err)
+	}
+
+	return &HmacValidator{
+		Realm:           config.Realm,
+		SecretKey:       secretKey,
+		ClockSkew:       config.HMAC.ClockSkew,
+		RequiredHeaders: SignedHeaders(append(slices.Clone(requiredHeaders), config.HMAC.RequiredHeaders...)),
+		Nonces:          nonces,
+	}, nil
+}
+
+func (a *HmacValidator) Name() string {
+	return "hmac"
+}
+
+func (a *HmacValidator) ValidateKey(ctx *fiber.Ctx) (string, error) {
+	authHeader := ctx.Get("Authorization")
+	if authHeader == "" {
+		return "", auth.ErrCredentialsMissing.Withf("Authorization header required")
+	}
+
+	authorization, err := ParseAuthorization(authHeader)
+	if err != nil {
+		return "", auth.ErrCredentialsMalformed.With(err)
+	}
+
+	for _, name := range a.RequiredHeaders {
+		if !slices.Contains(authorization.SignedHeaders, name) {
+			return "", auth.ErrCredentialsMalformed.Withf("Header %s must be signed", name)
+		}
+	}
+
+	dateHeader := ctx.Get(HeaderDate)
+	date, err := time.Parse(DateFormat, dateHeader)
+	if err != nil {
+		return "", auth.ErrCredentialsMalformed.Withf("%s must have the format %s", HeaderDate, DateFormat)
+	}
+	if skew := time.Since(date); skew > a.ClockSkew || skew < -a.ClockSkew {
+		return "", auth.ErrCredentialsExpired.Withf("%s is outside of the accepted clock skew", HeaderDate)
+	}
+
+	nonce := ctx.Get(HeaderNonce)
+	if nonce == "" || len(nonce) > maxNonceLength {
+		return "", auth.ErrCredentialsMalformed.Withf("%s must have 1 to %d characters", HeaderNonce, maxNonceLength)
+	}
+
+	bodyHash := HashHex(ctx.Request().Body())
+	if !strings.EqualFold(ctx.Get(HeaderContentSHA256), bodyHash) {
+		return "", auth.ErrCredentialsInvalid.Withf("Body does not match %s", HeaderContentSHA256)
+	}
+
+	if a.Revocation != nil {
+		token := auth.RevocationToken{Subject: authorization.Credential, IssuedAt: date}
+		if err := a.Revocation.Check(ctx.UserContext(), token); err != nil {
+			return "", err
+		}
+	}
+
+	uri := ctx.Request().URI()
+	header := func(name string) string { return ctx.Get(name) }
+	canonical := CanonicalRequest(ctx.Method(), string(uri.PathOriginal()), string(uri.QueryString()), header, authorization.SignedHeaders, bodyHash)
+
+	ctx.Locals(requestLocal, &signedRequest{
+		Credential:   authorization.Credential,
+		StringToSign: StringToSign(dateHeader, canonical),
+		Signature:    authorization.Signature,
+		Nonce:        nonce,
+		Date:         date,
+	})
+	return authorization.Credential, nil
+}
+
+func (a *HmacValidator) HasCredential(ctx *fiber.Ctx) bool {
+	return strings.HasPrefix(ctx.Get("Authorization"), Algorithm+" ")
+}
+
+// ExtendPrincipal replaces the user id, which can be a plain API key, with the
+// username, so the key does not reach handlers and the audit log
+func (a *HmacValidator) ExtendPrincipal(ctx *fiber.Ctx, principal *auth.Principal) {
+	request := getRequest(ctx)
+	if request == nil {
+		return
+	}
+
+	principal.UserId = request.Credential
+	principal.CredentialId = request.Credential
+}
+
+func (a *HmacValidator) Challenge(err *auth.AuthError) string {
+	return auth.BearerChallenge(Algorithm, a.Realm, err)
+}
+
+// VerifyUser checks the signature with the decrypted hmac_secret. The nonce is
+// remembered only for a valid signature, so forged requests cannot use up
+// the nonces of a client.
+func (a *HmacValidator) VerifyUser(ctx *fiber.Ctx, userKey string, userInfo auth.IUserAuthInfo) (bool, error) {
+	request := getRequest(ctx)
+	if request == nil || request.Credential != userKey {
+		return false, nil
+	}
+
+	var sealed, username *string
+	switch user := userInfo.(type) {
+	case *auth.UserAuthInfoRBAC:
+		sealed, username = user.HmacSecret, user.Username
+	case *auth.UserAuthInfoABAC:
+		sealed, username = user.HmacSecret, user.Username
+	}
+	if username == nil || *username != userKey {
+		return false, nil
+	}
+
+	// the user key is never a signing secret, users without hmac_secret cannot sign
+	if sealed == nil || *sealed == "" {
+		logger.Warn("HMAC signed request of a user without hmac_secret", "user", userKey)
+		return false, nil
+	}
+	secret, err := helper.DecryptSecret(a.SecretKey, *sealed, userKey)
+	if err != nil {
+		logger.Warn("Decrypt hmac_secret failed", "user", userKey, "error", err)
+		return false, nil
+	}
+
+	if !gohmac.Equal([]byte(Signature(secret, request.StringToSign)), []byte(request.Signature)) {
+		return false, nil
+	}
+
+	// a dry run leaves the nonce to the request it was signed for
+	if auth.IsDryRun(ctx) {
+		return true, nil
+	}
+
+	// the nonce is kept until X-Date leaves the clock skew, later the request is rejected by its date
+	key := "auth:nonce:" + request.Credential + ":" + request.Nonce
+	fresh, err := a.Nonces.Remember(ctx.UserContext(), key, time.Until(request.Date.Add(a.ClockSkew)))
+	if err != nil {
+		return true, auth.ErrCredentialsInvalid.With(err)
+	}
+	if !fresh {
+		logger.Warn("Replayed HMAC signed request", "credential", request.Credential, "nonce", request.Nonce, "ip", ctx.IP())
+		return true, auth.ErrCredentialsInvalid.Withf("%s was already used", HeaderNonce)
+	}
+
+	return true, nil
+}
+
+// UserLookups asks the store by username, the user key is the credential
+func (a *HmacValidator) UserLookups(ctx *fiber.Ctx, userKey string) []auth.UserLookup {
+	return []auth.UserLookup{{Field: "user", Value: userKey}}
+}
+
+func getRequest(ctx *fiber.Ctx) *signedRequest {
+	request, ok := ctx.Locals(requestLocal).(*signedRequest)
+	if !ok {
+		return nil
+	}
+	return request
+}
@@ -0,0 +1,198 @@
+package hmac
+
+import (
+	"bytes"
+	gohmac "crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Algorithm is the scheme of the Authorization header and the first line of the string to sign
+const Algorithm = "WEBCORE-HMAC-SHA256"
+
+// Headers of a signed request
+const (
+	HeaderDate          = "X-Date"           // time of signing in DateFormat (UTC)
+	HeaderNonce         = "X-Nonce"          // random value, each nonce is accepted once
+	HeaderContentSHA256 = "X-Content-SHA256" // lowercase hex SHA-256 of the body
+)
+
+// DateFormat is the ISO 8601 basic format of X-Date, e.g. 20240131T120000Z
+const DateFormat = "20060102T150405Z"
+
+// SignedHeaders that every request has to sign
+var requiredHeaders = []string{"host", "x-content-sha256", "x-date", "x-nonce"}
+
+// Authorization holds the parameters of the Authorization header
+type Authorization struct {
+	Credential    string   // username of the client in the auth store
+	SignedHeaders []string // lowercase and sorted
+	Signature     string   // lowercase hex
+}
+
+// ParseAuthorization reads
+// "WEBCORE-HMAC-SHA256 Credential=<user>, SignedHeaders=<h1;h2>, Signature=<hex>"
+func ParseAuthorization(header string) (*Authorization, error) {
+	params, found := strings.CutPrefix(header, Algorithm+" ")
+	if !found {
+		return nil, fmt.Errorf("Required prefix in Authorization header is missing")
+	}
+
+	result := &Authorization{}
+	for _, param := range strings.Split(params, ",") {
+		key, value, found := strings.Cut(strings.TrimSpace(param), "=")
+		if !found {
+			return nil, fmt.Errorf("Invalid Authorization parameter %q", param)
+		}
+		switch key {
+		case "Credential":
+			result.Credential = value
+		case "SignedHeaders":
+			result.SignedHeaders = SignedHeaders(strings.Split(value, ";"))
+		case "Signature":
+			result.Signature = strings.ToLower(value)
+		}
+	}
+
+	if result.Credential == "" || len(result.SignedHeaders) == 0 || result.Signature == "" {
+		return nil, fmt.Errorf("Authorization header requires Credential, SignedHeaders and Signature")
+	}
+	return result, nil
+}
+
+// SignedHeaders returns the names lowercase, sorted and without duplicates
+func SignedHeaders(names []string) []string {
+	result := make([]string, 0, len(names))
+	for _, name := range names {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name != "" && !slices.Contains(result, name) {
+			result = append(result, name)
+		}
+	}
+	sort.Strings(result)
+	return result
+}
+
+// CanonicalRequest joins the signed parts of a request, one per line: method,
+// escaped path, sorted query, "name:value" of each signed header, the signed
+// header names and the body hash. The path is signed as sent, a proxy that
+// rewrites it breaks the signature.
+func CanonicalRequest(method string, path string, rawQuery string, header func(string) string, signedHeaders []string, bodyHash string) string {
+	if path == "" {
+		path = "/"
+	}
+
+	var b strings.Builder
+	b.WriteString(strings.ToUpper(method) + "\n")
+	b.WriteString(path + "\n")
+	b.WriteString(canonicalQuery(rawQuery) + "\n")
+	for _, name := range signedHeaders {
+		// white space inside values is collapsed, proxies may fold it
+		b.WriteString(name + ":" + strings.Join(strings.Fields(header(name)), " ") + "\n")
+	}
+	b.WriteString(strings.Join(signedHeaders, ";") + "\n")
+	b.WriteString(bodyHash)
+	return b.String()
+}
+
+// canonicalQuery encodes names and values per RFC 3986 and sorts the pairs,
+// so clients may send the parameters in any order and encoding
+func canonicalQuery(rawQuery string) string {
+	if rawQuery == "" {
+		return ""
+	}
+
+	pairs := make([]string, 0, strings.Count(rawQuery, "&")+1)
+	for _, part := range strings.Split(rawQuery, "&") {
+		if part == "" {
+			continue
+		}
+		key, value, _ := strings.Cut(part, "=")
+		pairs = append(pairs, escape(unescape(key))+"="+escape(unescape(value)))
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, "&")
+}
+
+func unescape(value string) string {
+	if unescaped, err := url.QueryUnescape(value); err == nil {
+		return unescaped
+	}
+	return value
+}
+
+func escape(value string) string {
+	return strings.ReplaceAll(strings.ReplaceAll(url.QueryEscape(value), "+", "%20"), "%7E", "~")
+}
+
+// StringToSign binds the canonical request to the algorithm and the time of signing
+func StringToSign(date string, canonicalRequest string) string {
+	return Algorithm + "\n" + date + "\n" + HashHex([]byte(canonicalRequest))
+}
+
+// Signature returns the lowercase hex HMAC-SHA256 of the string to sign
+func Signature(secret string, stringToSign string) string {
+	mac := gohmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(stringToSign))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// HashHex returns the lowercase hex SHA-256 of data
+func HashHex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// Sign signs an outgoing request for a webcore service, e.g. from another
+// service written in Go. It sets X-Date, X-Nonce, X-Content-SHA256 and the
+// Authorization header. Extra headers are signed as well, they must be set
+// before. The body is read and replaced.
+func Sign(request *http.Request, credential string, secret string, headers ...string) error {
+	var body []byte
+	if request.Body != nil && request.Body != http.NoBody {
+		var err error
+		if body, err = io.ReadAll(request.Body); err != nil {
+			return fmt.Errorf("Read request body: %v", err)
+		}
+		request.Body.Close()
+		request.Body = io.NopCloser(bytes.NewReader(body))
+	}
+
+	nonce := make([]byte, 16)
+	if _, err := rand.Read(nonce); err != nil {
+		return fmt.Errorf("Generate nonce: %v", err)
+	}
+
+	date := time.Now().UTC().Format(DateFormat)
+	bodyHash := HashHex(body)
+	request.Header.Set(HeaderDate, date)
+	request.Header.Set(HeaderNonce, hex.EncodeToString(nonce))
+	request.Header.Set(HeaderContentSHA256, bodyHash)
+
+	host := request.Host
+	if host == "" {
+		host = request.URL.Host
+	}
+	header := func(name string) string {
+		if name == "host" {
+			return host
+		}
+		return request.Header.Get(name)
+	}
+
+	signed := SignedHeaders(append(headers, requiredHeaders...))
+	canonical := CanonicalRequest(request.Method, request.URL.EscapedPath(), request.URL.RawQuery, header, signed, bodyHash)
+	signature := Signature(secret, StringToSign(date, canonical))
+
+	request.Header.Set("Authorization", fmt.Sprintf("%s Credential=%s, SignedHeaders=%s, Signature=%s", Algorithm, credential, strings.Join(signed, ";"), signature))
+	return nil
+}
@@ -0,0 +1,260 @@
+package jwt
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	gojwt "github.com/golang-jwt/jwt/v5"
+	"github.com/webcore-go/webcore/app/helper"
+	"github.com/webcore-go/webcore/app/out"
+	"github.com/webcore-go/webcore/infra/config"
+	"github.com/webcore-go/webcore/port/auth"
+)
+
+type LoginRequest struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
+type RefreshRequest struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
+type LogoutRequest struct {
+	RefreshToken string `json:"refresh_token"` // revoked together with the access token
+	All          bool   `json:"all"`           // revoke every token of the user, e.g. on all devices
+}
+
+type TokenResponse struct {
+	Token        string `json:"token"`
+	RefreshToken string `json:"refresh_token,omitempty"`
+	ExpiresIn    int64  `json:"expires_in"`
+	TokenType    string `json:"token_type"`
+}
+
+// TokenHandler serves the login, refresh and logout endpoints
+type TokenHandler struct {
+	Tokens     *TokenManager
+	Store      auth.IStore
+	Hasher     *helper.PasswordHasher
+	Lockout    *auth.Lockout    // counts failed logins per user and IP, may be nil
+	Revocation *auth.Revocation // makes refresh tokens single use and enables logout, may be nil
+}
+
+func NewTokenHandler(tokens *TokenManager, store auth.IStore, hasher *helper.PasswordHasher) *TokenHandler {
+	return &TokenHandler{
+		Tokens: tokens,
+		Store:  store,
+		Hasher: hasher,
+	}
+}
+
+// Register mounts the endpoints outside of the protected path prefix
+func (h *TokenHandler) Register(router fiber.Router, config config.JWTConfig) {
+	if config.LoginPath != "" {
+		router.Post(config.LoginPath, h.Login)
+	}
+
+	if config.RefreshPath != "" {
+		router.Post(config.RefreshPath, h.Refresh)
+	}
+
+	// a logout without revocation would leave the token valid
+	if config.LogoutPath != "" && h.Revocation != nil {
+		router.Post(config.LogoutPath, h.Logout)
+	}
+}
+
+func (h *TokenHandler) Login(c *fiber.Ctx) error {
+	var req LoginRequest
+	if err := c.BodyParser(&req); err != nil || req.Username == "" || req.Password == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(out.Error(fiber.StatusBadRequest, 1, "BAD_REQUEST", "username and password are required"))
+	}
+
+	// same identity as Basic auth, guesses over both endpoints are counted together
+	identities := []string{"user:" + req.Username}
+	if h.Lockout != nil {
+		if err := h.Lockout.Check(c, identities); err != nil {
+			return auth.AsAuthError(err, auth.ErrTooManyAttempts).Respond(c, nil)
+		}
+	}
+
+	validator := auth.NewPasswordValidator(req.Username, req.Password, h.Hasher)
+	userInfo, err := h.Store.GetUserAuthInfo(c, validator, req.Username)
+	if errors.Is(err, auth.ErrStoreUnavailable) {
+		return auth.AsAuthError(err, auth.ErrStoreUnavailable).Respond(c, nil)
+	}
+	if err != nil || userInfo == nil {
+		validator.CheckDummyPassword(c)
+		if h.Lockout != nil {
+			h.Lockout.Fail(c, "jwt", identities)
+		}
+		return auth.ErrCredentialsInvalid.With(err).Respond(c, nil)
+	}
+
+	if h.Lockout != nil {
+		h.Lockout.Succeed(c, identities)
+	}
+
+	auth.UpgradePassword(c, h.Store, userInfo)
+
+	return h.issue(c, userInfo)
+}
+
+func (h *TokenHandler) Refresh(c *fiber.Ctx) error {
+	var req RefreshRequest
+	if err := c.BodyParser(&req); err != nil || req.RefreshToken == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(out.Error(fiber.StatusBadRequest, 1, "BAD_REQUEST", "refresh_token is required"))
+	}
+
+	claims, err := h.Tokens.Parse(req.RefreshToken, TokenTypeRefresh)
+	if err != nil {
+		return tokenError(err).Respond(c, nil)
+	}
+
+	if h.Revocation != nil {
+		token := h.Tokens.RevocationToken(claims)
+		if err := h.Revocation.Check(c.UserContext(), token); err != nil {
+			return auth.AsAuthError(err, auth.ErrCredentialsRevoked).Respond(c, nil)
+		}
+
+		// the refresh token is single use, a stolen copy fails after the owner refreshed
+		if token.ID != "" {
+			if err := h.Revocation.RevokeToken(c.UserContext(), token.ID, h.Tokens.ExpiresAt(claims), "refreshed"); err != nil {
+				return c.Status(fiber.StatusInternalServerError).JSON(out.ErrorDetail(fiber.StatusInternalServerError, 1, "UNKNOWN", "Failed to refresh token", err))
+			}
+		}
+	}
+
+	// Load the user again so removed users and changed roles take effect
+	subject := h.Tokens.Subject(claims)
+	userInfo, err := h.Store.GetUserAuthInfo(c, &subjectValidator{Subject: subject}, subject)
+	if err != nil || userInfo == nil {
+		return auth.ErrCredentialsInvalid.With(err).Respond(c, nil)
+	}
+
+	return h.issue(c, userInfo)
+}
+
+// Logout revokes the access token of the Authorization header and the
+// refresh token of the body. With "all" every token of the user issued so far
+// is revoked.
+func (h *TokenHandler) Logout(c *fiber.Ctx) error {
+	var req LogoutRequest
+	if len(c.Body()) > 0 {
+		if err := c.BodyParser(&req); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(out.Error(fiber.StatusBadRequest, 1, "BAD_REQUEST", "invalid request body"))
+		}
+	}
+
+	authHeader := c.Get("Authorization")
+	if !strings.HasPrefix(authHeader, "Bearer ") {
+		return auth.ErrCredentialsMissing.Respond(c, nil)
+	}
+
+	claims, err := h.Tokens.Parse(strings.TrimPrefix(authHeader, "Bearer "), TokenTypeAccess)
+	if err != nil {
+		return tokenError(err).Respond(c, nil)
+	}
+	token := h.Tokens.RevocationToken(claims)
+	if err := h.Revocation.Check(c.UserContext(), token); err != nil {
+		return auth.AsAuthError(err, auth.ErrCredentialsRevoked).Respond(c, nil)
+	}
+
+	revoke := []gojwt.MapClaims{claims}
+	if req.RefreshToken != "" {
+		refresh, err := h.Tokens.Parse(req.RefreshToken, TokenTypeRefresh)
+		if err != nil || h.Tokens.Subject(refresh) != token.Subject {
+			return auth.ErrCredentialsInvalid.Withf("refresh token does not belong to the access token").Respond(c, nil)
+		}
+		revoke = append(revoke, refresh)
+	}
+
+	if req.All {
+		err = h.Revocation.RevokeIssuedBefore(c.UserContext(), token.Subject, time.Now(), "logout")
+	} else {
+		for _, claims := range revoke {
+			id := h.Tokens.RevocationToken(claims).ID
+			if id == "" {
+				continue
+			}
+			if err = h.Revocation.RevokeToken(c.UserContext(), id, h.Tokens.ExpiresAt(claims), "logout"); err != nil {
+				break
+			}
+		}
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(out.ErrorDetail(fiber.StatusInternalServerError, 1, "UNKNOWN", "Failed to log out", err))
+	}
+
+	return c.JSON(out.SuccessMessage("Logged out"))
+}
+
+func (h *TokenHandler) issue(c *fiber.Ctx, userInfo auth.IUserAuthInfo) error {
+	subject, groups, roles := userClaims(userInfo)
+	if subject == "" {
+		return auth.ErrCredentialsInvalid.Withf("User has no username").Respond(c, nil)
+	}
+
+	token, expiresIn, err := h.Tokens.Issue(subject, groups, roles, TokenTypeAccess)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(out.ErrorDetail(fiber.StatusInternalServerError, 1, "UNKNOWN", "Failed to issue token", err))
+	}
+
+	refreshToken, _, err := h.Tokens.Issue(subject, nil, nil, TokenTypeRefresh)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(out.ErrorDetail(fiber.StatusInternalServerError, 1, "UNKNOWN", "Failed to issue token", err))
+	}
+
+	return c.JSON(TokenResponse{
+		Token:        token,
+		RefreshToken: refreshToken,
+		ExpiresIn:    int64(expiresIn.Seconds()),
+		TokenType:    "Bearer",
+	})
+}
+
+// userClaims returns subject, groups and roles that are written into the access
+// token. The subject is the username: the user key can be a plain API key, and
+// the payload of a token is readable by everyone who holds it.
+func userClaims(userInfo auth.IUserAuthInfo) (string, []string, []string) {
+	switch user := userInfo.(type) {
+	case *auth.UserAuthInfoRBAC:
+		if user.Username != nil {
+			return *user.Username, user.Groups, user.Roles
+		}
+	case *auth.UserAuthInfoABAC:
+		if user.Username != nil {
+			return *user.Username, user.Groups, nil
+		}
+	}
+
+	return "", nil, nil
+}
+
+// subjectValidator looks up the user of a refresh token
+type subjectValidator struct {
+	Subject string
+}
+
+func (v *subjectValidator) Name() string {
+	return "subject"
+}
+
+func (v *subjectValidator) ValidateKey(ctx *fiber.Ctx) (string, error) {
+	if v.Subject == "" {
+		return "", fmt.Errorf("Token has no subject")
+	}
+	return v.Subject, nil
+}
+
+func (v *subjectValidator) UserLookups(ctx *fiber.Ctx, userKey string) []auth.UserLookup {
+	return subjectLookups(v.Subject)
+}
+
+func (v *subjectValidator) VerifyUser(ctx *fiber.Ctx, userKey string, userInfo auth.IUserAuthInfo) (bool, error) {
+	return matchSubject(v.Subject, userInfo), nil
+}
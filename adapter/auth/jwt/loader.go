@@ -0,0 +1,205 @@
+package jwt
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	gojwt "github.com/golang-jwt/jwt/v5"
+	"github.com/webcore-go/webcore/adapter/auth/authn"
+	"github.com/webcore-go/webcore/app/core"
+	"github.com/webcore-go/webcore/app/helper"
+	"github.com/webcore-go/webcore/infra/config"
+	"github.com/webcore-go/webcore/infra/logger"
+	"github.com/webcore-go/webcore/port"
+	"github.com/webcore-go/webcore/port/auth"
+)
+
+// key in fiber.Ctx locals where verified claims of the current request are stored
+const claimsLocal = "jwt_claims"
+
+type JwtLoader struct {
+	name string
+}
+
+func (a *JwtLoader) SetName(name string) {
+	a.name = name
+}
+
+func (a *JwtLoader) Name() string {
+	return a.name
+}
+
+func (a *JwtLoader) Init(args ...any) (port.Library, error) {
+	context := args[0].(*core.AppContext)
+	config := args[1].(config.AuthConfig)
+
+	tokens, err := NewTokenManager(config)
+	if err != nil {
+		return nil, err
+	}
+
+	authn := &authn.AuthN{}
+	validator := NewJwtValidator(config, tokens)
+	validator.Revocation = context.Revocation
+	authn.SetValidator(validator)
+	err = authn.Install(args...)
+	if err != nil {
+		return nil, err
+	}
+
+	if tokens.CanSign() {
+		hasher, err := helper.NewPasswordHasher(config.Password.Algorithm)
+		if err != nil {
+			return nil, err
+		}
+
+		handler := NewTokenHandler(tokens, authn.Store, hasher)
+		handler.Lockout = context.Lockout
+		handler.Revocation = context.Revocation
+		handler.Register(context.Web, config.JWT)
+	} else {
+		logger.Info("JWT signing key is not configured, login and refresh endpoints are disabled")
+	}
+
+	return authn, nil
+}
+
+type JwtValidator struct {
+	Control    string
+	Realm      string
+	Tokens     *TokenManager
+	Revocation *auth.Revocation // rejects revoked tokens, nil when auth.revocation.enabled is false
+}
+
+func NewJwtValidator(config config.AuthConfig, tokens *TokenManager) *JwtValidator {
+	return &JwtValidator{
+		Control: config.Control,
+		Realm:   config.Realm,
+		Tokens:  tokens,
+	}
+}
+
+func (a *JwtValidator) Name() string {
+	return "jwt"
+}
+
+func (a *JwtValidator) ValidateKey(ctx *fiber.Ctx) (string, error) {
+	authHeader := ctx.Get("Authorization")
+	if authHeader == "" {
+		return "", auth.ErrCredentialsMissing.Withf("Authorization header required")
+	}
+
+	// konten dimulai dengan prefiks "Bearer "
+	if !strings.HasPrefix(authHeader, "Bearer ") {
+		return "", auth.ErrCredentialsMalformed.Withf("Required prefix in Authorization header is missing")
+	}
+	token := strings.TrimPrefix(authHeader, "Bearer ")
+
+	claims, err := a.Tokens.Parse(token, TokenTypeAccess)
+	if err != nil {
+		return "", tokenError(err)
+	}
+
+	if a.Revocation != nil {
+		if err := a.Revocation.Check(ctx.UserContext(), a.Tokens.RevocationToken(claims)); err != nil {
+			return "", err
+		}
+	}
+
+	ctx.Locals(claimsLocal, claims)
+	return token, nil
+}
+
+func (a *JwtValidator) HasCredential(ctx *fiber.Ctx) bool {
+	return strings.HasPrefix(ctx.Get("Authorization"), "Bearer ")
+}
+
+// ResolveUser builds the RBAC user directly from the token claims. ABAC users
+// need their policies, so they are looked up in the store by subject instead.
+func (a *JwtValidator) ResolveUser(ctx *fiber.Ctx) (auth.IUserAuthInfo, error) {
+	if a.Control == "ABAC" {
+		return nil, nil
+	}
+
+	claims := GetClaims(ctx)
+	if claims == nil {
+		return nil, auth.ErrCredentialsInvalid
+	}
+
+	// tokens of the login endpoint carry the username as subject
+	subject := a.Tokens.Subject(claims)
+	return &auth.UserAuthInfoRBAC{
+		UserId:   subject,
+		Username: &subject,
+		Groups:   a.Tokens.Groups(claims),
+		Roles:    a.Tokens.Roles(claims),
+	}, nil
+}
+
+func (a *JwtValidator) Challenge(err *auth.AuthError) string {
+	return auth.BearerChallenge("Bearer", a.Realm, err)
+}
+
+func (a *JwtValidator) VerifyUser(ctx *fiber.Ctx, userKey string, userInfo auth.IUserAuthInfo) (bool, error) {
+	claims := GetClaims(ctx)
+	if claims == nil {
+		return false, nil
+	}
+
+	return matchSubject(a.Tokens.Subject(claims), userInfo), nil
+}
+
+func (a *JwtValidator) UserLookups(ctx *fiber.Ctx, userKey string) []auth.UserLookup {
+	claims := GetClaims(ctx)
+	if claims == nil {
+		return nil
+	}
+	return subjectLookups(a.Tokens.Subject(claims))
+}
+
+// tokenError maps a failed Parse to the error of the response
+func tokenError(err error) *auth.AuthError {
+	switch {
+	case errors.Is(err, gojwt.ErrTokenExpired):
+		return auth.ErrCredentialsExpired.With(err)
+	case errors.Is(err, gojwt.ErrTokenMalformed):
+		return auth.ErrCredentialsMalformed.With(err)
+	}
+	return auth.ErrCredentialsInvalid.With(err)
+}
+
+// GetClaims returns the verified claims of the current request
+func GetClaims(ctx *fiber.Ctx) gojwt.MapClaims {
+	claims, ok := ctx.Locals(claimsLocal).(gojwt.MapClaims)
+	if !ok {
+		return nil
+	}
+	return claims
+}
+
+// subjectLookups returns the store lookups of a token subject. The login
+// endpoint issues the username; the user key is still looked up for tokens of
+// other issuers and for refresh tokens issued before.
+func subjectLookups(subject string) []auth.UserLookup {
+	return []auth.UserLookup{{Field: "user", Value: subject}, {Field: "key", Value: subject}}
+}
+
+// matchSubject checks the token subject against user key or username
+func matchSubject(subject string, userInfo auth.IUserAuthInfo) bool {
+	if subject == "" {
+		return false
+	}
+
+	rbac, ok1 := userInfo.(*auth.UserAuthInfoRBAC)
+	if ok1 {
+		return subject == rbac.UserId || (rbac.Username != nil && subject == *rbac.Username)
+	}
+
+	abac, ok2 := userInfo.(*auth.UserAuthInfoABAC)
+	if ok2 {
+		return subject == abac.UserId || (abac.Username != nil && subject == *abac.Username)
+	}
+
+	return false
+}
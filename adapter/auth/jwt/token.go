@@ -0,0 +1,260 @@
+package jwt
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	gojwt "github.com/golang-jwt/jwt/v5"
+	"github.com/webcore-go/webcore/app/helper"
+	"github.com/webcore-go/webcore/infra/config"
+	"github.com/webcore-go/webcore/port/auth"
+)
+
+const (
+	TokenTypeAccess  = "access"
+	TokenTypeRefresh = "refresh"
+
+	// claim that separates access tokens from refresh tokens
+	tokenTypeClaim = "token_type"
+)
+
+// TokenManager signs and verifies the tokens handled by the JWT adapter
+type TokenManager struct {
+	Method           gojwt.SigningMethod
+	SignKey          any // nil when tokens are only verified (issued by another service)
+	VerifyKey        any
+	Issuer           string
+	Audience         []string
+	Leeway           time.Duration
+	ExpiresIn        time.Duration
+	RefreshExpiresIn time.Duration
+	GroupsClaim      string
+	RolesClaim       string
+}
+
+func NewTokenManager(config config.AuthConfig) (*TokenManager, error) {
+	t := &TokenManager{
+		Issuer:           config.JWT.Issuer,
+		Audience:         config.JWT.Audience,
+		Leeway:           config.JWT.Leeway,
+		ExpiresIn:        config.ExpiresIn,
+		RefreshExpiresIn: config.JWT.RefreshExpiresIn,
+		GroupsClaim:      config.JWT.GroupsClaim,
+		RolesClaim:       config.JWT.RolesClaim,
+	}
+
+	algorithm := strings.ToUpper(config.JWT.Algorithm)
+	switch algorithm {
+	case "", "HS256":
+		if config.SecretKey == "" {
+			return nil, fmt.Errorf("auth.secret_key is required for JWT algorithm HS256")
+		}
+		t.Method = gojwt.SigningMethodHS256
+		t.SignKey = []byte(config.SecretKey)
+		t.VerifyKey = t.SignKey
+	case "RS256":
+		t.Method = gojwt.SigningMethodRS256
+		if config.JWT.PrivateKey != "" {
+			data, err := os.ReadFile(config.JWT.PrivateKey)
+			if err != nil {
+				return nil, fmt.Errorf("read JWT private key: %v", err)
+			}
+			key, err := gojwt.ParseRSAPrivateKeyFromPEM(data)
+			if err != nil {
+				return nil, fmt.Errorf("parse JWT private key: %v", err)
+			}
+			t.SignKey = key
+			t.VerifyKey = &key.PublicKey
+		}
+		if config.JWT.PublicKey != "" {
+			data, err := os.ReadFile(config.JWT.PublicKey)
+			if err != nil {
+				return nil, fmt.Errorf("read JWT public key: %v", err)
+			}
+			key, err := gojwt.ParseRSAPublicKeyFromPEM(data)
+			if err != nil {
+				return nil, fmt.Errorf("parse JWT public key: %v", err)
+			}
+			t.VerifyKey = key
+		}
+	case "ES256":
+		t.Method = gojwt.SigningMethodES256
+		if config.JWT.PrivateKey != "" {
+			data, err := os.ReadFile(config.JWT.PrivateKey)
+			if err != nil {
+				return nil, fmt.Errorf("read JWT private key: %v", err)
+			}
+			key, err := gojwt.ParseECPrivateKeyFromPEM(data)
+			if err != nil {
+				return nil, fmt.Errorf("parse JWT private key: %v", err)
+			}
+			t.SignKey = key
+			t.VerifyKey = &key.PublicKey
+		}
+		if config.JWT.PublicKey != "" {
+			data, err := os.ReadFile(config.JWT.PublicKey)
+			if err != nil {
+				return nil, fmt.Errorf("read JWT public key: %v", err)
+			}
+			key, err := gojwt.ParseECPublicKeyFromPEM(data)
+			if err != nil {
+				return nil, fmt.Errorf("parse JWT public key: %v", err)
+			}
+			t.VerifyKey = key
+		}
+	default:
+		return nil, fmt.Errorf("Unsupported JWT algorithm %s", config.JWT.Algorithm)
+	}
+
+	if t.VerifyKey == nil {
+		return nil, fmt.Errorf("auth.jwt.public_key or auth.jwt.private_key is required for JWT algorithm %s", algorithm)
+	}
+
+	return t, nil
+}
+
+// CanSign reports whether this instance is able to issue tokens
+func (t *TokenManager) CanSign() bool {
+	return t.SignKey != nil
+}
+
+// Issue creates a signed token for the subject, tokenType is TokenTypeAccess or TokenTypeRefresh
+func (t *TokenManager) Issue(subject string, groups []string, roles []string, tokenType string) (string, time.Duration, error) {
+	if !t.CanSign() {
+		return "", 0, fmt.Errorf("JWT signing key is not configured")
+	}
+
+	expiresIn := t.ExpiresIn
+	if tokenType == TokenTypeRefresh {
+		expiresIn = t.RefreshExpiresIn
+	}
+
+	jti, err := helper.GenerateUUID()
+	if err != nil {
+		return "", 0, err
+	}
+
+	now := time.Now()
+	claims := gojwt.MapClaims{
+		"sub":          subject,
+		"iat":          now.Unix(),
+		"nbf":          now.Unix(),
+		"exp":          now.Add(expiresIn).Unix(),
+		"jti":          jti,
+		tokenTypeClaim: tokenType,
+	}
+	if t.Issuer != "" {
+		claims["iss"] = t.Issuer
+	}
+	if len(t.Audience) > 0 {
+		claims["aud"] = t.Audience
+	}
+	if len(groups) > 0 {
+		claims[t.GroupsClaim] = groups
+	}
+	if len(roles) > 0 {
+		claims[t.RolesClaim] = roles
+	}
+
+	signed, err := gojwt.NewWithClaims(t.Method, claims).SignedString(t.SignKey)
+	if err != nil {
+		return "", 0, err
+	}
+
+	return signed, expiresIn, nil
+}
+
+// Parse verifies signature, exp, nbf, iss and aud of a token and returns its claims
+func (t *TokenManager) Parse(token string, tokenType string) (gojwt.MapClaims, error) {
+	options := []gojwt.ParserOption{
+		gojwt.WithValidMethods([]string{t.Method.Alg()}),
+		gojwt.WithLeeway(t.Leeway),
+		gojwt.WithExpirationRequired(),
+		gojwt.WithIssuedAt(),
+	}
+	if t.Issuer != "" {
+		options = append(options, gojwt.WithIssuer(t.Issuer))
+	}
+	if len(t.Audience) > 0 {
+		options = append(options, gojwt.WithAudience(t.Audience...))
+	}
+
+	claims := gojwt.MapClaims{}
+	_, err := gojwt.ParseWithClaims(token, claims, func(*gojwt.Token) (any, error) {
+		return t.VerifyKey, nil
+	}, options...)
+	if err != nil {
+		return nil, err
+	}
+
+	// Tokens without token_type come from other issuers and are treated as access tokens
+	actualType, _ := claims[tokenTypeClaim].(string)
+	if actualType == "" {
+		actualType = TokenTypeAccess
+	}
+	if actualType != tokenType {
+		return nil, fmt.Errorf("Token type %s is not accepted", actualType)
+	}
+
+	if sub, _ := claims.GetSubject(); sub == "" {
+		return nil, fmt.Errorf("Token has no subject")
+	}
+
+	return claims, nil
+}
+
+// Subject returns the "sub" claim
+func (t *TokenManager) Subject(claims gojwt.MapClaims) string {
+	sub, _ := claims.GetSubject()
+	return sub
+}
+
+// RevocationToken returns jti, subject and iat for the revocation check
+func (t *TokenManager) RevocationToken(claims gojwt.MapClaims) auth.RevocationToken {
+	token := auth.RevocationToken{Subject: t.Subject(claims)}
+	token.ID, _ = claims["jti"].(string)
+	if iat, err := claims.GetIssuedAt(); err == nil && iat != nil {
+		token.IssuedAt = iat.Time
+	}
+	return token
+}
+
+// ExpiresAt returns the "exp" claim
+func (t *TokenManager) ExpiresAt(claims gojwt.MapClaims) time.Time {
+	if exp, err := claims.GetExpirationTime(); err == nil && exp != nil {
+		return exp.Time
+	}
+	return time.Time{}
+}
+
+// Groups returns the groups claim as string slice
+func (t *TokenManager) Groups(claims gojwt.MapClaims) []string {
+	return claimToStrings(claims[t.GroupsClaim])
+}
+
+// Roles returns the roles claim as string slice
+func (t *TokenManager) Roles(claims gojwt.MapClaims) []string {
+	return claimToStrings(claims[t.RolesClaim])
+}
+
+// claimToStrings accepts an array claim or a space separated string claim (as used by "scope")
+func claimToStrings(value any) []string {
+	switch v := value.(type) {
+	case string:
+		return strings.Fields(v)
+	case []string:
+		return v
+	case []any:
+		result := make([]string, 0, len(v))
+		for _, item := range v {
+			if s, ok := item.(string); ok {
+				result = append(result, s)
+			}
+		}
+		return result
+	}
+
+	return []string{}
+}
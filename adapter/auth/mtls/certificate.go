@@ -0,0 +1,201 @@
+package mtls
+
+import (
+	"crypto/x509"
+	"encoding/base64"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+
+	"github.com/webcore-go/webcore/app/helper"
+)
+
+// Identities of a certificate that are matched with the user key or username
+const (
+	IdentitySubject     = "subject"     // common name of the subject
+	IdentityDN          = "dn"          // full subject, e.g. "CN=partner,O=Example Corp"
+	IdentitySAN         = "san"         // every DNS, e-mail and URI subject alternative name
+	IdentityFingerprint = "fingerprint" // SHA-256 of the certificate as lowercase hex
+)
+
+// Identities returns the values of the identity kind, empty when the
+// certificate has none
+func Identities(cert *x509.Certificate, kind string) []string {
+	switch kind {
+	case IdentitySubject:
+		if cert.Subject.CommonName != "" {
+			return []string{cert.Subject.CommonName}
+		}
+	case IdentityDN:
+		return []string{cert.Subject.String()}
+	case IdentitySAN:
+		identities := make([]string, 0, len(cert.DNSNames)+len(cert.EmailAddresses)+len(cert.URIs))
+		identities = append(identities, cert.DNSNames...)
+		identities = append(identities, cert.EmailAddresses...)
+		for _, uri := range cert.URIs {
+			identities = append(identities, uri.String())
+		}
+		return identities
+	case IdentityFingerprint:
+		return []string{helper.CertFingerprint(cert)}
+	}
+	return nil
+}
+
+// ParseForwardedCertificate reads the client certificate and its chain from
+// the header of a TLS terminating proxy. Accepted are the Envoy
+// X-Forwarded-Client-Cert format, URL encoded PEM (nginx
+// $ssl_client_escaped_cert), PEM with the line breaks replaced by spaces and
+// base64 DER.
+func ParseForwardedCertificate(value string) ([]*x509.Certificate, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return nil, fmt.Errorf("Forwarded certificate is empty")
+	}
+
+	if strings.Contains(value, "Cert=") || strings.Contains(value, "Chain=") {
+		var err error
+		if value, err = xfccCertificate(value); err != nil {
+			return nil, err
+		}
+	}
+
+	if strings.Contains(value, "%") {
+		// PathUnescape keeps "+" of the base64 body that some proxies do not escape
+		unescaped, err := url.PathUnescape(value)
+		if err != nil {
+			return nil, fmt.Errorf("Forwarded certificate is not URL encoded: %v", err)
+		}
+		value = unescaped
+	}
+
+	var ders [][]byte
+	if strings.Contains(value, "-----BEGIN CERTIFICATE-----") {
+		var err error
+		if ders, err = decodePEMChain(value); err != nil {
+			return nil, err
+		}
+	} else {
+		der, err := base64.StdEncoding.DecodeString(strings.Join(strings.Fields(value), ""))
+		if err != nil {
+			return nil, fmt.Errorf("Forwarded certificate is neither PEM nor base64 DER")
+		}
+		ders = [][]byte{der}
+	}
+
+	certs := make([]*x509.Certificate, 0, len(ders))
+	for _, der := range ders {
+		cert, err := x509.ParseCertificate(der)
+		if err != nil {
+			return nil, fmt.Errorf("Parse forwarded certificate: %v", err)
+		}
+		certs = append(certs, cert)
+	}
+	return certs, nil
+}
+
+// xfccCertificate returns Chain, or else Cert, of the first element of an
+// X-Forwarded-Client-Cert header. Proxies append one element per hop, so the
+// first element describes the client.
+func xfccCertificate(value string) (string, error) {
+	element := splitQuoted(value, ',')[0]
+
+	var cert, chain string
+	for _, pair := range splitQuoted(element, ';') {
+		key, val, found := strings.Cut(strings.TrimSpace(pair), "=")
+		if !found {
+			continue
+		}
+		val = strings.Trim(val, `"`)
+		switch key {
+		case "Cert":
+			cert = val
+		case "Chain":
+			chain = val
+		}
+	}
+
+	if chain != "" {
+		return chain, nil
+	}
+	if cert != "" {
+		return cert, nil
+	}
+	return "", fmt.Errorf("X-Forwarded-Client-Cert has no Cert or Chain")
+}
+
+// splitQuoted splits at sep outside of double quotes, e.g. a quoted Subject
+// with commas
+func splitQuoted(value string, sep byte) []string {
+	var parts []string
+	quoted := false
+	start := 0
+	for i := 0; i < len(value); i++ {
+		switch {
+		case value[i] == '"':
+			quoted = !quoted
+		case value[i] == sep && !quoted:
+			parts = append(parts, value[start:i])
+			start = i + 1
+		}
+	}
+	return append(parts, value[start:])
+}
+
+// decodePEMChain decodes the certificates of a PEM text. Proxies that cannot
+// send line breaks replace them with spaces, so white space inside the
+// base64 body is ignored.
+func decodePEMChain(value string) ([][]byte, error) {
+	const begin = "-----BEGIN CERTIFICATE-----"
+	const end = "-----END CERTIFICATE-----"
+
+	var ders [][]byte
+	for {
+		start := strings.Index(value, begin)
+		if start < 0 {
+			break
+		}
+		value = value[start+len(begin):]
+
+		stop := strings.Index(value, end)
+		if stop < 0 {
+			return nil, fmt.Errorf("Forwarded certificate has no END line")
+		}
+
+		der, err := base64.StdEncoding.DecodeString(strings.Join(strings.Fields(value[:stop]), ""))
+		if err != nil {
+			return nil, fmt.Errorf("Forwarded certificate has an invalid PEM body")
+		}
+		ders = append(ders, der)
+		value = value[stop+len(end):]
+	}
+	return ders, nil
+}
+
+// ParseTrustedProxies parses IPs and CIDRs, a plain IP matches only itself
+func ParseTrustedProxies(values []string) ([]*net.IPNet, error) {
+	networks := make([]*net.IPNet, 0, len(values))
+	for _, value := range values {
+		if !strings.Contains(value, "/") {
+			ip := net.ParseIP(value)
+			if ip == nil {
+				return nil, fmt.Errorf("Invalid auth.mtls.trusted_proxies entry %s", value)
+			}
+			bits := 8 * net.IPv6len
+			if ip.To4() != nil {
+				ip = ip.To4()
+				bits = 8 * net.IPv4len
+			}
+			networks = append(networks, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+
+		_, network, err := net.ParseCIDR(value)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid auth.mtls.trusted_proxies entry %s", value)
+		}
+		networks = append(networks, network)
+	}
+	return networks, nil
+}
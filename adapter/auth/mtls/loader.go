@@ -0,0 +1,251 @@
+package mtls
+
+import (
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"slices"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/webcore-go/webcore/adapter/auth/authn"
+	"github.com/webcore-go/webcore/app/core"
+	"github.com/webcore-go/webcore/app/helper"
+	"github.com/webcore-go/webcore/infra/config"
+	"github.com/webcore-go/webcore/infra/logger"
+	"github.com/webcore-go/webcore/port"
+	"github.com/webcore-go/webcore/port/auth"
+)
+
+// keys in fiber.Ctx locals with the verified certificate and its identities
+const (
+	certificateLocal = "mtls_certificate"
+	identitiesLocal  = "mtls_identities"
+)
+
+type MtlsLoader struct {
+	name string
+}
+
+func (a *MtlsLoader) SetName(name string) {
+	a.name = name
+}
+
+func (a *MtlsLoader) Name() string {
+	return a.name
+}
+
+func (l *MtlsLoader) Init(args ...any) (port.Library, error) {
+	context := args[0].(*core.AppContext)
+	config := args[1].(config.AuthConfig)
+
+	caFile := config.MTLS.CAFile
+	if caFile == "" {
+		caFile = context.Config.Server.TLS.ClientCA
+	}
+	if caFile == "" {
+		return nil, fmt.Errorf("auth.mtls.ca_file or server.tls.client_ca is required")
+	}
+
+	roots, err := helper.LoadCertPool(caFile)
+	if err != nil {
+		return nil, err
+	}
+
+	validator, err := NewMtlsValidator(config.MTLS, roots)
+	if err != nil {
+		return nil, err
+	}
+	validator.Revocation = context.Revocation
+
+	if validator.ProxyHeader == "" && !context.Config.Server.TLS.Enabled {
+		logger.Warn("mtls authentication needs server.tls.enabled or auth.mtls.proxy_header, no request carries a certificate")
+	}
+
+	authn := &authn.AuthN{}
+	authn.SetValidator(validator)
+	err = authn.Install(args...)
+	if err != nil {
+		return nil, err
+	}
+
+	return authn, nil
+}
+
+// MtlsValidator authenticates requests by a client certificate of the TLS
+// connection, or forwarded by a trusted TLS terminating proxy. The
+// certificate is mapped onto a user of the auth store, so the resources of
+// the store apply as for every other scheme.
+type MtlsValidator struct {
+	Roots          *x509.CertPool // CAs of the client certificates
+	Identity       string         // IdentitySubject, IdentityDN, IdentitySAN or IdentityFingerprint
+	ProxyHeader    string
+	TrustedProxies []*net.IPNet
+	Revocation     *auth.Revocation // rejects revoked certificates (by fingerprint) and subjects, nil when auth.revocation.enabled is false
+}
+
+func NewMtlsValidator(config config.MTLSConfig, roots *x509.CertPool) (*MtlsValidator, error) {
+	switch config.Identity {
+	case IdentitySubject, IdentityDN, IdentitySAN, IdentityFingerprint:
+	default:
+		return nil, fmt.Errorf("Unknown auth.mtls.identity %s, use subject, dn, san or fingerprint", config.Identity)
+	}
+
+	proxies, err := ParseTrustedProxies(config.TrustedProxies)
+	if err != nil {
+		return nil, err
+	}
+	if config.ProxyHeader != "" && len(proxies) == 0 {
+		return nil, fmt.Errorf("auth.mtls.proxy_header requires auth.mtls.trusted_proxies")
+	}
+
+	return &MtlsValidator{
+		Roots:          roots,
+		Identity:       config.Identity,
+		ProxyHeader:    config.ProxyHeader,
+		TrustedProxies: proxies,
+	}, nil
+}
+
+func (a *MtlsValidator) Name() string {
+	return "mtls"
+}
+
+func (a *MtlsValidator) ValidateKey(ctx *fiber.Ctx) (string, error) {
+	chain, err := a.certificates(ctx)
+	if err != nil {
+		return "", err
+	}
+	if len(chain) == 0 {
+		return "", auth.ErrCredentialsMissing.Withf("Client certificate required")
+	}
+
+	cert := chain[0]
+	intermediates := x509.NewCertPool()
+	for _, intermediate := range chain[1:] {
+		intermediates.AddCert(intermediate)
+	}
+
+	// verified here as well, the listener may only request certificates and a proxy may forward any
+	_, err = cert.Verify(x509.VerifyOptions{
+		Roots:         a.Roots,
+		Intermediates: intermediates,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	})
+	if err != nil {
+		var invalid x509.CertificateInvalidError
+		if errors.As(err, &invalid) && invalid.Reason == x509.Expired {
+			return "", auth.ErrCredentialsExpired.With(err)
+		}
+		return "", auth.ErrCredentialsInvalid.With(err)
+	}
+
+	identities := Identities(cert, a.Identity)
+	if len(identities) == 0 {
+		return "", auth.ErrCredentialsInvalid.Withf("Client certificate has no %s", a.Identity)
+	}
+
+	ctx.Locals(certificateLocal, cert)
+	ctx.Locals(identitiesLocal, identities)
+	return identities[0], nil
+}
+
+// certificates returns the client certificate and its chain, from the header
+// of a trusted proxy or else from the TLS connection
+func (a *MtlsValidator) certificates(ctx *fiber.Ctx) ([]*x509.Certificate, error) {
+	if a.fromTrustedProxy(ctx) {
+		if value := ctx.Get(a.ProxyHeader); value != "" {
+			chain, err := ParseForwardedCertificate(value)
+			if err != nil {
+				return nil, auth.ErrCredentialsMalformed.With(err)
+			}
+			return chain, nil
+		}
+	}
+
+	state := ctx.Context().TLSConnectionState()
+	if state == nil {
+		return nil, nil
+	}
+	return state.PeerCertificates, nil
+}
+
+// fromTrustedProxy checks the address of the connection, not c.IP(), which
+// may be taken from a header the client controls
+func (a *MtlsValidator) fromTrustedProxy(ctx *fiber.Ctx) bool {
+	if a.ProxyHeader == "" {
+		return false
+	}
+
+	ip := ctx.Context().RemoteIP()
+	return slices.ContainsFunc(a.TrustedProxies, func(network *net.IPNet) bool {
+		return network.Contains(ip)
+	})
+}
+
+func (a *MtlsValidator) HasCredential(ctx *fiber.Ctx) bool {
+	if a.fromTrustedProxy(ctx) && ctx.Get(a.ProxyHeader) != "" {
+		return true
+	}
+
+	state := ctx.Context().TLSConnectionState()
+	return state != nil && len(state.PeerCertificates) > 0
+}
+
+// ExtendPrincipal names the certificate by its fingerprint
+func (a *MtlsValidator) ExtendPrincipal(ctx *fiber.Ctx, principal *auth.Principal) {
+	if cert := GetCertificate(ctx); cert != nil {
+		principal.CredentialId = helper.CertFingerprint(cert)[:16]
+	}
+}
+
+// VerifyUser matches the identities of the certificate with the user and
+// checks the revocations once the user, and with it the subject, is known
+func (a *MtlsValidator) VerifyUser(ctx *fiber.Ctx, userKey string, userInfo auth.IUserAuthInfo) (bool, error) {
+	identities, _ := ctx.Locals(identitiesLocal).([]string)
+
+	var matched bool
+	switch user := userInfo.(type) {
+	case *auth.UserAuthInfoRBAC:
+		matched = slices.ContainsFunc(identities, func(identity string) bool {
+			return user.UserId == identity || (user.Username != nil && *user.Username == identity)
+		})
+	case *auth.UserAuthInfoABAC:
+		matched = slices.ContainsFunc(identities, func(identity string) bool {
+			return user.UserId == identity || (user.Username != nil && *user.Username == identity)
+		})
+	}
+	if !matched {
+		return false, nil
+	}
+
+	cert := GetCertificate(ctx)
+	if a.Revocation != nil && cert != nil {
+		token := auth.RevocationToken{ID: helper.CertFingerprint(cert), Subject: auth.UserSubject(userInfo), IssuedAt: cert.NotBefore}
+		if err := a.Revocation.Check(ctx.UserContext(), token); err != nil {
+			return true, err
+		}
+	}
+	return true, nil
+}
+
+// UserLookups asks the store for every identity of the certificate, e.g. each
+// subject alternative name
+func (a *MtlsValidator) UserLookups(ctx *fiber.Ctx, userKey string) []auth.UserLookup {
+	identities, _ := ctx.Locals(identitiesLocal).([]string)
+
+	lookups := make([]auth.UserLookup, 0, 2*len(identities))
+	for _, identity := range identities {
+		lookups = append(lookups, auth.UserLookup{Field: "key", Value: identity}, auth.UserLookup{Field: "user", Value: identity})
+	}
+	return lookups
+}
+
+// GetCertificate returns the verified client certificate of the current request
+func GetCertificate(ctx *fiber.Ctx) *x509.Certificate {
+	cert, ok := ctx.Locals(certificateLocal).(*x509.Certificate)
+	if !ok {
+		return nil
+	}
+	return cert
+}
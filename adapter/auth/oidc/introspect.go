@@ -0,0 +1,132 @@
+package oidc
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	gojwt "github.com/golang-jwt/jwt/v5"
+)
+
+// results kept by the introspection cache, expired results are dropped when it is full
+const maxCachedIntrospections = 10000
+
+// Introspector asks the identity provider whether an opaque token is active
+// (RFC 7662). The response is used as the claims of the token.
+type Introspector struct {
+	URL          func(ctx context.Context) (string, error)
+	ClientID     string
+	ClientSecret string
+	Client       *http.Client
+	CacheTTL     time.Duration // 0 asks the provider on every request
+
+	mu    sync.Mutex
+	cache map[string]introspection
+}
+
+type introspection struct {
+	claims    gojwt.MapClaims // nil for inactive tokens
+	expiresAt time.Time
+}
+
+func NewIntrospector(url func(ctx context.Context) (string, error), clientID string, clientSecret string, client *http.Client) *Introspector {
+	return &Introspector{
+		URL:          url,
+		ClientID:     clientID,
+		ClientSecret: clientSecret,
+		Client:       client,
+		cache:        make(map[string]introspection),
+	}
+}
+
+// Introspect returns the claims of an active token, nil for an inactive one
+func (i *Introspector) Introspect(ctx context.Context, token string) (gojwt.MapClaims, error) {
+	sum := sha256.Sum256([]byte(token))
+	key := hex.EncodeToString(sum[:])
+
+	if claims, ok := i.cached(key); ok {
+		return claims, nil
+	}
+
+	endpoint, err := i.URL(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if endpoint == "" {
+		return nil, fmt.Errorf("Identity provider has no introspection endpoint, set auth.oidc.introspection_url")
+	}
+
+	form := url.Values{"token": {token}, "token_type_hint": {"access_token"}}
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	request.Header.Set("Accept", "application/json")
+	if i.ClientID != "" {
+		// client_secret_basic encodes the credentials before the Basic scheme (RFC 6749 2.3.1)
+		request.SetBasicAuth(url.QueryEscape(i.ClientID), url.QueryEscape(i.ClientSecret))
+	}
+
+	claims := gojwt.MapClaims{}
+	if err := doJSON(i.Client, request, &claims); err != nil {
+		return nil, fmt.Errorf("Introspect token: %v", err)
+	}
+
+	if active, _ := claims["active"].(bool); !active {
+		claims = nil
+	}
+	i.store(key, claims)
+	return claims, nil
+}
+
+func (i *Introspector) cached(key string) (gojwt.MapClaims, bool) {
+	if i.CacheTTL <= 0 {
+		return nil, false
+	}
+
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	result, ok := i.cache[key]
+	if !ok || time.Now().After(result.expiresAt) {
+		return nil, false
+	}
+	return result.claims, true
+}
+
+// store keeps the result for CacheTTL, an active token not longer than it lives
+func (i *Introspector) store(key string, claims gojwt.MapClaims) {
+	if i.CacheTTL <= 0 {
+		return
+	}
+
+	now := time.Now()
+	expiresAt := now.Add(i.CacheTTL)
+	if claims != nil {
+		if exp, err := claims.GetExpirationTime(); err == nil && exp != nil && exp.Before(expiresAt) {
+			expiresAt = exp.Time
+		}
+	}
+
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	if len(i.cache) >= maxCachedIntrospections {
+		for cachedKey, result := range i.cache {
+			if now.After(result.expiresAt) {
+				delete(i.cache, cachedKey)
+			}
+		}
+		if len(i.cache) >= maxCachedIntrospections {
+			return
+		}
+	}
+	i.cache[key] = introspection{claims: claims, expiresAt: expiresAt}
+}
@@ -0,0 +1,213 @@
+package oidc
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"fmt"
+	"math/big"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/webcore-go/webcore/infra/logger"
+)
+
+// JSONWebKey is a public key of a JWK set (RFC 7517)
+type JSONWebKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	N   string `json:"n"`   // RSA modulus
+	E   string `json:"e"`   // RSA exponent
+	Crv string `json:"crv"` // EC or OKP curve
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+type jsonWebKeySet struct {
+	Keys []JSONWebKey `json:"keys"`
+}
+
+// KeySet caches the signing keys of the identity provider by key id. The keys
+// are fetched again after TTL, and earlier when a token names an unknown key
+// id because the provider rotated its keys. MinRefresh limits the fetches, so
+// tokens with made up key ids cannot flood the provider.
+type KeySet struct {
+	URL        func(ctx context.Context) (string, error)
+	Client     *http.Client
+	TTL        time.Duration
+	MinRefresh time.Duration
+
+	mu        sync.RWMutex
+	keys      map[string]any
+	fetchedAt time.Time
+
+	refreshMu   sync.Mutex
+	lastAttempt time.Time
+	lastErr     error
+}
+
+func NewKeySet(url func(ctx context.Context) (string, error), client *http.Client) *KeySet {
+	return &KeySet{
+		URL:    url,
+		Client: client,
+	}
+}
+
+// Key returns the public key of the key id. A token without key id is
+// accepted when the set has exactly one key.
+func (k *KeySet) Key(ctx context.Context, kid string) (any, error) {
+	key, stale := k.lookup(kid)
+	if key != nil && !stale {
+		return key, nil
+	}
+
+	if err := k.refresh(ctx); err != nil {
+		if key != nil {
+			// known keys stay valid while the provider is unreachable
+			logger.Warn("Refresh OIDC signing keys failed, using cached keys", "error", err)
+			return key, nil
+		}
+		return nil, err
+	}
+
+	key, _ = k.lookup(kid)
+	if key == nil {
+		return nil, fmt.Errorf("Unknown signing key %q", kid)
+	}
+	return key, nil
+}
+
+func (k *KeySet) lookup(kid string) (any, bool) {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+
+	stale := k.TTL > 0 && time.Since(k.fetchedAt) > k.TTL
+	if kid == "" && len(k.keys) == 1 {
+		for _, key := range k.keys {
+			return key, stale
+		}
+	}
+	return k.keys[kid], stale
+}
+
+// refresh fetches the key set unless it was fetched within MinRefresh, then the
+// result of that fetch is returned
+func (k *KeySet) refresh(ctx context.Context) error {
+	k.refreshMu.Lock()
+	defer k.refreshMu.Unlock()
+
+	if !k.lastAttempt.IsZero() && time.Since(k.lastAttempt) < k.MinRefresh {
+		return k.lastErr
+	}
+	k.lastAttempt = time.Now()
+
+	keys, err := k.fetch(ctx)
+	k.lastErr = err
+	if err != nil {
+		return err
+	}
+
+	k.mu.Lock()
+	k.keys = keys
+	k.fetchedAt = time.Now()
+	k.mu.Unlock()
+
+	logger.Debug("OIDC signing keys refreshed", "keys", len(keys))
+	return nil
+}
+
+func (k *KeySet) fetch(ctx context.Context) (map[string]any, error) {
+	url, err := k.URL(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var set jsonWebKeySet
+	if err := getJSON(ctx, k.Client, url, &set); err != nil {
+		return nil, fmt.Errorf("Read OIDC signing keys: %v", err)
+	}
+
+	keys := make(map[string]any, len(set.Keys))
+	for _, jwk := range set.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+
+		key, err := jwk.PublicKey()
+		if err != nil {
+			// one key of an unsupported type must not disable the others
+			logger.Warn("Skip OIDC signing key", "kid", jwk.Kid, "error", err)
+			continue
+		}
+		keys[jwk.Kid] = key
+	}
+
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("OIDC key set %s has no usable signing key", url)
+	}
+	return keys, nil
+}
+
+// PublicKey converts the JWK to *rsa.PublicKey, *ecdsa.PublicKey or ed25519.PublicKey
+func (j JSONWebKey) PublicKey() (any, error) {
+	switch j.Kty {
+	case "RSA":
+		n, err := decodeBigInt(j.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decodeBigInt(j.E)
+		if err != nil {
+			return nil, err
+		}
+		if !e.IsInt64() || e.Int64() > 1<<31-1 {
+			return nil, fmt.Errorf("RSA exponent is too large")
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch j.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("Unsupported EC curve %s", j.Crv)
+		}
+		x, err := decodeBigInt(j.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decodeBigInt(j.Y)
+		if err != nil {
+			return nil, err
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+	case "OKP":
+		if j.Crv != "Ed25519" {
+			return nil, fmt.Errorf("Unsupported OKP curve %s", j.Crv)
+		}
+		x, err := base64.RawURLEncoding.DecodeString(j.X)
+		if err != nil || len(x) != ed25519.PublicKeySize {
+			return nil, fmt.Errorf("Invalid Ed25519 key")
+		}
+		return ed25519.PublicKey(x), nil
+	}
+	return nil, fmt.Errorf("Unsupported key type %s", j.Kty)
+}
+
+func decodeBigInt(value string) (*big.Int, error) {
+	data, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil || len(data) == 0 {
+		return nil, fmt.Errorf("Invalid key parameter")
+	}
+	return new(big.Int).SetBytes(data), nil
+}
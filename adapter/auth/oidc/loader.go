@@ -0,0 +1,204 @@
+package oidc
+
+import (
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	gojwt "github.com/golang-jwt/jwt/v5"
+	"github.com/webcore-go/webcore/adapter/auth/authn"
+	"github.com/webcore-go/webcore/app/core"
+	"github.com/webcore-go/webcore/infra/config"
+	"github.com/webcore-go/webcore/infra/logger"
+	"github.com/webcore-go/webcore/port"
+	"github.com/webcore-go/webcore/port/auth"
+)
+
+// keys in fiber.Ctx locals with the verified claims and scopes of the current request
+const (
+	claimsLocal = "oidc_claims"
+	scopesLocal = "oidc_scopes"
+)
+
+type OidcLoader struct {
+	name string
+}
+
+func (a *OidcLoader) SetName(name string) {
+	a.name = name
+}
+
+func (a *OidcLoader) Name() string {
+	return a.name
+}
+
+func (a *OidcLoader) Init(args ...any) (port.Library, error) {
+	context := args[0].(*core.AppContext)
+	config := args[1].(config.AuthConfig)
+
+	verifier, err := NewTokenVerifier(config.OIDC)
+	if err != nil {
+		return nil, err
+	}
+
+	authn := &authn.AuthN{}
+	validator := NewOidcValidator(config, verifier)
+	validator.Revocation = context.Revocation
+	authn.SetValidator(validator)
+	err = authn.Install(args...)
+	if err != nil {
+		return nil, err
+	}
+
+	// an unreachable provider is reported at start, tokens are accepted once it answers
+	if config.OIDC.JWKSURL == "" || (config.OIDC.IntrospectionURL == "" && config.OIDC.Introspection != IntrospectNever) {
+		if _, err := verifier.Provider.Metadata(context.Context); err != nil {
+			logger.Warn("OIDC provider is not reachable", "issuer", config.OIDC.Issuer, "error", err)
+		}
+	}
+
+	return authn, nil
+}
+
+// OidcValidator authenticates bearer access tokens of an OpenID Connect or
+// OAuth2 identity provider
+type OidcValidator struct {
+	Control    string
+	Realm      string
+	Verifier   *TokenVerifier
+	LookupUser bool             // the user is loaded from the store by subject instead of built from the claims
+	Revocation *auth.Revocation // rejects revoked tokens, nil when auth.revocation.enabled is false
+}
+
+func NewOidcValidator(config config.AuthConfig, verifier *TokenVerifier) *OidcValidator {
+	return &OidcValidator{
+		Control:    config.Control,
+		Realm:      config.Realm,
+		Verifier:   verifier,
+		LookupUser: config.OIDC.LookupUser,
+	}
+}
+
+func (a *OidcValidator) Name() string {
+	return "oidc"
+}
+
+func (a *OidcValidator) ValidateKey(ctx *fiber.Ctx) (string, error) {
+	authHeader := ctx.Get("Authorization")
+	if authHeader == "" {
+		return "", auth.ErrCredentialsMissing.Withf("Authorization header required")
+	}
+
+	// konten dimulai dengan prefiks "Bearer "
+	if !strings.HasPrefix(authHeader, "Bearer ") {
+		return "", auth.ErrCredentialsMalformed.Withf("Required prefix in Authorization header is missing")
+	}
+	token := strings.TrimPrefix(authHeader, "Bearer ")
+
+	claims, err := a.Verifier.Verify(ctx.UserContext(), token)
+	if err != nil {
+		return "", err
+	}
+
+	if a.Revocation != nil {
+		if err := a.Revocation.Check(ctx.UserContext(), a.Verifier.RevocationToken(claims)); err != nil {
+			return "", err
+		}
+	}
+
+	ctx.Locals(claimsLocal, claims)
+	ctx.Locals(scopesLocal, a.Verifier.Claims.Scopes(claims))
+	return a.Verifier.Claims.Subject(claims), nil
+}
+
+func (a *OidcValidator) HasCredential(ctx *fiber.Ctx) bool {
+	return strings.HasPrefix(ctx.Get("Authorization"), "Bearer ")
+}
+
+// ResolveUser builds the user from the claims of the token, an ABAC user
+// carries the attribute claims and is authorized by the resource policies.
+// With auth.oidc.lookup_user the store is asked instead, e.g. for users with
+// own ABAC policies.
+func (a *OidcValidator) ResolveUser(ctx *fiber.Ctx) (auth.IUserAuthInfo, error) {
+	if a.LookupUser {
+		return nil, nil
+	}
+
+	claims := GetClaims(ctx)
+	if claims == nil {
+		return nil, auth.ErrCredentialsInvalid
+	}
+
+	mapping := a.Verifier.Claims
+	var username *string
+	if name := mapping.Username(claims); name != "" {
+		username = &name
+	}
+
+	if a.Control == "ABAC" {
+		return &auth.UserAuthInfoABAC{
+			UserId:     mapping.Subject(claims),
+			Username:   username,
+			Groups:     mapping.Groups(claims),
+			Attributes: mapping.Attributes(claims),
+		}, nil
+	}
+
+	return &auth.UserAuthInfoRBAC{
+		UserId:   mapping.Subject(claims),
+		Username: username,
+		Groups:   mapping.Groups(claims),
+		Roles:    mapping.Roles(claims),
+	}, nil
+}
+
+// ExtendPrincipal names the token by its id, or the client of tokens without id
+func (a *OidcValidator) ExtendPrincipal(ctx *fiber.Ctx, principal *auth.Principal) {
+	claims := GetClaims(ctx)
+	if claims == nil {
+		return
+	}
+
+	if jti, _ := claims["jti"].(string); jti != "" {
+		principal.CredentialId = jti
+	} else if clientId, _ := ClaimValue(claims, "client_id").(string); clientId != "" {
+		principal.CredentialId = clientId
+	}
+}
+
+func (a *OidcValidator) Challenge(err *auth.AuthError) string {
+	return auth.BearerChallenge("Bearer", a.Realm, err)
+}
+
+func (a *OidcValidator) VerifyUser(ctx *fiber.Ctx, userKey string, userInfo auth.IUserAuthInfo) (bool, error) {
+	if userKey == "" {
+		return false, nil
+	}
+
+	switch user := userInfo.(type) {
+	case *auth.UserAuthInfoRBAC:
+		return user.UserId == userKey || (user.Username != nil && *user.Username == userKey), nil
+	case *auth.UserAuthInfoABAC:
+		return user.UserId == userKey || (user.Username != nil && *user.Username == userKey), nil
+	}
+	return false, nil
+}
+
+func (a *OidcValidator) UserLookups(ctx *fiber.Ctx, userKey string) []auth.UserLookup {
+	return []auth.UserLookup{{Field: "key", Value: userKey}, {Field: "user", Value: userKey}}
+}
+
+// GetClaims returns the verified claims of the current request, the
+// introspection response for opaque tokens
+func GetClaims(ctx *fiber.Ctx) gojwt.MapClaims {
+	claims, ok := ctx.Locals(claimsLocal).(gojwt.MapClaims)
+	if !ok {
+		return nil
+	}
+	return claims
+}
+
+// Scopes returns the scopes of the token of the current request
+func Scopes(ctx *fiber.Ctx) []string {
+	scopes, _ := ctx.Locals(scopesLocal).([]string)
+	return scopes
+}
@@ -0,0 +1,109 @@
+package oidc
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/webcore-go/webcore/app/helper"
+)
+
+// responses of the identity provider larger than this are rejected
+const maxResponseSize = 1 << 20
+
+// Metadata is the part of the discovery document used by the adapter
+type Metadata struct {
+	Issuer                string `json:"issuer"`
+	JWKSURI               string `json:"jwks_uri"`
+	IntrospectionEndpoint string `json:"introspection_endpoint"`
+}
+
+// Provider reads the discovery document of the issuer. The document is read
+// on first use and again after a failure, so the application starts while the
+// identity provider is unreachable.
+type Provider struct {
+	Issuer       string
+	DiscoveryURL string
+	Client       *http.Client
+	RetryAfter   time.Duration // minimum time between attempts after a failure
+
+	mu          sync.Mutex
+	metadata    *Metadata
+	lastAttempt time.Time
+	lastErr     error
+}
+
+func NewProvider(issuer string, discoveryURL string, client *http.Client) *Provider {
+	if discoveryURL == "" {
+		discoveryURL = strings.TrimSuffix(issuer, "/") + "/.well-known/openid-configuration"
+	}
+
+	return &Provider{
+		Issuer:       issuer,
+		DiscoveryURL: discoveryURL,
+		Client:       client,
+	}
+}
+
+// Metadata returns the discovery document
+func (p *Provider) Metadata(ctx context.Context) (*Metadata, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.metadata != nil {
+		return p.metadata, nil
+	}
+	if p.lastErr != nil && time.Since(p.lastAttempt) < p.RetryAfter {
+		return nil, p.lastErr
+	}
+
+	p.lastAttempt = time.Now()
+	metadata := &Metadata{}
+	if err := getJSON(ctx, p.Client, p.DiscoveryURL, metadata); err != nil {
+		p.lastErr = fmt.Errorf("Read OIDC discovery document: %v", err)
+		return nil, p.lastErr
+	}
+
+	// the document of another issuer must not provide the keys (OpenID Connect Discovery 4.3)
+	if metadata.Issuer != p.Issuer {
+		p.lastErr = fmt.Errorf("OIDC discovery document of issuer %s does not match %s", metadata.Issuer, p.Issuer)
+		return nil, p.lastErr
+	}
+
+	p.metadata = metadata
+	p.lastErr = nil
+	return metadata, nil
+}
+
+// getJSON reads a JSON document of the identity provider
+func getJSON(ctx context.Context, client *http.Client, url string, value any) error {
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Accept", "application/json")
+
+	return doJSON(client, request, value)
+}
+
+func doJSON(client *http.Client, request *http.Request, value any) error {
+	response, err := client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	data, err := io.ReadAll(io.LimitReader(response.Body, maxResponseSize))
+	if err != nil {
+		return err
+	}
+	if response.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s %s returned status %d", request.Method, request.URL.Redacted(), response.StatusCode)
+	}
+
+	return helper.JSONUnmarshal(data, value)
+}
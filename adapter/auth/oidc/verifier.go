@@ -0,0 +1,312 @@
+package oidc
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	gojwt "github.com/golang-jwt/jwt/v5"
+	"github.com/webcore-go/webcore/infra/config"
+	"github.com/webcore-go/webcore/port/auth"
+)
+
+// Modes of auth.oidc.introspection
+const (
+	IntrospectAuto   = "auto"   // JWT access tokens are verified locally, opaque tokens are introspected
+	IntrospectAlways = "always" // every token is introspected, e.g. to notice tokens revoked at the provider
+	IntrospectNever  = "never"  // only JWT access tokens are accepted
+)
+
+// TokenVerifier verifies the access tokens of the identity provider, JWTs by
+// the keys of the provider and opaque tokens by introspection
+type TokenVerifier struct {
+	Provider       *Provider
+	Keys           *KeySet
+	Introspector   *Introspector
+	Introspection  string
+	Issuer         string
+	Audience       []string
+	Algorithms     []string
+	RequiredScopes []string
+	Leeway         time.Duration
+	Claims         ClaimMapping
+}
+
+func NewTokenVerifier(config config.OIDCConfig) (*TokenVerifier, error) {
+	if config.Issuer == "" {
+		return nil, fmt.Errorf("auth.oidc.issuer is required")
+	}
+
+	switch config.Introspection {
+	case IntrospectAuto, IntrospectAlways, IntrospectNever:
+	default:
+		return nil, fmt.Errorf("Unknown auth.oidc.introspection %s, use auto, always or never", config.Introspection)
+	}
+
+	for _, algorithm := range config.Algorithms {
+		// the keys of the provider are public, a shared secret or no signature is never acceptable
+		if strings.HasPrefix(strings.ToUpper(algorithm), "HS") || strings.EqualFold(algorithm, "none") {
+			return nil, fmt.Errorf("auth.oidc.algorithms must not contain %s", algorithm)
+		}
+	}
+
+	client := &http.Client{Timeout: config.HTTPTimeout}
+	provider := NewProvider(config.Issuer, config.DiscoveryURL, client)
+	provider.RetryAfter = config.JWKSMinRefresh
+
+	keys := NewKeySet(func(ctx context.Context) (string, error) {
+		if config.JWKSURL != "" {
+			return config.JWKSURL, nil
+		}
+		metadata, err := provider.Metadata(ctx)
+		if err != nil {
+			return "", err
+		}
+		if metadata.JWKSURI == "" {
+			return "", fmt.Errorf("OIDC discovery document has no jwks_uri")
+		}
+		return metadata.JWKSURI, nil
+	}, client)
+	keys.TTL = config.JWKSCacheTTL
+	keys.MinRefresh = config.JWKSMinRefresh
+
+	introspector := NewIntrospector(func(ctx context.Context) (string, error) {
+		if config.IntrospectionURL != "" {
+			return config.IntrospectionURL, nil
+		}
+		metadata, err := provider.Metadata(ctx)
+		if err != nil {
+			return "", err
+		}
+		return metadata.IntrospectionEndpoint, nil
+	}, config.ClientID, config.ClientSecret, client)
+	introspector.CacheTTL = config.IntrospectionCacheTTL
+
+	return &TokenVerifier{
+		Provider:       provider,
+		Keys:           keys,
+		Introspector:   introspector,
+		Introspection:  config.Introspection,
+		Issuer:         config.Issuer,
+		Audience:       config.Audience,
+		Algorithms:     config.Algorithms,
+		RequiredScopes: config.RequiredScopes,
+		Leeway:         config.Leeway,
+		Claims:         NewClaimMapping(config),
+	}, nil
+}
+
+// Verify checks an access token and returns its claims
+func (v *TokenVerifier) Verify(ctx context.Context, token string) (gojwt.MapClaims, error) {
+	var claims gojwt.MapClaims
+	var err error
+	if v.Introspection == IntrospectAlways || (v.Introspection == IntrospectAuto && !isJWT(token)) {
+		claims, err = v.introspect(ctx, token)
+	} else {
+		claims, err = v.parse(ctx, token)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if v.Claims.Subject(claims) == "" {
+		return nil, auth.ErrCredentialsInvalid.Withf("Token has no %s claim", v.Claims.SubjectClaim)
+	}
+
+	scopes := v.Claims.Scopes(claims)
+	for _, scope := range v.RequiredScopes {
+		if !slices.Contains(scopes, scope) {
+			return nil, auth.ErrInsufficientScope.WithScope(strings.Join(v.RequiredScopes, " "))
+		}
+	}
+
+	return claims, nil
+}
+
+// parse verifies signature, exp, nbf, iss and aud of a JWT access token
+func (v *TokenVerifier) parse(ctx context.Context, token string) (gojwt.MapClaims, error) {
+	options := []gojwt.ParserOption{
+		gojwt.WithValidMethods(v.Algorithms),
+		gojwt.WithLeeway(v.Leeway),
+		gojwt.WithExpirationRequired(),
+		gojwt.WithIssuedAt(),
+		gojwt.WithIssuer(v.Issuer),
+	}
+	if len(v.Audience) > 0 {
+		options = append(options, gojwt.WithAudience(v.Audience...))
+	}
+
+	claims := gojwt.MapClaims{}
+	_, err := gojwt.ParseWithClaims(token, claims, func(t *gojwt.Token) (any, error) {
+		kid, _ := t.Header["kid"].(string)
+		return v.Keys.Key(ctx, kid)
+	}, options...)
+	if err != nil {
+		return nil, tokenError(err)
+	}
+
+	return claims, nil
+}
+
+// introspect asks the provider and checks the response like the claims of a JWT
+func (v *TokenVerifier) introspect(ctx context.Context, token string) (gojwt.MapClaims, error) {
+	claims, err := v.Introspector.Introspect(ctx, token)
+	if err != nil {
+		return nil, auth.ErrCredentialsInvalid.With(err)
+	}
+	if claims == nil {
+		return nil, auth.ErrCredentialsInvalid.Withf("Token is not active")
+	}
+
+	if exp, err := claims.GetExpirationTime(); err == nil && exp != nil && time.Now().After(exp.Add(v.Leeway)) {
+		return nil, auth.ErrCredentialsExpired.Withf("Token is expired")
+	}
+	if iss, _ := claims.GetIssuer(); iss != "" && iss != v.Issuer {
+		return nil, auth.ErrCredentialsInvalid.Withf("Token issuer %s is not accepted", iss)
+	}
+	if len(v.Audience) > 0 {
+		audience, _ := claims.GetAudience()
+		if !slices.ContainsFunc(audience, func(aud string) bool { return slices.Contains(v.Audience, aud) }) {
+			return nil, auth.ErrCredentialsInvalid.Withf("Token audience %v is not accepted", audience)
+		}
+	}
+
+	return claims, nil
+}
+
+// RevocationToken returns jti, subject and iat for the revocation check
+func (v *TokenVerifier) RevocationToken(claims gojwt.MapClaims) auth.RevocationToken {
+	token := auth.RevocationToken{Subject: v.Claims.Subject(claims)}
+	token.ID, _ = claims["jti"].(string)
+	if iat, err := claims.GetIssuedAt(); err == nil && iat != nil {
+		token.IssuedAt = iat.Time
+	}
+	return token
+}
+
+// isJWT tells a JWT from an opaque token by its JSON header
+func isJWT(token string) bool {
+	header, _, found := strings.Cut(token, ".")
+	if !found || strings.Count(token, ".") != 2 {
+		return false
+	}
+	data, err := base64.RawURLEncoding.DecodeString(header)
+	return err == nil && len(data) > 0 && data[0] == '{'
+}
+
+// tokenError maps a failed Parse to the error of the response
+func tokenError(err error) *auth.AuthError {
+	switch {
+	case errors.Is(err, gojwt.ErrTokenExpired):
+		return auth.ErrCredentialsExpired.With(err)
+	case errors.Is(err, gojwt.ErrTokenMalformed):
+		return auth.ErrCredentialsMalformed.With(err)
+	}
+	return auth.ErrCredentialsInvalid.With(err)
+}
+
+// ClaimMapping reads the user of a token from configurable claim paths.
+// Nested claims are separated by dots, e.g. "realm_access.roles".
+type ClaimMapping struct {
+	SubjectClaim    string
+	UsernameClaim   string
+	GroupsClaim     string
+	RolesClaim      string
+	ScopeClaim      string
+	AttributeClaims map[string]string // ABAC attribute name to claim path
+}
+
+func NewClaimMapping(config config.OIDCConfig) ClaimMapping {
+	return ClaimMapping{
+		SubjectClaim:    config.SubjectClaim,
+		UsernameClaim:   config.UsernameClaim,
+		GroupsClaim:     config.GroupsClaim,
+		RolesClaim:      config.RolesClaim,
+		ScopeClaim:      config.ScopeClaim,
+		AttributeClaims: config.AttributeClaims,
+	}
+}
+
+func (m ClaimMapping) Subject(claims gojwt.MapClaims) string {
+	subject, _ := ClaimValue(claims, m.SubjectClaim).(string)
+	return subject
+}
+
+func (m ClaimMapping) Username(claims gojwt.MapClaims) string {
+	username, _ := ClaimValue(claims, m.UsernameClaim).(string)
+	return username
+}
+
+func (m ClaimMapping) Groups(claims gojwt.MapClaims) []string {
+	return claimToStrings(ClaimValue(claims, m.GroupsClaim))
+}
+
+func (m ClaimMapping) Roles(claims gojwt.MapClaims) []string {
+	return claimToStrings(ClaimValue(claims, m.RolesClaim))
+}
+
+// Scopes returns the scope claim, "scp" is read when the claim is missing
+func (m ClaimMapping) Scopes(claims gojwt.MapClaims) []string {
+	value := ClaimValue(claims, m.ScopeClaim)
+	if value == nil {
+		value = claims["scp"]
+	}
+	return claimToStrings(value)
+}
+
+// Attributes returns the ABAC attributes of the attribute claims that are present
+func (m ClaimMapping) Attributes(claims gojwt.MapClaims) map[string]any {
+	attributes := make(map[string]any, len(m.AttributeClaims))
+	for name, path := range m.AttributeClaims {
+		if value := ClaimValue(claims, path); value != nil {
+			attributes[name] = value
+		}
+	}
+	return attributes
+}
+
+// ClaimValue returns the claim of a dot separated path, nil when it is
+// missing. A claim whose name contains dots (e.g. a URL) is found as well.
+func ClaimValue(claims gojwt.MapClaims, path string) any {
+	if path == "" {
+		return nil
+	}
+	if value, ok := claims[path]; ok {
+		return value
+	}
+
+	var current any = map[string]any(claims)
+	for _, part := range strings.Split(path, ".") {
+		object, ok := current.(map[string]any)
+		if !ok {
+			return nil
+		}
+		current = object[part]
+	}
+	return current
+}
+
+// claimToStrings accepts an array claim or a space separated string claim (as used by "scope")
+func claimToStrings(value any) []string {
+	switch v := value.(type) {
+	case string:
+		return strings.Fields(v)
+	case []string:
+		return v
+	case []any:
+		result := make([]string, 0, len(v))
+		for _, item := range v {
+			if s, ok := item.(string); ok {
+				result = append(result, s)
+			}
+		}
+		return result
+	}
+
+	return []string{}
+}
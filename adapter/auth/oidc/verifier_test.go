@@ -0,0 +1,359 @@
+package oidc
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	gojwt "github.com/golang-jwt/jwt/v5"
+	"github.com/webcore-go/webcore/infra/config"
+	"github.com/webcore-go/webcore/infra/logger"
+	"github.com/webcore-go/webcore/port/auth"
+)
+
+func TestMain(m *testing.M) {
+	logger.PrepareLogger(context.Background(), "error")
+	os.Exit(m.Run())
+}
+
+// testProvider is an identity provider with discovery, JWKS and introspection endpoints
+type testProvider struct {
+	*httptest.Server
+
+	mu             sync.Mutex
+	issuer         string // issuer of the discovery document, the server URL when empty
+	keys           map[string]*rsa.PrivateKey
+	active         map[string]gojwt.MapClaims // introspection results of opaque tokens
+	jwksFetches    atomic.Int32
+	introspections atomic.Int32
+}
+
+func newTestProvider(t *testing.T) *testProvider {
+	t.Helper()
+
+	p := &testProvider{keys: map[string]*rsa.PrivateKey{}, active: map[string]gojwt.MapClaims{}}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		p.mu.Lock()
+		issuer := p.issuer
+		p.mu.Unlock()
+		if issuer == "" {
+			issuer = p.URL
+		}
+		writeJSON(w, map[string]string{
+			"issuer":                 issuer,
+			"jwks_uri":               p.URL + "/jwks",
+			"introspection_endpoint": p.URL + "/introspect",
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		p.jwksFetches.Add(1)
+		p.mu.Lock()
+		defer p.mu.Unlock()
+
+		set := jsonWebKeySet{}
+		for kid, key := range p.keys {
+			set.Keys = append(set.Keys, JSONWebKey{
+				Kty: "RSA",
+				Kid: kid,
+				Use: "sig",
+				Alg: "RS256",
+				N:   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+				E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+			})
+		}
+		writeJSON(w, set)
+	})
+	mux.HandleFunc("/introspect", func(w http.ResponseWriter, r *http.Request) {
+		p.introspections.Add(1)
+		if id, secret, ok := r.BasicAuth(); !ok || id != "client" || secret != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		p.mu.Lock()
+		claims, ok := p.active[r.PostFormValue("token")]
+		p.mu.Unlock()
+		if !ok {
+			writeJSON(w, map[string]any{"active": false})
+			return
+		}
+		writeJSON(w, claims)
+	})
+
+	p.Server = httptest.NewServer(mux)
+	t.Cleanup(p.Close)
+	return p
+}
+
+// rotate replaces the signing keys of the provider by a new key
+func (p *testProvider) rotate(t *testing.T, kid string) {
+	t.Helper()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.keys = map[string]*rsa.PrivateKey{kid: key}
+}
+
+// sign issues an RS256 token with the key of kid, the provider must hold it
+func (p *testProvider) sign(t *testing.T, kid string, key *rsa.PrivateKey, claims gojwt.MapClaims) string {
+	t.Helper()
+
+	token := gojwt.NewWithClaims(gojwt.SigningMethodRS256, claims)
+	token.Header["kid"] = kid
+	signed, err := token.SignedString(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signed
+}
+
+func (p *testProvider) key(kid string) *rsa.PrivateKey {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.keys[kid]
+}
+
+func (p *testProvider) claims(extra gojwt.MapClaims) gojwt.MapClaims {
+	now := time.Now()
+	claims := gojwt.MapClaims{
+		"iss":   p.URL,
+		"sub":   "user-1",
+		"aud":   "api",
+		"scope": "openid orders",
+		"iat":   now.Unix(),
+		"exp":   now.Add(time.Hour).Unix(),
+	}
+	for name, value := range extra {
+		claims[name] = value
+	}
+	return claims
+}
+
+func (p *testProvider) verifier(t *testing.T, configure func(*config.OIDCConfig)) *TokenVerifier {
+	t.Helper()
+
+	oidcConfig := config.OIDCConfig{
+		Issuer:                p.URL,
+		Audience:              []string{"api"},
+		Algorithms:            []string{"RS256"},
+		Leeway:                time.Second,
+		JWKSCacheTTL:          time.Hour,
+		HTTPTimeout:           5 * time.Second,
+		Introspection:         IntrospectAuto,
+		ClientID:              "client",
+		ClientSecret:          "secret",
+		IntrospectionCacheTTL: time.Minute,
+		SubjectClaim:          "sub",
+		ScopeClaim:            "scope",
+	}
+	if configure != nil {
+		configure(&oidcConfig)
+	}
+
+	verifier, err := NewTokenVerifier(oidcConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return verifier
+}
+
+func writeJSON(w http.ResponseWriter, value any) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(value)
+}
+
+func TestProviderDiscovery(t *testing.T) {
+	p := newTestProvider(t)
+
+	provider := NewProvider(p.URL, "", p.Client())
+	metadata, err := provider.Metadata(context.Background())
+	if err != nil {
+		t.Fatalf("Metadata: %v", err)
+	}
+	if metadata.JWKSURI != p.URL+"/jwks" || metadata.IntrospectionEndpoint != p.URL+"/introspect" {
+		t.Errorf("Metadata = %+v", metadata)
+	}
+}
+
+func TestProviderDiscoveryRejectsOtherIssuer(t *testing.T) {
+	p := newTestProvider(t)
+	p.issuer = "https://attacker.example"
+
+	provider := NewProvider(p.URL, "", p.Client())
+	if _, err := provider.Metadata(context.Background()); err == nil {
+		t.Fatal("Metadata accepted the discovery document of another issuer")
+	}
+}
+
+func TestVerifyJWTThroughDiscovery(t *testing.T) {
+	p := newTestProvider(t)
+	p.rotate(t, "k1")
+	verifier := p.verifier(t, nil)
+
+	claims, err := verifier.Verify(context.Background(), p.sign(t, "k1", p.key("k1"), p.claims(nil)))
+	if err != nil {
+		t.Fatalf("Verify: %v", err)
+	}
+	if verifier.Claims.Subject(claims) != "user-1" {
+		t.Errorf("Subject = %q", verifier.Claims.Subject(claims))
+	}
+}
+
+func TestVerifyAfterKeyRotation(t *testing.T) {
+	p := newTestProvider(t)
+	p.rotate(t, "k1")
+	verifier := p.verifier(t, nil)
+
+	old := p.key("k1")
+	if _, err := verifier.Verify(context.Background(), p.sign(t, "k1", old, p.claims(nil))); err != nil {
+		t.Fatalf("Verify with k1: %v", err)
+	}
+
+	// the provider rotates, a token of the new kid makes the set refresh before its TTL
+	p.rotate(t, "k2")
+	if _, err := verifier.Verify(context.Background(), p.sign(t, "k2", p.key("k2"), p.claims(nil))); err != nil {
+		t.Fatalf("Verify with k2 after rotation: %v", err)
+	}
+	if fetches := p.jwksFetches.Load(); fetches != 2 {
+		t.Errorf("JWKS fetches = %d, want 2", fetches)
+	}
+
+	// the removed key is gone with the refresh
+	if _, err := verifier.Verify(context.Background(), p.sign(t, "k1", old, p.claims(nil))); err == nil {
+		t.Error("Verify accepted a token of the removed key k1")
+	}
+}
+
+func TestUnknownKidRefreshIsLimited(t *testing.T) {
+	p := newTestProvider(t)
+	p.rotate(t, "k1")
+	verifier := p.verifier(t, func(c *config.OIDCConfig) { c.JWKSMinRefresh = time.Minute })
+
+	if _, err := verifier.Verify(context.Background(), p.sign(t, "k1", p.key("k1"), p.claims(nil))); err != nil {
+		t.Fatalf("Verify: %v", err)
+	}
+
+	// made up key ids must not reach the provider within jwks_min_refresh
+	forged, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for range 5 {
+		if _, err := verifier.Verify(context.Background(), p.sign(t, "unknown", forged, p.claims(nil))); err == nil {
+			t.Fatal("Verify accepted a token of an unknown key")
+		}
+	}
+	if fetches := p.jwksFetches.Load(); fetches != 1 {
+		t.Errorf("JWKS fetches = %d, want 1", fetches)
+	}
+}
+
+func TestVerifyRejectsClaims(t *testing.T) {
+	p := newTestProvider(t)
+	p.rotate(t, "k1")
+	verifier := p.verifier(t, func(c *config.OIDCConfig) { c.RequiredScopes = []string{"orders"} })
+
+	tests := []struct {
+		name   string
+		claims gojwt.MapClaims
+		want   error
+	}{
+		{"audience", gojwt.MapClaims{"aud": "other"}, auth.ErrCredentialsInvalid},
+		{"issuer", gojwt.MapClaims{"iss": "https://other.example"}, auth.ErrCredentialsInvalid},
+		{"expired", gojwt.MapClaims{"exp": time.Now().Add(-time.Hour).Unix()}, auth.ErrCredentialsExpired},
+		{"scope", gojwt.MapClaims{"scope": "openid"}, auth.ErrInsufficientScope},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := verifier.Verify(context.Background(), p.sign(t, "k1", p.key("k1"), p.claims(tt.claims)))
+			if !errors.Is(err, tt.want) {
+				t.Errorf("Verify error = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestVerifyRejectsWrongSignature(t *testing.T) {
+	p := newTestProvider(t)
+	p.rotate(t, "k1")
+	verifier := p.verifier(t, nil)
+
+	forged, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := verifier.Verify(context.Background(), p.sign(t, "k1", forged, p.claims(nil))); !errors.Is(err, auth.ErrCredentialsInvalid) {
+		t.Errorf("Verify error = %v, want %v", err, auth.ErrCredentialsInvalid)
+	}
+}
+
+func TestIntrospection(t *testing.T) {
+	p := newTestProvider(t)
+	verifier := p.verifier(t, nil)
+
+	p.active["opaque-active"] = gojwt.MapClaims{"active": true, "sub": "user-2", "iss": p.URL, "aud": "api", "exp": float64(time.Now().Add(time.Hour).Unix())}
+	p.active["opaque-audience"] = gojwt.MapClaims{"active": true, "sub": "user-2", "aud": "other"}
+	p.active["opaque-issuer"] = gojwt.MapClaims{"active": true, "sub": "user-2", "iss": "https://other.example", "aud": "api"}
+
+	claims, err := verifier.Verify(context.Background(), "opaque-active")
+	if err != nil {
+		t.Fatalf("Verify: %v", err)
+	}
+	if verifier.Claims.Subject(claims) != "user-2" {
+		t.Errorf("Subject = %q", verifier.Claims.Subject(claims))
+	}
+
+	// the result is cached for introspection_cache_ttl
+	if _, err := verifier.Verify(context.Background(), "opaque-active"); err != nil {
+		t.Fatalf("Verify cached: %v", err)
+	}
+	if calls := p.introspections.Load(); calls != 1 {
+		t.Errorf("Introspections = %d, want 1", calls)
+	}
+
+	for _, token := range []string{"opaque-inactive", "opaque-audience", "opaque-issuer"} {
+		if _, err := verifier.Verify(context.Background(), token); !errors.Is(err, auth.ErrCredentialsInvalid) {
+			t.Errorf("Verify %s error = %v, want %v", token, err, auth.ErrCredentialsInvalid)
+		}
+	}
+}
+
+func TestIntrospectionRequiresClientCredentials(t *testing.T) {
+	p := newTestProvider(t)
+	verifier := p.verifier(t, func(c *config.OIDCConfig) { c.ClientSecret = "wrong" })
+
+	p.active["opaque-active"] = gojwt.MapClaims{"active": true, "sub": "user-2", "aud": "api"}
+	if _, err := verifier.Verify(context.Background(), "opaque-active"); !errors.Is(err, auth.ErrCredentialsInvalid) {
+		t.Errorf("Verify error = %v, want %v", err, auth.ErrCredentialsInvalid)
+	}
+}
+
+func TestIntrospectionNeverRejectsOpaqueTokens(t *testing.T) {
+	p := newTestProvider(t)
+	verifier := p.verifier(t, func(c *config.OIDCConfig) { c.Introspection = IntrospectNever })
+
+	p.active["opaque-active"] = gojwt.MapClaims{"active": true, "sub": "user-2", "aud": "api"}
+	if _, err := verifier.Verify(context.Background(), "opaque-active"); err == nil {
+		t.Error("Verify accepted an opaque token with introspection never")
+	}
+	if calls := p.introspections.Load(); calls != 0 {
+		t.Errorf("Introspections = %d, want 0", calls)
+	}
+}
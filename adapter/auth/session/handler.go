@@ -0,0 +1,207 @@
+package session
+
+import (
+	"errors"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/webcore-go/webcore/app/helper"
+	"github.com/webcore-go/webcore/app/out"
+	"github.com/webcore-go/webcore/infra/config"
+	"github.com/webcore-go/webcore/port/auth"
+)
+
+type LoginRequest struct {
+	Username string `json:"username" form:"username"`
+	Password string `json:"password" form:"password"`
+	Code     string `json:"code" form:"code"` // TOTP or recovery code, optional
+}
+
+type StepUpRequest struct {
+	Code string `json:"code" form:"code"`
+}
+
+// SessionResponse describes the session without its user id, which is the
+// plain API key of store users
+type SessionResponse struct {
+	Id        string     `json:"id"` // hash of the session id, used for revocation
+	Username  string     `json:"username,omitempty"`
+	CSRFToken string     `json:"csrf_token"`
+	CreatedAt time.Time  `json:"created_at"`
+	ExpiresAt time.Time  `json:"expires_at"`
+	MFAAt     *time.Time `json:"mfa_at,omitempty"`
+}
+
+// SessionHandler serves the login, logout and current session endpoints
+type SessionHandler struct {
+	Sessions *SessionManager
+	Store    auth.IStore
+	Hasher   *helper.PasswordHasher
+	Lockout  *auth.Lockout // counts failed logins per user and IP, may be nil
+	MFA      *auth.MFA     // verifies the code of login and step-up, nil when auth.mfa.enabled is false
+}
+
+func NewSessionHandler(sessions *SessionManager, store auth.IStore, hasher *helper.PasswordHasher) *SessionHandler {
+	return &SessionHandler{
+		Sessions: sessions,
+		Store:    store,
+		Hasher:   hasher,
+	}
+}
+
+// Register mounts the endpoints outside of the protected path prefix
+func (h *SessionHandler) Register(router fiber.Router, config config.SessionConfig) {
+	if config.Path == "" {
+		return
+	}
+
+	router.Get(config.Path, h.Current)
+	router.Post(config.Path+"/login", h.Login)
+	router.Post(config.Path+"/logout", h.Logout)
+	if h.MFA != nil {
+		router.Post(config.Path+"/mfa", h.StepUp)
+	}
+}
+
+// Login checks username and password (JSON or form) and starts a new session.
+// A session of the request is ended first, so an id planted before the login
+// is never authenticated.
+func (h *SessionHandler) Login(c *fiber.Ctx) error {
+	var req LoginRequest
+	if err := c.BodyParser(&req); err != nil || req.Username == "" || req.Password == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(out.Error(fiber.StatusBadRequest, 1, "BAD_REQUEST", "username and password are required"))
+	}
+
+	identities := []string{"user:" + req.Username}
+	if h.Lockout != nil {
+		if err := h.Lockout.Check(c, identities); err != nil {
+			return auth.AsAuthError(err, auth.ErrTooManyAttempts).Respond(c, nil)
+		}
+	}
+
+	// the wrapper resolves groups and inherited roles like the middleware, so
+	// the privileges of the session match the first request
+	validator := auth.NewPasswordValidator(req.Username, req.Password, h.Hasher)
+	userInfo, err := auth.NewStoreWrapper(h.Store).CheckUser(c, validator, req.Username)
+	if errors.Is(err, auth.ErrStoreUnavailable) {
+		return auth.AsAuthError(err, auth.ErrStoreUnavailable).Respond(c, nil)
+	}
+	if err != nil || userInfo == nil {
+		validator.CheckDummyPassword(c)
+		if h.Lockout != nil {
+			h.Lockout.Fail(c, "session", identities)
+		}
+		return auth.ErrCredentialsInvalid.With(err).Respond(c, nil)
+	}
+
+	principal := auth.NewPrincipal("session", userInfo)
+
+	// the code is optional, without it the session has no step-up
+	var mfaAt *time.Time
+	if h.MFA != nil && req.Code != "" {
+		if err := h.MFA.Verify(c.UserContext(), principal.UserId, req.Code, true); err != nil {
+			if h.Lockout != nil {
+				h.Lockout.Fail(c, "session", identities)
+			}
+			return auth.AsAuthError(err, auth.ErrMFAInvalid).Respond(c, nil)
+		}
+		now := time.Now()
+		mfaAt = &now
+	}
+
+	if h.Lockout != nil {
+		h.Lockout.Succeed(c, identities)
+	}
+
+	auth.UpgradePassword(c, h.Store, userInfo)
+
+	if previous, err := h.Sessions.Load(c); err == nil {
+		h.Sessions.Destroy(c, previous)
+	}
+
+	session, err := h.Sessions.Create(c, principal.UserId, principal.Username, auth.PrivilegeHash(principal.Groups, principal.Roles), mfaAt)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(out.ErrorDetail(fiber.StatusInternalServerError, 1, "UNKNOWN", "Failed to create session", err))
+	}
+
+	return c.JSON(out.SuccessData(h.response(session)))
+}
+
+// Logout ends the session of the cookie, the CSRF token is required
+func (h *SessionHandler) Logout(c *fiber.Ctx) error {
+	session, err := h.Sessions.Load(c)
+	if err != nil {
+		return auth.AsAuthError(err, auth.ErrCredentialsInvalid).Respond(c, nil)
+	}
+
+	if err := h.Sessions.CheckCSRF(c, session); err != nil {
+		return auth.AsAuthError(err, auth.ErrCSRFInvalid).Respond(c, nil)
+	}
+
+	h.Sessions.Destroy(c, session)
+	return c.JSON(out.SuccessMessage("Logged out"))
+}
+
+// StepUp verifies a second factor for the session of the cookie, the CSRF
+// token is required. Wrong codes are counted like failed logins.
+func (h *SessionHandler) StepUp(c *fiber.Ctx) error {
+	session, err := h.Sessions.Load(c)
+	if err != nil {
+		return auth.AsAuthError(err, auth.ErrCredentialsInvalid).Respond(c, nil)
+	}
+
+	if err := h.Sessions.CheckCSRF(c, session); err != nil {
+		return auth.AsAuthError(err, auth.ErrCSRFInvalid).Respond(c, nil)
+	}
+
+	var req StepUpRequest
+	if err := c.BodyParser(&req); err != nil || req.Code == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(out.Error(fiber.StatusBadRequest, 1, "BAD_REQUEST", "code is required"))
+	}
+
+	identities := []string{"user:" + session.Subject()}
+	if h.Lockout != nil {
+		if err := h.Lockout.Check(c, identities); err != nil {
+			return auth.AsAuthError(err, auth.ErrTooManyAttempts).Respond(c, nil)
+		}
+	}
+
+	if err := h.MFA.Verify(c.UserContext(), session.UserId, req.Code, true); err != nil {
+		if h.Lockout != nil {
+			h.Lockout.Fail(c, "session", identities)
+		}
+		return auth.AsAuthError(err, auth.ErrMFAInvalid).Respond(c, nil)
+	}
+
+	if h.Lockout != nil {
+		h.Lockout.Succeed(c, identities)
+	}
+
+	if err := h.Sessions.StepUp(c, session); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(out.ErrorDetail(fiber.StatusInternalServerError, 1, "UNKNOWN", "Failed to save session", err))
+	}
+
+	return c.JSON(out.SuccessData(h.response(session)))
+}
+
+// Current returns the session of the cookie with its CSRF token, e.g. for
+// single page applications after a reload
+func (h *SessionHandler) Current(c *fiber.Ctx) error {
+	session, err := h.Sessions.Load(c)
+	if err != nil {
+		return auth.AsAuthError(err, auth.ErrCredentialsInvalid).Respond(c, nil)
+	}
+
+	return c.JSON(out.SuccessData(h.response(session)))
+}
+
+func (h *SessionHandler) response(session *auth.Session) SessionResponse {
+	return SessionResponse{
+		Id:        session.Hash(),
+		Username:  session.Username,
+		CSRFToken: session.CSRFToken,
+		CreatedAt: session.CreatedAt,
+		ExpiresAt: h.Sessions.ExpiresAt(session),
+		MFAAt:     session.MFAAt,
+	}
+}
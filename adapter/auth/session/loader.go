@@ -0,0 +1,210 @@
+package session
+
+import (
+	"fmt"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/webcore-go/webcore/adapter/auth/authn"
+	"github.com/webcore-go/webcore/app/core"
+	"github.com/webcore-go/webcore/app/helper"
+	"github.com/webcore-go/webcore/infra/config"
+	"github.com/webcore-go/webcore/infra/logger"
+	"github.com/webcore-go/webcore/port"
+	"github.com/webcore-go/webcore/port/auth"
+)
+
+// keys in fiber.Ctx locals with the session of the current request and its manager
+const (
+	sessionLocal = "auth_session"
+	managerLocal = "auth_session_manager"
+)
+
+type SessionLoader struct {
+	name string
+}
+
+func (a *SessionLoader) SetName(name string) {
+	a.name = name
+}
+
+func (a *SessionLoader) Name() string {
+	return a.name
+}
+
+func (l *SessionLoader) Init(args ...any) (port.Library, error) {
+	context := args[0].(*core.AppContext)
+	config := args[1].(config.AuthConfig)
+
+	store, err := sessionStore(context, config.Session.Store)
+	if err != nil {
+		return nil, err
+	}
+
+	sessions, err := NewSessionManager(store, config.Session)
+	if err != nil {
+		return nil, err
+	}
+
+	validator := NewSessionValidator(sessions)
+	validator.Revocation = context.Revocation
+	validator.MFA = context.MFA
+
+	authn := &authn.AuthN{}
+	authn.SetValidator(validator)
+	err = authn.Install(args...)
+	if err != nil {
+		return nil, err
+	}
+
+	hasher, err := helper.NewPasswordHasher(config.Password.Algorithm)
+	if err != nil {
+		return nil, err
+	}
+
+	handler := NewSessionHandler(sessions, authn.Store, hasher)
+	handler.Lockout = context.Lockout
+	handler.MFA = context.MFA
+	handler.Register(context.Web, config.Session)
+
+	return authn, nil
+}
+
+// sessionStore returns the store of auth.session.store
+func sessionStore(context *core.AppContext, name string) (auth.ISessionStore, error) {
+	switch name {
+	case "", "memory":
+		return auth.NewMemorySessionStore(), nil
+	case "cache":
+		library, ok := context.GetSingletonInstance("redis")
+		if !ok {
+			library, ok = context.GetSingletonInstance("cache:redis")
+		}
+		cache, isCache := library.(port.IMemoryCache)
+		if !ok || !isCache {
+			return nil, fmt.Errorf("auth.session.store cache requires a memory cache library, configure redis")
+		}
+		return auth.NewCacheSessionStore(cache)
+	}
+	return nil, fmt.Errorf("Unknown auth.session.store %s, use memory or cache", name)
+}
+
+// SessionValidator authenticates requests by the session cookie
+type SessionValidator struct {
+	Sessions   *SessionManager
+	Revocation *auth.Revocation // rejects sessions of revoked subjects, nil when auth.revocation.enabled is false
+	MFA        *auth.MFA        // decides how long a step-up counts, nil when auth.mfa.enabled is false
+}
+
+func NewSessionValidator(sessions *SessionManager) *SessionValidator {
+	return &SessionValidator{
+		Sessions: sessions,
+	}
+}
+
+func (a *SessionValidator) Name() string {
+	return "session"
+}
+
+func (a *SessionValidator) ValidateKey(ctx *fiber.Ctx) (string, error) {
+	session, err := a.Sessions.Load(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	if a.Revocation != nil {
+		token := auth.RevocationToken{ID: session.Hash(), Subject: session.Subject(), IssuedAt: session.CreatedAt}
+		if err := a.Revocation.Check(ctx.UserContext(), token); err != nil {
+			if !auth.IsDryRun(ctx) {
+				a.Sessions.Destroy(ctx, session)
+			}
+			return "", err
+		}
+	}
+
+	if err := a.Sessions.CheckCSRF(ctx, session); err != nil {
+		return "", err
+	}
+
+	if !auth.IsDryRun(ctx) {
+		a.Sessions.Touch(ctx, session)
+	}
+	ctx.Locals(sessionLocal, session)
+	ctx.Locals(managerLocal, a.Sessions)
+	if session.UserId != "" {
+		return session.UserId, nil
+	}
+	return session.Username, nil
+}
+
+func (a *SessionValidator) HasCredential(ctx *fiber.Ctx) bool {
+	return ctx.Cookies(a.Sessions.Config.CookieName) != ""
+}
+
+func (a *SessionValidator) UserLookups(ctx *fiber.Ctx, userKey string) []auth.UserLookup {
+	return []auth.UserLookup{{Field: "key", Value: userKey}, {Field: "user", Value: userKey}}
+}
+
+func (a *SessionValidator) VerifyUser(ctx *fiber.Ctx, userKey string, userInfo auth.IUserAuthInfo) (bool, error) {
+	if userKey == "" {
+		return false, nil
+	}
+
+	switch user := userInfo.(type) {
+	case *auth.UserAuthInfoRBAC:
+		return user.UserId == userKey || (user.Username != nil && *user.Username == userKey), nil
+	case *auth.UserAuthInfoABAC:
+		return user.UserId == userKey || (user.Username != nil && *user.Username == userKey), nil
+	}
+	return false, nil
+}
+
+// ExtendPrincipal rotates the session when groups or roles of the user
+// changed since the login or the last rotation
+func (a *SessionValidator) ExtendPrincipal(ctx *fiber.Ctx, principal *auth.Principal) {
+	session := GetSession(ctx)
+	if session == nil {
+		return
+	}
+
+	principal.CredentialId = session.Hash()[:16]
+	principal.MFA = a.MFA != nil && a.MFA.IsFresh(session.MFAAt)
+
+	privileges := auth.PrivilegeHash(principal.Groups, principal.Roles)
+	if session.Privileges == privileges || auth.IsDryRun(ctx) {
+		return
+	}
+
+	if err := a.Sessions.Rotate(ctx, session, privileges); err != nil {
+		logger.Warn("Rotate session after privilege change failed", "error", err)
+		return
+	}
+	logger.Info("Session rotated after privilege change", "user", principal.Name())
+}
+
+// GetSession returns the session of the current request, nil for other schemes
+func GetSession(ctx *fiber.Ctx) *auth.Session {
+	session, ok := ctx.Locals(sessionLocal).(*auth.Session)
+	if !ok {
+		return nil
+	}
+	return session
+}
+
+// CSRFToken returns the CSRF token of the current session for forms of
+// server-rendered pages, empty without session
+func CSRFToken(ctx *fiber.Ctx) string {
+	if session := GetSession(ctx); session != nil {
+		return session.CSRFToken
+	}
+	return ""
+}
+
+// Rotate replaces id and CSRF token of the current session, e.g. after a step-up login
+func Rotate(ctx *fiber.Ctx) error {
+	session := GetSession(ctx)
+	sessions, ok := ctx.Locals(managerLocal).(*SessionManager)
+	if session == nil || !ok {
+		return fmt.Errorf("Request has no session")
+	}
+	return sessions.Rotate(ctx, session, session.Privileges)
+}
@@ -0,0 +1,271 @@
+package session
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/webcore-go/webcore/infra/config"
+	"github.com/webcore-go/webcore/infra/logger"
+	"github.com/webcore-go/webcore/port/auth"
+)
+
+// CSRF protections of unsafe requests
+const (
+	CSRFSynchronizer = "synchronizer"  // the token of the session is sent back in a header or form field
+	CSRFDoubleSubmit = "double_submit" // the token of a readable cookie is sent back in a header or form field
+	CSRFNone         = "none"
+)
+
+// a session is written to the store at most once per interval when only its last request time changes
+const touchInterval = time.Minute
+
+// SessionManager creates, loads and rotates the sessions and their cookies
+type SessionManager struct {
+	Store  auth.ISessionStore
+	Config config.SessionConfig
+}
+
+func NewSessionManager(store auth.ISessionStore, config config.SessionConfig) (*SessionManager, error) {
+	switch config.CSRF {
+	case CSRFSynchronizer, CSRFDoubleSubmit, CSRFNone:
+	default:
+		return nil, fmt.Errorf("Unknown auth.session.csrf %s, use synchronizer, double_submit or none", config.CSRF)
+	}
+
+	switch strings.ToLower(config.SameSite) {
+	case "lax", "strict", "none":
+	default:
+		return nil, fmt.Errorf("Unknown auth.session.same_site %s, use Lax, Strict or None", config.SameSite)
+	}
+	if strings.EqualFold(config.SameSite, "none") && !config.Secure {
+		return nil, fmt.Errorf("auth.session.same_site None requires auth.session.secure")
+	}
+
+	if config.IdleTimeout <= 0 || config.AbsoluteTimeout <= 0 {
+		return nil, fmt.Errorf("auth.session.idle_timeout and auth.session.absolute_timeout must be positive")
+	}
+
+	return &SessionManager{
+		Store:  store,
+		Config: config,
+	}, nil
+}
+
+// Create starts a session for the user and sets the cookies, mfaAt is the
+// time of a second factor verified with the login
+func (m *SessionManager) Create(c *fiber.Ctx, userId string, username string, privileges string, mfaAt *time.Time) (*auth.Session, error) {
+	now := time.Now()
+	session := &auth.Session{
+		UserId:     userId,
+		Username:   username,
+		Privileges: privileges,
+		CreatedAt:  now,
+		LastSeenAt: now,
+		MFAAt:      mfaAt,
+		IP:         c.IP(),
+		UserAgent:  c.Get(fiber.HeaderUserAgent),
+	}
+
+	if err := m.renew(session); err != nil {
+		return nil, err
+	}
+	if err := m.save(c, session); err != nil {
+		return nil, err
+	}
+
+	m.setCookies(c, session)
+	return session, nil
+}
+
+// Load returns the session of the cookie. Expired sessions are deleted.
+func (m *SessionManager) Load(c *fiber.Ctx) (*auth.Session, error) {
+	id := c.Cookies(m.Config.CookieName)
+	if id == "" {
+		return nil, auth.ErrCredentialsMissing.Withf("Session cookie required")
+	}
+
+	key := sessionKey(auth.HashSessionId(id))
+	session, err := m.Store.Load(c.UserContext(), key)
+	if err != nil {
+		return nil, auth.ErrCredentialsInvalid.With(err)
+	}
+	if session == nil {
+		m.clearCookies(c)
+		return nil, auth.ErrCredentialsInvalid.Withf("Unknown session")
+	}
+	session.Id = id
+
+	now := time.Now()
+	if now.Sub(session.LastSeenAt) > m.Config.IdleTimeout || now.Sub(session.CreatedAt) > m.Config.AbsoluteTimeout {
+		m.Destroy(c, session)
+		return nil, auth.ErrCredentialsExpired.Withf("Session expired")
+	}
+
+	return session, nil
+}
+
+// Touch extends the idle timeout of the session
+func (m *SessionManager) Touch(c *fiber.Ctx, session *auth.Session) {
+	now := time.Now()
+	if now.Sub(session.LastSeenAt) < min(touchInterval, m.Config.IdleTimeout/10) {
+		return
+	}
+
+	session.LastSeenAt = now
+	if err := m.save(c, session); err != nil {
+		logger.Warn("Save session failed", "error", err)
+	}
+}
+
+// Rotate replaces id and CSRF token of the session, e.g. after a privilege
+// change, so an id known before the change is worthless. The login time and
+// with it the absolute timeout are kept.
+func (m *SessionManager) Rotate(c *fiber.Ctx, session *auth.Session, privileges string) error {
+	oldKey := sessionKey(session.Hash())
+
+	session.Privileges = privileges
+	if err := m.renew(session); err != nil {
+		return err
+	}
+	if err := m.save(c, session); err != nil {
+		return err
+	}
+	if err := m.Store.Delete(c.UserContext(), oldKey); err != nil {
+		logger.Warn("Delete rotated session failed", "error", err)
+	}
+
+	m.setCookies(c, session)
+	// pages that keep the token in a form learn the new one from the response
+	c.Set(m.Config.CSRFHeader, session.CSRFToken)
+	return nil
+}
+
+// StepUp records a verified second factor and rotates the session, so an id
+// known before the step-up does not gain its privileges
+func (m *SessionManager) StepUp(c *fiber.Ctx, session *auth.Session) error {
+	now := time.Now()
+	session.MFAAt = &now
+	return m.Rotate(c, session, session.Privileges)
+}
+
+// Destroy deletes the session and its cookies
+func (m *SessionManager) Destroy(c *fiber.Ctx, session *auth.Session) {
+	if err := m.Store.Delete(c.UserContext(), sessionKey(session.Hash())); err != nil {
+		logger.Warn("Delete session failed", "error", err)
+	}
+	m.clearCookies(c)
+}
+
+// CheckCSRF verifies the CSRF token of unsafe requests
+func (m *SessionManager) CheckCSRF(c *fiber.Ctx, session *auth.Session) error {
+	if m.Config.CSRF == CSRFNone {
+		return nil
+	}
+
+	switch c.Method() {
+	case fiber.MethodGet, fiber.MethodHead, fiber.MethodOptions, fiber.MethodTrace:
+		return nil
+	}
+
+	token := c.Get(m.Config.CSRFHeader)
+	if token == "" && m.Config.CSRFField != "" {
+		token = c.FormValue(m.Config.CSRFField)
+	}
+	if token == "" {
+		return auth.ErrCSRFInvalid.Withf("CSRF token missing")
+	}
+
+	expected := session.CSRFToken
+	if m.Config.CSRF == CSRFDoubleSubmit {
+		// the cookie is bound to the session, a cookie planted by another site does not match
+		cookie := c.Cookies(m.Config.CSRFCookieName)
+		if subtle.ConstantTimeCompare([]byte(cookie), []byte(expected)) != 1 {
+			return auth.ErrCSRFInvalid.Withf("CSRF cookie does not belong to the session")
+		}
+		expected = cookie
+	}
+
+	if subtle.ConstantTimeCompare([]byte(token), []byte(expected)) != 1 {
+		return auth.ErrCSRFInvalid.Withf("CSRF token does not match")
+	}
+	return nil
+}
+
+// ExpiresAt returns the end of the session when no further request arrives
+func (m *SessionManager) ExpiresAt(session *auth.Session) time.Time {
+	idle := session.LastSeenAt.Add(m.Config.IdleTimeout)
+	absolute := session.CreatedAt.Add(m.Config.AbsoluteTimeout)
+	if idle.Before(absolute) {
+		return idle
+	}
+	return absolute
+}
+
+// renew sets a new id and CSRF token
+func (m *SessionManager) renew(session *auth.Session) error {
+	id, err := randomToken()
+	if err != nil {
+		return err
+	}
+	csrf, err := randomToken()
+	if err != nil {
+		return err
+	}
+
+	session.Id = id
+	session.CSRFToken = csrf
+	return nil
+}
+
+func (m *SessionManager) save(c *fiber.Ctx, session *auth.Session) error {
+	// kept a little longer than it lives, so a late request is told the session expired
+	return m.Store.Save(c.UserContext(), sessionKey(session.Hash()), session, time.Until(m.ExpiresAt(session))+touchInterval)
+}
+
+func (m *SessionManager) setCookies(c *fiber.Ctx, session *auth.Session) {
+	expires := session.CreatedAt.Add(m.Config.AbsoluteTimeout)
+
+	c.Cookie(m.cookie(m.Config.CookieName, session.Id, expires, true))
+	if m.Config.CSRF == CSRFDoubleSubmit {
+		// readable by the scripts of the page, which send it back in the header
+		c.Cookie(m.cookie(m.Config.CSRFCookieName, session.CSRFToken, expires, false))
+	}
+}
+
+func (m *SessionManager) clearCookies(c *fiber.Ctx) {
+	expired := time.Unix(0, 0)
+	c.Cookie(m.cookie(m.Config.CookieName, "", expired, true))
+	if m.Config.CSRF == CSRFDoubleSubmit {
+		c.Cookie(m.cookie(m.Config.CSRFCookieName, "", expired, false))
+	}
+}
+
+func (m *SessionManager) cookie(name string, value string, expires time.Time, httpOnly bool) *fiber.Cookie {
+	return &fiber.Cookie{
+		Name:     name,
+		Value:    value,
+		Path:     m.Config.CookiePath,
+		Domain:   m.Config.CookieDomain,
+		Expires:  expires,
+		Secure:   m.Config.Secure,
+		HTTPOnly: httpOnly,
+		SameSite: m.Config.SameSite,
+	}
+}
+
+func sessionKey(hash string) string {
+	return "auth:session:" + hash
+}
+
+func randomToken() (string, error) {
+	data := make([]byte, 32)
+	if _, err := rand.Read(data); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(data), nil
+}
@@ -0,0 +1,155 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/webcore-go/webcore/app/helper"
+	"github.com/webcore-go/webcore/port"
+	"github.com/webcore-go/webcore/port/auth"
+)
+
+// AuthStoreDB implements auth.IAPIKeyStore on the api_keys table
+
+func (d *AuthStoreDB) CreateAPIKey(ctx context.Context, key *auth.APIKey) error {
+	row, err := toAPIKeyRow(key)
+	if err != nil {
+		return err
+	}
+
+	if _, err := d.Database.InsertOne(ctx, d.table(TableAPIKeys), row); err != nil {
+		return fmt.Errorf("Create API key: %v", err)
+	}
+	return nil
+}
+
+func (d *AuthStoreDB) GetAPIKey(ctx context.Context, id string) (*auth.APIKey, error) {
+	var row APIKeyRow
+	filter := []port.DbExpression{{Expr: "id", Op: "=", Args: []any{id}}}
+	if err := d.Database.FindOne(ctx, &row, d.table(TableAPIKeys), nil, filter, nil); err != nil || row.Id == "" {
+		return nil, fmt.Errorf("API key %s not found", id)
+	}
+
+	return fromAPIKeyRow(&row)
+}
+
+func (d *AuthStoreDB) ListAPIKeys(ctx context.Context, userId string) ([]*auth.APIKey, error) {
+	var filter []port.DbExpression
+	if userId != "" {
+		filter = []port.DbExpression{{Expr: "user_id", Op: "=", Args: []any{userId}}}
+	}
+
+	var rows []APIKeyRow
+	if err := d.Database.Find(ctx, &rows, d.table(TableAPIKeys), nil, filter, map[string]int{"created_at": 1}, 0, 0); err != nil {
+		return nil, fmt.Errorf("Load API keys: %v", err)
+	}
+
+	keys := make([]*auth.APIKey, 0, len(rows))
+	for i := range rows {
+		key, err := fromAPIKeyRow(&rows[i])
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
+
+func (d *AuthStoreDB) UpdateAPIKey(ctx context.Context, key *auth.APIKey) error {
+	row, err := toAPIKeyRow(key)
+	if err != nil {
+		return err
+	}
+
+	filter := []port.DbExpression{{Expr: "id", Op: "=", Args: []any{key.Id}}}
+	_, err = d.Database.UpdateOne(ctx, d.table(TableAPIKeys), filter, map[string]any{
+		"name":         row.Name,
+		"scopes":       row.Scopes,
+		"expires_at":   row.ExpiresAt,
+		"last_used_at": row.LastUsedAt,
+		"revoked_at":   row.RevokedAt,
+		"replaced_by":  row.ReplacedBy,
+		"grace_until":  row.GraceUntil,
+	})
+	return err
+}
+
+func (d *AuthStoreDB) TouchAPIKey(ctx context.Context, id string, at time.Time) error {
+	filter := []port.DbExpression{{Expr: "id", Op: "=", Args: []any{id}}}
+	_, err := d.Database.UpdateOne(ctx, d.table(TableAPIKeys), filter, map[string]any{
+		"last_used_at": formatTime(&at),
+	})
+	return err
+}
+
+func toAPIKeyRow(key *auth.APIKey) (APIKeyRow, error) {
+	scopes := key.Scopes
+	if scopes == nil {
+		scopes = []string{}
+	}
+
+	encoded, err := helper.ToJSON(scopes)
+	if err != nil {
+		return APIKeyRow{}, err
+	}
+
+	return APIKeyRow{
+		Id:         key.Id,
+		Prefix:     key.Prefix,
+		Hash:       key.Hash,
+		UserId:     key.UserId,
+		Name:       key.Name,
+		Scopes:     encoded,
+		CreatedAt:  formatTime(&key.CreatedAt),
+		ExpiresAt:  formatTime(key.ExpiresAt),
+		LastUsedAt: formatTime(key.LastUsedAt),
+		RevokedAt:  formatTime(key.RevokedAt),
+		ReplacedBy: key.ReplacedBy,
+		GraceUntil: formatTime(key.GraceUntil),
+	}, nil
+}
+
+func fromAPIKeyRow(row *APIKeyRow) (*auth.APIKey, error) {
+	// a key with unreadable scopes must not become a key without limits
+	scopes, err := decodeList(row.Scopes, "API key "+row.Id, "scopes")
+	if err != nil {
+		return nil, err
+	}
+
+	key := &auth.APIKey{
+		Id:         row.Id,
+		Prefix:     row.Prefix,
+		Hash:       row.Hash,
+		UserId:     row.UserId,
+		Name:       row.Name,
+		Scopes:     scopes,
+		ExpiresAt:  parseTime(row.ExpiresAt),
+		LastUsedAt: parseTime(row.LastUsedAt),
+		RevokedAt:  parseTime(row.RevokedAt),
+		ReplacedBy: row.ReplacedBy,
+		GraceUntil: parseTime(row.GraceUntil),
+	}
+	if createdAt := parseTime(row.CreatedAt); createdAt != nil {
+		key.CreatedAt = *createdAt
+	}
+	return key, nil
+}
+
+func formatTime(t *time.Time) string {
+	if t == nil {
+		return ""
+	}
+	return t.UTC().Format(time.RFC3339Nano)
+}
+
+func parseTime(value string) *time.Time {
+	if value == "" {
+		return nil
+	}
+	t, err := time.Parse(time.RFC3339Nano, value)
+	if err != nil {
+		return nil
+	}
+	return &t
+}
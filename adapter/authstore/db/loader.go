@@ -0,0 +1,392 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/webcore-go/webcore/adapter/authstore/store"
+	"github.com/webcore-go/webcore/app/core"
+	"github.com/webcore-go/webcore/infra/config"
+	"github.com/webcore-go/webcore/infra/logger"
+	"github.com/webcore-go/webcore/port"
+	"github.com/webcore-go/webcore/port/auth"
+)
+
+type DbLoader struct {
+	name string
+}
+
+func (a *DbLoader) SetName(name string) {
+	a.name = name
+}
+
+func (a *DbLoader) Name() string {
+	return a.name
+}
+
+func (l *DbLoader) Init(args ...any) (port.Library, error) {
+	context := args[0].(*core.AppContext)
+	config := args[1].(config.AuthConfig)
+
+	library, ok := context.GetDefaultSingletonInstance("database")
+	if !ok {
+		return nil, fmt.Errorf("auth.store db requires a configured database")
+	}
+
+	database, ok := library.(port.IDatabase)
+	if !ok {
+		return nil, fmt.Errorf("Library %s does not implement IDatabase", library)
+	}
+
+	backend, err := DbBackend(context.Context, database, config)
+	if err != nil {
+		return nil, err
+	}
+
+	store := &store.AuthStore{}
+	store.SetBackend(backend)
+	err = store.Install(args...)
+	if err != nil {
+		return nil, err
+	}
+
+	return store, nil
+}
+
+// catalog is the cached part of the store: resources, groups and roles
+type catalog struct {
+	Resources []auth.IResourceInfo
+	Index     *auth.RouteIndex[auth.IResourceInfo]
+	Hierarchy *auth.RoleHierarchy // groups and role inheritance
+	LoadedAt  time.Time
+}
+
+// AuthStoreDB keeps users, groups, roles, resources and ABAC policies in the
+// configured IDatabase. Users are queried per request; resources and groups
+// are cached and reloaded after auth.db.refresh_interval.
+type AuthStoreDB struct {
+	ControlType     string
+	Database        port.IDatabase
+	Prefix          string
+	RefreshInterval time.Duration
+
+	catalog    atomic.Pointer[catalog]
+	refreshing atomic.Bool
+	mu         sync.Mutex
+}
+
+func DbBackend(ctx context.Context, database port.IDatabase, config config.AuthConfig) (*AuthStoreDB, error) {
+	d := &AuthStoreDB{
+		ControlType:     config.Control,
+		Database:        database,
+		Prefix:          config.DB.TablePrefix,
+		RefreshInterval: config.DB.RefreshInterval,
+	}
+
+	if config.DB.CreateSchema {
+		created, err := createSchema(ctx, database.GetConnection(), d.Prefix)
+		if err != nil {
+			return nil, err
+		}
+		if !created {
+			logger.Info("Auth schema is not created automatically for this driver", "driver", database.GetDriver())
+		}
+	}
+
+	if err := d.Reload(ctx); err != nil {
+		return nil, err
+	}
+
+	return d, nil
+}
+
+func (d *AuthStoreDB) table(name string) string {
+	return d.Prefix + name
+}
+
+// Reload reads resources, groups, roles and resource policies from the database
+func (d *AuthStoreDB) Reload(ctx context.Context) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	var groupRows []GroupRow
+	if err := d.Database.Find(ctx, &groupRows, d.table(TableGroups), nil, nil, nil, 0, 0); err != nil {
+		return fmt.Errorf("Load auth groups: %v", err)
+	}
+
+	var roleRows []RoleRow
+	if err := d.Database.Find(ctx, &roleRows, d.table(TableRoles), nil, nil, nil, 0, 0); err != nil {
+		return fmt.Errorf("Load auth roles: %v", err)
+	}
+
+	var resourceRows []ResourceRow
+	if err := d.Database.Find(ctx, &resourceRows, d.table(TableResources), nil, nil, nil, 0, 0); err != nil {
+		return fmt.Errorf("Load auth resources: %v", err)
+	}
+
+	groups := make([]auth.GroupDef, 0, len(groupRows))
+	for _, row := range groupRows {
+		groupRoles, err := decodeList(row.Roles, "group "+row.Name, "group_roles")
+		if err != nil {
+			return err
+		}
+		groups = append(groups, auth.GroupDef{Name: row.Name, Roles: groupRoles})
+	}
+
+	roles := make([]auth.RoleDef, 0, len(roleRows))
+	for _, row := range roleRows {
+		inherits, err := decodeList(row.Inherits, "role "+row.Name, "inherits")
+		if err != nil {
+			return err
+		}
+		roles = append(roles, auth.RoleDef{Name: row.Name, Inherits: inherits, Description: row.Description})
+	}
+
+	// a cycle keeps the previously loaded catalog
+	hierarchy, err := auth.NewRoleHierarchy(groups, roles)
+	if err != nil {
+		return err
+	}
+
+	c := &catalog{
+		Resources: make([]auth.IResourceInfo, 0, len(resourceRows)),
+		Hierarchy: hierarchy,
+		LoadedAt:  time.Now(),
+	}
+
+	if d.ControlType == "ABAC" {
+		policies, err := d.findPolicies(ctx, OwnerResource, "")
+		if err != nil {
+			return err
+		}
+
+		for _, row := range resourceRows {
+			attributes, err := decodeMap(row.Attributes, "resource "+row.Id, "attributes")
+			if err != nil {
+				return err
+			}
+			c.Resources = append(c.Resources, &auth.ResourceInfoABAC{
+				Action:            row.Action,
+				Path:              row.Path,
+				Method:            row.Method,
+				Attributes:        attributes,
+				PermittedPolicies: policies[row.Id],
+				MFA:               row.MFA,
+			})
+		}
+	} else {
+		for _, row := range resourceRows {
+			permittedRoles, err := decodeList(row.Roles, "resource "+row.Id, "permitted_roles")
+			if err != nil {
+				return err
+			}
+			c.Resources = append(c.Resources, &auth.ResourceInfoRBAC{
+				Action:         row.Action,
+				Path:           row.Path,
+				Method:         row.Method,
+				PermittedRoles: permittedRoles,
+				MFA:            row.MFA,
+			})
+		}
+	}
+
+	index, err := store.BuildResourceIndex(c.Resources)
+	if err != nil {
+		return err
+	}
+	c.Index = index
+
+	d.catalog.Store(c)
+	return nil
+}
+
+// current returns the cached catalog and triggers a background reload when it is stale
+func (d *AuthStoreDB) current() *catalog {
+	c := d.catalog.Load()
+	if d.RefreshInterval > 0 && time.Since(c.LoadedAt) > d.RefreshInterval && d.refreshing.CompareAndSwap(false, true) {
+		go func() {
+			defer d.refreshing.Store(false)
+			if err := d.Reload(context.Background()); err != nil {
+				logger.Error("Reload auth store failed, keep using cached data", "error", err)
+			}
+		}()
+	}
+	return c
+}
+
+// findPolicies returns the policies of one owner type, grouped by owner id
+func (d *AuthStoreDB) findPolicies(ctx context.Context, ownerType string, ownerId string) (map[string][]auth.PolicyABAC, error) {
+	filter := []port.DbExpression{{Expr: "owner_type", Op: "=", Args: []any{ownerType}}}
+	if ownerId != "" {
+		filter = append(filter, port.DbExpression{Expr: "owner_id", Op: "=", Args: []any{ownerId}})
+	}
+
+	var rows []PolicyRow
+	if err := d.Database.Find(ctx, &rows, d.table(TablePolicies), nil, filter, map[string]int{"id": 1}, 0, 0); err != nil {
+		return nil, fmt.Errorf("Load auth policies: %v", err)
+	}
+
+	policies := make(map[string][]auth.PolicyABAC)
+	for _, row := range rows {
+		conditions, err := decodeConditions(row.Conditions, "policy "+row.Id, "conditions")
+		if err != nil {
+			return nil, err
+		}
+		policies[row.OwnerId] = append(policies[row.OwnerId], auth.PolicyABAC{
+			Effect:    row.Effect,
+			Action:    row.Action,
+			Condition: conditions,
+		})
+	}
+
+	return policies, nil
+}
+
+// toUserAuthInfo converts a row into the user type of the configured control
+func (d *AuthStoreDB) toUserAuthInfo(ctx context.Context, row *UserRow) (auth.IUserAuthInfo, error) {
+	// the user id can be a plain API key, it is not named in errors
+	name := "a user without username"
+	if row.Username != nil {
+		name = "user " + *row.Username
+	}
+
+	groups, err := decodeList(row.Groups, name, "user_groups")
+	if err != nil {
+		return nil, err
+	}
+
+	if d.ControlType == "ABAC" {
+		policies, err := d.findPolicies(ctx, OwnerUser, row.UserId)
+		if err != nil {
+			return nil, err
+		}
+
+		attributes, err := decodeMap(row.Attributes, name, "attributes")
+		if err != nil {
+			return nil, err
+		}
+
+		return &auth.UserAuthInfoABAC{
+			UserId:     row.UserId,
+			Username:   row.Username,
+			Password:   row.Password,
+			HmacSecret: row.HmacSecret,
+			Groups:     groups,
+			Attributes: attributes,
+			Policies:   policies[row.UserId],
+		}, nil
+	}
+
+	roles, err := decodeList(row.Roles, name, "user_roles")
+	if err != nil {
+		return nil, err
+	}
+
+	// roles of the groups and inherited roles are resolved by the store wrapper
+	return &auth.UserAuthInfoRBAC{
+		UserId:     row.UserId,
+		Username:   row.Username,
+		Password:   row.Password,
+		HmacSecret: row.HmacSecret,
+		Groups:     groups,
+		Roles:      roles,
+	}, nil
+}
+
+// RoleHierarchy returns the groups and roles of the cached catalog
+func (d *AuthStoreDB) RoleHierarchy() *auth.RoleHierarchy {
+	return d.current().Hierarchy
+}
+
+// lookupColumn maps a UserLookup field to its column
+func lookupColumn(field string) string {
+	if field == "user" {
+		return "username"
+	}
+	return "user_id"
+}
+
+func (d *AuthStoreDB) GetUserAuthInfo(ctx *fiber.Ctx, validator auth.IAuthValidator, userKey string) (auth.IUserAuthInfo, error) {
+	dbCtx := ctx.UserContext()
+
+	var rows []UserRow
+	if provider, ok := validator.(auth.IUserLookupProvider); ok {
+		for _, lookup := range provider.UserLookups(ctx, userKey) {
+			if lookup.Value == "" {
+				continue
+			}
+
+			// Find instead of FindOne, drivers report a missing row as error
+			var found []UserRow
+			filter := []port.DbExpression{{Expr: lookupColumn(lookup.Field), Op: "=", Args: []any{lookup.Value}}}
+			if err := d.Database.Find(dbCtx, &found, d.table(TableUsers), nil, filter, nil, 1, 0); err != nil {
+				return nil, auth.ErrStoreUnavailable.Withf("Load auth user: %v", err)
+			}
+			if len(found) == 0 || found[0].UserId == "" {
+				continue
+			}
+			rows = append(rows, found[0])
+		}
+	} else {
+		// the validator cannot tell which user it is looking for
+		logger.Warn("Validator does not provide user lookups, scanning all users", "validator", validator.Name())
+		if err := d.Database.Find(dbCtx, &rows, d.table(TableUsers), nil, nil, nil, 0, 0); err != nil {
+			return nil, auth.ErrStoreUnavailable.Withf("Load auth users: %v", err)
+		}
+	}
+
+	var err1 error
+	for i := range rows {
+		info, err := d.toUserAuthInfo(dbCtx, &rows[i])
+		if err != nil {
+			return nil, auth.ErrStoreUnavailable.With(err)
+		}
+
+		ok, err := validator.VerifyUser(ctx, userKey, info)
+		if ok {
+			if err == nil {
+				return info, nil
+			} else {
+				err1 = err
+			}
+		}
+	}
+
+	if err1 != nil {
+		return nil, err1
+	}
+
+	return nil, fmt.Errorf("Invalid or expired token %s", userKey)
+}
+
+// UpdatePassword stores an upgraded password hash of the user
+func (d *AuthStoreDB) UpdatePassword(ctx *fiber.Ctx, userInfo auth.IUserAuthInfo, hash string) error {
+	var userId string
+	switch user := userInfo.(type) {
+	case *auth.UserAuthInfoRBAC:
+		userId = user.UserId
+	case *auth.UserAuthInfoABAC:
+		userId = user.UserId
+	}
+
+	if userId == "" {
+		return fmt.Errorf("User has no identifier")
+	}
+
+	filter := []port.DbExpression{{Expr: "user_id", Op: "=", Args: []any{userId}}}
+	_, err := d.Database.UpdateOne(ctx.UserContext(), d.table(TableUsers), filter, map[string]any{"password": hash})
+	return err
+}
+
+func (d *AuthStoreDB) GetResourceInfo(method string, path string) (auth.IResourceInfo, error) {
+	match, ok := d.current().Index.Match(method, path)
+	if !ok {
+		return nil, nil
+	}
+
+	return match.Value, nil
+}
@@ -0,0 +1,102 @@
+package db
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/webcore-go/webcore/app/helper"
+	"github.com/webcore-go/webcore/port"
+	"github.com/webcore-go/webcore/port/auth"
+)
+
+// AuthStoreDB implements auth.IMFAStore on the mfa table
+
+func (d *AuthStoreDB) GetMFA(ctx context.Context, userId string) (*auth.MFAEnrollment, error) {
+	var rows []MFARow
+	filter := []port.DbExpression{{Expr: "user_id", Op: "=", Args: []any{userId}}}
+	if err := d.Database.Find(ctx, &rows, d.table(TableMFA), nil, filter, nil, 1, 0); err != nil {
+		return nil, fmt.Errorf("Load MFA of %s: %v", userId, err)
+	}
+	if len(rows) == 0 {
+		return nil, nil
+	}
+
+	return fromMFARow(&rows[0])
+}
+
+func (d *AuthStoreDB) SaveMFA(ctx context.Context, enrollment *auth.MFAEnrollment) error {
+	row, err := toMFARow(enrollment)
+	if err != nil {
+		return err
+	}
+
+	filter := []port.DbExpression{{Expr: "user_id", Op: "=", Args: []any{row.UserId}}}
+	updated, err := d.Database.UpdateOne(ctx, d.table(TableMFA), filter, map[string]any{
+		"secret":         row.Secret,
+		"pending_secret": row.PendingSecret,
+		"recovery_codes": row.RecoveryCodes,
+		"last_step":      row.LastStep,
+		"confirmed_at":   row.ConfirmedAt,
+	})
+	if err != nil {
+		return fmt.Errorf("Save MFA of %s: %v", row.UserId, err)
+	}
+	if updated > 0 {
+		return nil
+	}
+
+	if _, err := d.Database.InsertOne(ctx, d.table(TableMFA), row); err != nil {
+		return fmt.Errorf("Save MFA of %s: %v", row.UserId, err)
+	}
+	return nil
+}
+
+func (d *AuthStoreDB) DeleteMFA(ctx context.Context, userId string) error {
+	filter := []port.DbExpression{{Expr: "user_id", Op: "=", Args: []any{userId}}}
+	if _, err := d.Database.DeleteOne(ctx, d.table(TableMFA), filter); err != nil {
+		return fmt.Errorf("Delete MFA of %s: %v", userId, err)
+	}
+	return nil
+}
+
+func toMFARow(enrollment *auth.MFAEnrollment) (MFARow, error) {
+	codes := enrollment.RecoveryCodes
+	if codes == nil {
+		codes = []string{}
+	}
+
+	encoded, err := helper.ToJSON(codes)
+	if err != nil {
+		return MFARow{}, err
+	}
+
+	return MFARow{
+		UserId:        enrollment.UserId,
+		Secret:        enrollment.Secret,
+		PendingSecret: enrollment.PendingSecret,
+		RecoveryCodes: encoded,
+		LastStep:      enrollment.LastStep,
+		CreatedAt:     formatTime(&enrollment.CreatedAt),
+		ConfirmedAt:   formatTime(enrollment.ConfirmedAt),
+	}, nil
+}
+
+func fromMFARow(row *MFARow) (*auth.MFAEnrollment, error) {
+	codes, err := decodeList(row.RecoveryCodes, "an MFA enrollment", "recovery_codes")
+	if err != nil {
+		return nil, err
+	}
+
+	enrollment := &auth.MFAEnrollment{
+		UserId:        row.UserId,
+		Secret:        row.Secret,
+		PendingSecret: row.PendingSecret,
+		RecoveryCodes: codes,
+		LastStep:      row.LastStep,
+		ConfirmedAt:   parseTime(row.ConfirmedAt),
+	}
+	if createdAt := parseTime(row.CreatedAt); createdAt != nil {
+		enrollment.CreatedAt = *createdAt
+	}
+	return enrollment, nil
+}
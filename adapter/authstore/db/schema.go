@@ -0,0 +1,249 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/webcore-go/webcore/app/helper"
+	"github.com/webcore-go/webcore/infra/logger"
+	"github.com/webcore-go/webcore/port/auth"
+)
+
+// Table names without prefix
+const (
+	TableUsers     = "users"
+	TableGroups    = "groups"
+	TableRoles     = "roles"
+	TableResources = "resources"
+	TablePolicies  = "policies"
+	TableAPIKeys   = "api_keys"
+	TableMFA       = "mfa"
+)
+
+// Policy owner types in the policies table
+const (
+	OwnerUser     = "user"
+	OwnerResource = "resource"
+)
+
+// List and object columns are stored as JSON text, so the same rows work on
+// SQL databases and document databases.
+
+type UserRow struct {
+	UserId     string  `db:"user_id" bson:"user_id" json:"user_id"`
+	Username   *string `db:"username" bson:"username" json:"username"`
+	Password   *string `db:"password" bson:"password" json:"password"`
+	HmacSecret *string `db:"hmac_secret" bson:"hmac_secret" json:"hmac_secret"` // sealed with auth.hmac.secret_key
+	Groups     string  `db:"user_groups" bson:"user_groups" json:"user_groups"`
+	Roles      string  `db:"user_roles" bson:"user_roles" json:"user_roles"`
+	Attributes string  `db:"attributes" bson:"attributes" json:"attributes"`
+}
+
+type GroupRow struct {
+	Name  string `db:"name" bson:"name" json:"name"`
+	Roles string `db:"group_roles" bson:"group_roles" json:"group_roles"`
+}
+
+type RoleRow struct {
+	Name        string `db:"name" bson:"name" json:"name"`
+	Inherits    string `db:"inherits" bson:"inherits" json:"inherits"`
+	Description string `db:"description" bson:"description" json:"description"`
+}
+
+type ResourceRow struct {
+	Id         string `db:"id" bson:"id" json:"id"`
+	Action     string `db:"action" bson:"action" json:"action"`
+	Method     string `db:"method" bson:"method" json:"method"`
+	Path       string `db:"path" bson:"path" json:"path"`
+	Roles      string `db:"permitted_roles" bson:"permitted_roles" json:"permitted_roles"`
+	Attributes string `db:"attributes" bson:"attributes" json:"attributes"`
+	MFA        bool   `db:"mfa" bson:"mfa" json:"mfa"`
+}
+
+type PolicyRow struct {
+	Id         string `db:"id" bson:"id" json:"id"`
+	OwnerType  string `db:"owner_type" bson:"owner_type" json:"owner_type"` // "user" or "resource"
+	OwnerId    string `db:"owner_id" bson:"owner_id" json:"owner_id"`
+	Effect     string `db:"effect" bson:"effect" json:"effect"`
+	Action     string `db:"action" bson:"action" json:"action"`
+	Conditions string `db:"conditions" bson:"conditions" json:"conditions"`
+}
+
+// Times of APIKeyRow are RFC 3339 text, empty when not set.
+type APIKeyRow struct {
+	Id         string `db:"id" bson:"id" json:"id"`
+	Prefix     string `db:"prefix" bson:"prefix" json:"prefix"`
+	Hash       string `db:"hash" bson:"hash" json:"hash"`
+	UserId     string `db:"user_id" bson:"user_id" json:"user_id"`
+	Name       string `db:"name" bson:"name" json:"name"`
+	Scopes     string `db:"scopes" bson:"scopes" json:"scopes"`
+	CreatedAt  string `db:"created_at" bson:"created_at" json:"created_at"`
+	ExpiresAt  string `db:"expires_at" bson:"expires_at" json:"expires_at"`
+	LastUsedAt string `db:"last_used_at" bson:"last_used_at" json:"last_used_at"`
+	RevokedAt  string `db:"revoked_at" bson:"revoked_at" json:"revoked_at"`
+	ReplacedBy string `db:"replaced_by" bson:"replaced_by" json:"replaced_by"`
+	GraceUntil string `db:"grace_until" bson:"grace_until" json:"grace_until"`
+}
+
+// Secrets of MFARow are base32 text, recovery codes a JSON list of hashes.
+type MFARow struct {
+	UserId        string `db:"user_id" bson:"user_id" json:"user_id"`
+	Secret        string `db:"secret" bson:"secret" json:"secret"`
+	PendingSecret string `db:"pending_secret" bson:"pending_secret" json:"pending_secret"`
+	RecoveryCodes string `db:"recovery_codes" bson:"recovery_codes" json:"recovery_codes"`
+	LastStep      int64  `db:"last_step" bson:"last_step" json:"last_step"`
+	CreatedAt     string `db:"created_at" bson:"created_at" json:"created_at"`
+	ConfirmedAt   string `db:"confirmed_at" bson:"confirmed_at" json:"confirmed_at"`
+}
+
+// sqlExecutor is satisfied by *sql.DB and *sql.Conn
+type sqlExecutor interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+}
+
+// Schema returns the CREATE TABLE statements of the auth tables. The column
+// types are accepted by PostgreSQL, MySQL and SQLite.
+func Schema(prefix string) []string {
+	return []string{
+		fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s%s (
+	user_id VARCHAR(255) NOT NULL PRIMARY KEY,
+	username VARCHAR(255) NULL UNIQUE,
+	password TEXT NULL,
+	hmac_secret TEXT NULL,
+	user_groups TEXT NOT NULL,
+	user_roles TEXT NOT NULL,
+	attributes TEXT NOT NULL
+)`, prefix, TableUsers),
+		fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s%s (
+	name VARCHAR(255) NOT NULL PRIMARY KEY,
+	group_roles TEXT NOT NULL
+)`, prefix, TableGroups),
+		fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s%s (
+	name VARCHAR(255) NOT NULL PRIMARY KEY,
+	inherits TEXT NOT NULL,
+	description TEXT NOT NULL
+)`, prefix, TableRoles),
+		fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s%s (
+	id VARCHAR(64) NOT NULL PRIMARY KEY,
+	action VARCHAR(255) NOT NULL,
+	method VARCHAR(64) NOT NULL,
+	path VARCHAR(1024) NOT NULL,
+	permitted_roles TEXT NOT NULL,
+	attributes TEXT NOT NULL,
+	mfa BOOLEAN NOT NULL DEFAULT FALSE
+)`, prefix, TableResources),
+		fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s%s (
+	id VARCHAR(64) NOT NULL PRIMARY KEY,
+	owner_type VARCHAR(16) NOT NULL,
+	owner_id VARCHAR(255) NOT NULL,
+	effect VARCHAR(16) NOT NULL,
+	action VARCHAR(255) NOT NULL,
+	conditions TEXT NOT NULL
+)`, prefix, TablePolicies),
+		fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s%s (
+	id VARCHAR(64) NOT NULL PRIMARY KEY,
+	prefix VARCHAR(255) NOT NULL,
+	hash VARCHAR(128) NOT NULL,
+	user_id VARCHAR(255) NOT NULL,
+	name VARCHAR(255) NOT NULL,
+	scopes TEXT NOT NULL,
+	created_at VARCHAR(64) NOT NULL,
+	expires_at VARCHAR(64) NOT NULL,
+	last_used_at VARCHAR(64) NOT NULL,
+	revoked_at VARCHAR(64) NOT NULL,
+	replaced_by VARCHAR(64) NOT NULL,
+	grace_until VARCHAR(64) NOT NULL
+)`, prefix, TableAPIKeys),
+		fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s%s (
+	user_id VARCHAR(255) NOT NULL PRIMARY KEY,
+	secret VARCHAR(128) NOT NULL,
+	pending_secret VARCHAR(128) NOT NULL,
+	recovery_codes TEXT NOT NULL,
+	last_step BIGINT NOT NULL,
+	created_at VARCHAR(64) NOT NULL,
+	confirmed_at VARCHAR(64) NOT NULL
+)`, prefix, TableMFA),
+	}
+}
+
+// AddedColumn is a column added to a table after its first release.
+// CREATE TABLE IF NOT EXISTS keeps older tables as they are, so createSchema
+// adds these columns when they are missing.
+type AddedColumn struct {
+	Table      string
+	Column     string
+	Definition string
+}
+
+// AddedColumns lists the columns added to the auth tables, oldest first
+var AddedColumns = []AddedColumn{
+	{Table: TableResources, Column: "mfa", Definition: "BOOLEAN NOT NULL DEFAULT FALSE"},
+	{Table: TableUsers, Column: "hmac_secret", Definition: "TEXT NULL"},
+}
+
+// createSchema creates missing tables and columns when the connection accepts SQL statements.
+// Document databases create collections on first insert, so nothing is needed there.
+func createSchema(ctx context.Context, connection any, prefix string) (bool, error) {
+	executor, ok := connection.(sqlExecutor)
+	if !ok {
+		return false, nil
+	}
+
+	for _, statement := range Schema(prefix) {
+		if _, err := executor.ExecContext(ctx, statement); err != nil {
+			return false, fmt.Errorf("Create auth schema: %v", err)
+		}
+	}
+
+	// MySQL and SQLite have no ADD COLUMN IF NOT EXISTS, a column is added
+	// when selecting it fails
+	for _, added := range AddedColumns {
+		table := prefix + added.Table
+		if _, err := executor.ExecContext(ctx, fmt.Sprintf("SELECT %s FROM %s WHERE 1 = 0", added.Column, table)); err == nil {
+			continue
+		}
+
+		statement := fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", table, added.Column, added.Definition)
+		if _, err := executor.ExecContext(ctx, statement); err != nil {
+			return false, fmt.Errorf("Add column %s to %s: %v", added.Column, table, err)
+		}
+		logger.Info("Auth schema column added", "table", table, "column", added.Column)
+	}
+
+	return true, nil
+}
+
+// The JSON columns are decoded strictly: a malformed column must fail the
+// load, e.g. an Allow policy with unreadable conditions would match every
+// request. row names the row in the error, e.g. "group ops".
+
+func decodeList(value string, row string, column string) ([]string, error) {
+	list := []string{}
+	if value != "" {
+		if err := helper.FromJSON(value, &list); err != nil {
+			return nil, fmt.Errorf("Column %s of %s is not a JSON list: %v", column, row, err)
+		}
+	}
+	return list, nil
+}
+
+func decodeMap(value string, row string, column string) (map[string]any, error) {
+	m := map[string]any{}
+	if value != "" {
+		if err := helper.FromJSON(value, &m); err != nil {
+			return nil, fmt.Errorf("Column %s of %s is not a JSON object: %v", column, row, err)
+		}
+	}
+	return m, nil
+}
+
+func decodeConditions(value string, row string, column string) ([]auth.ConditionABAC, error) {
+	conditions := []auth.ConditionABAC{}
+	if value != "" {
+		if err := helper.FromJSON(value, &conditions); err != nil {
+			return nil, fmt.Errorf("Column %s of %s is not a JSON list of conditions: %v", column, row, err)
+		}
+	}
+	return conditions, nil
+}
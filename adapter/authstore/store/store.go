@@ -1,6 +1,8 @@
 package store
 
 import (
+	"io"
+
 	"github.com/webcore-go/webcore/port/auth"
 )
 
@@ -22,19 +24,35 @@ func (c *StorageABAC) SetDefaults() map[string]any {
 type StorageRBAC struct {
 	Users     []auth.UserAuthInfoRBAC `mapstructure:"users"`
 	Resources []auth.ResourceInfoRBAC `mapstructure:"resources"`
+	Groups    []auth.GroupDef         `mapstructure:"groups"`
+	Roles     []auth.RoleDef          `mapstructure:"roles"`
 }
 
 func (c *StorageRBAC) SetEnvBindings() map[string]string {
-	return map[string]string{"users": "USERS", "resources": "RESOURCES"}
+	return map[string]string{"users": "USERS", "resources": "RESOURCES", "groups": "GROUPS", "roles": "ROLES"}
 }
 
 func (c *StorageRBAC) SetDefaults() map[string]any {
-	return map[string]any{"users": []auth.UserAuthInfoRBAC{}, "resources": []auth.ResourceInfoRBAC{}}
+	return map[string]any{"users": []auth.UserAuthInfoRBAC{}, "resources": []auth.ResourceInfoRBAC{}, "groups": []auth.GroupDef{}, "roles": []auth.RoleDef{}}
 }
 
 type Storage struct {
 	Users     []auth.IUserAuthInfo
 	Resources []auth.IResourceInfo
+	Hierarchy *auth.RoleHierarchy // groups and role inheritance, nil for ABAC
+}
+
+// BuildResourceIndex compiles the resource paths into a route index, so a
+// request is matched against resources the same way the router matches it
+func BuildResourceIndex(resources []auth.IResourceInfo) (*auth.RouteIndex[auth.IResourceInfo], error) {
+	index := auth.NewRouteIndex[auth.IResourceInfo]()
+	for _, info := range resources {
+		if err := index.Add(info.GetMethod(), info.GetPath(), info); err != nil {
+			return nil, err
+		}
+	}
+
+	return index, nil
 }
 
 type AuthStore struct {
@@ -55,7 +73,10 @@ func (y *AuthStore) Install(args ...any) error {
 }
 
 func (y *AuthStore) Uninstall() error {
-	// Tidak melakukan apa-apa
+	// backend yang memantau file atau koneksi ditutup
+	if closer, ok := y.Backend.(io.Closer); ok {
+		return closer.Close()
+	}
 	return nil
 }
 
@@ -2,12 +2,19 @@ package yaml
 
 import (
 	"fmt"
+	"path/filepath"
 	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 
+	"github.com/fsnotify/fsnotify"
 	"github.com/gofiber/fiber/v2"
 	"github.com/webcore-go/webcore/adapter/authstore/store"
+	"github.com/webcore-go/webcore/app/core"
 	"github.com/webcore-go/webcore/infra/config"
 	appConfig "github.com/webcore-go/webcore/infra/config"
+	"github.com/webcore-go/webcore/infra/logger"
 	"github.com/webcore-go/webcore/port"
 	"github.com/webcore-go/webcore/port/auth"
 )
@@ -25,12 +32,20 @@ func (a *YamlLoader) Name() string {
 }
 
 func (l *YamlLoader) Init(args ...any) (port.Library, error) {
+	context := args[0].(*core.AppContext)
 	config := args[1].(config.AuthConfig)
 	backend, err := YamlBackend(config.Control)
 	if err != nil {
 		return nil, err
 	}
 
+	if config.YAML.Watch {
+		backend.Events = context.EventBus
+		if err := backend.Watch(config.YAML.Debounce); err != nil {
+			return nil, err
+		}
+	}
+
 	store := &store.AuthStore{}
 	store.SetBackend(backend)
 	err = store.Install(args...)
@@ -41,68 +56,278 @@ func (l *YamlLoader) Init(args ...any) (port.Library, error) {
 	return store, nil
 }
 
+// snapshot is one complete version of access.yaml, requests always see a whole snapshot
+type snapshot struct {
+	Storage  *store.Storage
+	Index    *auth.RouteIndex[auth.IResourceInfo]
+	LoadedAt time.Time
+}
+
 type AuthStoreYAML struct {
 	ControlType string
-	// Validator   auth.IAuthValidator
-	Storage *store.Storage
-	Loaded  bool
+	Path        string         // file that was loaded, empty when access.yaml does not exist
+	Events      *core.EventBus // receives auth.store.reloaded, may be nil
+
+	data    atomic.Pointer[snapshot]
+	watcher *fsnotify.Watcher
+	mu      sync.Mutex
 }
 
 func YamlBackend(control string) (*AuthStoreYAML, error) {
 	y := &AuthStoreYAML{
 		ControlType: control,
-		Storage: &store.Storage{
-			Users:     make([]auth.IUserAuthInfo, 0),
-			Resources: make([]auth.IResourceInfo, 0),
-		},
-		Loaded: false,
+	}
+
+	// the first load goes through the config loader, so defaults and environment variables apply
+	data, err := buildSnapshot(control, func(target appConfig.Configurable) error {
+		return appConfig.LoadConfig("access", target, "access", "yaml", []string{})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if holder := appConfig.InstanceViper["access.yaml"]; holder != nil {
+		if path := holder.Engine.ConfigFileUsed(); path != "" {
+			y.Path, _ = filepath.Abs(path)
+		}
+	}
+
+	y.data.Store(data)
+	return y, nil
+}
+
+// buildSnapshot decodes and validates the content of access.yaml
+func buildSnapshot(control string, decode func(target appConfig.Configurable) error) (*snapshot, error) {
+	storage := &store.Storage{
+		Users:     make([]auth.IUserAuthInfo, 0),
+		Resources: make([]auth.IResourceInfo, 0),
 	}
 
 	switch control {
 	case "ABAC":
 		var tmp store.StorageABAC
-		if err := appConfig.LoadConfig("access", &tmp, "access", "yaml", []string{}); err != nil {
+		if err := decode(&tmp); err != nil {
 			return nil, err
 		}
 
 		// Convert from concrete slice to interface slice
-		y.Storage.Users = make([]auth.IUserAuthInfo, len(tmp.Users))
+		storage.Users = make([]auth.IUserAuthInfo, len(tmp.Users))
 		for i := range tmp.Users {
-			y.Storage.Users[i] = &tmp.Users[i]
+			storage.Users[i] = &tmp.Users[i]
 		}
-		y.Storage.Resources = make([]auth.IResourceInfo, len(tmp.Resources))
+		storage.Resources = make([]auth.IResourceInfo, len(tmp.Resources))
 		for i := range tmp.Resources {
-			y.Storage.Resources[i] = &tmp.Resources[i]
+			storage.Resources[i] = &tmp.Resources[i]
 		}
 	default:
 		var tmp store.StorageRBAC
-		if err := appConfig.LoadConfig("access", &tmp, "access", "yaml", []string{}); err != nil {
+		if err := decode(&tmp); err != nil {
 			return nil, err
 		}
 
-		y.Storage.Users = make([]auth.IUserAuthInfo, len(tmp.Users))
+		storage.Users = make([]auth.IUserAuthInfo, len(tmp.Users))
 		for i := range tmp.Users {
-			y.Storage.Users[i] = &tmp.Users[i]
+			storage.Users[i] = &tmp.Users[i]
 		}
-		y.Storage.Resources = make([]auth.IResourceInfo, len(tmp.Resources))
+		storage.Resources = make([]auth.IResourceInfo, len(tmp.Resources))
 		for i := range tmp.Resources {
-			y.Storage.Resources[i] = &tmp.Resources[i]
+			storage.Resources[i] = &tmp.Resources[i]
 		}
+
+		hierarchy, err := auth.NewRoleHierarchy(tmp.Groups, tmp.Roles)
+		if err != nil {
+			return nil, err
+		}
+		storage.Hierarchy = hierarchy
 	}
 
-	y.Loaded = true
-	return y, nil
+	if err := validateStorage(storage); err != nil {
+		return nil, err
+	}
+
+	index, err := store.BuildResourceIndex(storage.Resources)
+	if err != nil {
+		return nil, err
+	}
+
+	return &snapshot{
+		Storage:  storage,
+		Index:    index,
+		LoadedAt: time.Now(),
+	}, nil
 }
 
-func (y *AuthStoreYAML) GetUserAuthInfo(ctx *fiber.Ctx, validator auth.IAuthValidator) (auth.IUserAuthInfo, error) {
-	if !y.Loaded {
-		return nil, fmt.Errorf("File access.yaml gagal dimuat")
+// validateStorage rejects content that would make users ambiguous or policies unusable
+func validateStorage(storage *store.Storage) error {
+	keys := make(map[string]bool)
+	usernames := make(map[string]bool)
+	check := func(key string, username *string, policies []auth.PolicyABAC) error {
+		if key != "" {
+			if keys[key] {
+				return fmt.Errorf("Duplicate user key %s", key)
+			}
+			keys[key] = true
+		}
+		if username != nil && *username != "" {
+			if usernames[*username] {
+				return fmt.Errorf("Duplicate user %s", *username)
+			}
+			usernames[*username] = true
+		}
+		return validatePolicies(policies)
 	}
 
-	userKey := validator.GetValue()
+	for _, info := range storage.Users {
+		var err error
+		switch user := info.(type) {
+		case *auth.UserAuthInfoRBAC:
+			err = check(user.UserId, user.Username, nil)
+		case *auth.UserAuthInfoABAC:
+			err = check(user.UserId, user.Username, user.Policies)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, info := range storage.Resources {
+		if info.GetPath() == "" {
+			return fmt.Errorf("Resource %s has no path", info.GetAction())
+		}
+		if resource, ok := info.(*auth.ResourceInfoABAC); ok {
+			if err := validatePolicies(resource.PermittedPolicies); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func validatePolicies(policies []auth.PolicyABAC) error {
+	for _, policy := range policies {
+		if !strings.EqualFold(policy.Effect, auth.EffectAllow) && !strings.EqualFold(policy.Effect, auth.EffectDeny) {
+			return fmt.Errorf("Unknown policy effect %s", policy.Effect)
+		}
+	}
+	return nil
+}
+
+// Reload reads the file again. The current data is kept when the new content is invalid.
+func (y *AuthStoreYAML) Reload() error {
+	y.mu.Lock()
+	defer y.mu.Unlock()
+
+	if y.Path == "" {
+		return fmt.Errorf("File access.yaml tidak ditemukan")
+	}
+
+	// same loader as the first load, so defaults and environment variables still apply
+	data, err := buildSnapshot(y.ControlType, func(target appConfig.Configurable) error {
+		return appConfig.ReloadConfig("access", target, "access", "yaml", []string{})
+	})
+	if err != nil {
+		return fmt.Errorf("Reload %s: %v", y.Path, err)
+	}
+
+	y.data.Store(data)
+
+	if y.Events != nil {
+		y.Events.Publish(auth.EventStoreReloaded, auth.StoreReloaded{
+			Store:     "yaml",
+			Source:    y.Path,
+			Users:     len(data.Storage.Users),
+			Resources: len(data.Storage.Resources),
+			LoadedAt:  data.LoadedAt,
+		})
+	}
+
+	return nil
+}
+
+// Watch reloads the file after it changes. The directory is watched, so files
+// replaced by editors or by a Kubernetes ConfigMap update are noticed as well.
+func (y *AuthStoreYAML) Watch(debounce time.Duration) error {
+	if y.Path == "" {
+		logger.Info("File access.yaml tidak ditemukan, perubahan tidak dipantau")
+		return nil
+	}
+
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+	if err := watcher.Add(filepath.Dir(y.Path)); err != nil {
+		watcher.Close()
+		return err
+	}
+	y.watcher = watcher
+
+	realPath, _ := filepath.EvalSymlinks(y.Path)
+
+	go func() {
+		var timer *time.Timer
+		for {
+			select {
+			case event, ok := <-watcher.Events:
+				if !ok {
+					return
+				}
+
+				// a ConfigMap update swaps a symlink instead of writing the file
+				target, _ := filepath.EvalSymlinks(y.Path)
+				if filepath.Clean(event.Name) != y.Path && target == realPath {
+					continue
+				}
+				realPath = target
+
+				if timer != nil {
+					timer.Stop()
+				}
+				timer = time.AfterFunc(debounce, func() {
+					if err := y.Reload(); err != nil {
+						logger.Error("Reload auth store failed, keep using previous data", "error", err)
+						return
+					}
+					logger.Info("Auth store reloaded", "file", y.Path)
+				})
+			case err, ok := <-watcher.Errors:
+				if !ok {
+					return
+				}
+				logger.Warn("Watch access.yaml failed", "error", err)
+			}
+		}
+	}()
+
+	return nil
+}
+
+// Close stops watching the file
+func (y *AuthStoreYAML) Close() error {
+	if y.watcher == nil {
+		return nil
+	}
+	return y.watcher.Close()
+}
+
+// RoleHierarchy returns the groups and roles of the current file
+func (y *AuthStoreYAML) RoleHierarchy() *auth.RoleHierarchy {
+	data := y.data.Load()
+	if data == nil {
+		return nil
+	}
+	return data.Storage.Hierarchy
+}
+
+func (y *AuthStoreYAML) GetUserAuthInfo(ctx *fiber.Ctx, validator auth.IAuthValidator, userKey string) (auth.IUserAuthInfo, error) {
+	data := y.data.Load()
+	if data == nil {
+		return nil, fmt.Errorf("File access.yaml gagal dimuat")
+	}
 
 	var err1 error
-	for _, info := range y.Storage.Users {
+	for _, info := range data.Storage.Users {
 		ok, err := validator.VerifyUser(ctx, userKey, info)
 		if ok {
 			if err == nil {
@@ -120,33 +345,16 @@ func (y *AuthStoreYAML) GetUserAuthInfo(ctx *fiber.Ctx, validator auth.IAuthVali
 	return nil, fmt.Errorf("Invalid or expired token %s", userKey)
 }
 
-func (y *AuthStoreYAML) cleanPath(infoPath string) string {
-	// Remove parametes (everything after fist '/:')
-	if idx := strings.Index(infoPath, "/:"); idx != -1 {
-		infoPath = infoPath[:idx]
-	}
-
-	// Remove query string (everything after '?')
-	if idx := strings.Index(infoPath, "?"); idx != -1 {
-		infoPath = infoPath[:idx]
-	}
-
-	return infoPath
-}
-
 func (y *AuthStoreYAML) GetResourceInfo(method string, path string) (auth.IResourceInfo, error) {
-	if !y.Loaded {
+	data := y.data.Load()
+	if data == nil {
 		return nil, fmt.Errorf("File access.yaml gagal dimuat")
 	}
 
-	for _, info := range y.Storage.Resources {
-		infoPath := info.GetPath()
-		cleanedInfoPath := y.cleanPath(infoPath)
-
-		if method == info.GetMethod() && strings.HasPrefix(path, cleanedInfoPath) {
-			return info, nil
-		}
+	match, ok := data.Index.Match(method, path)
+	if !ok {
+		return nil, nil
 	}
 
-	return nil, nil
+	return match.Value, nil
 }
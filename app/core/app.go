@@ -2,14 +2,18 @@ package core
 
 import (
 	"context"
+	"crypto/tls"
 	"fmt"
 	"log"
+	"slices"
+	"strings"
 	"sync/atomic"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/webcore-go/webcore/infra/config"
 	"github.com/webcore-go/webcore/infra/logger"
 	"github.com/webcore-go/webcore/infra/middleware"
+	"github.com/webcore-go/webcore/port"
 	"github.com/webcore-go/webcore/port/auth"
 )
 
@@ -46,11 +50,13 @@ func NewApp(ctx context.Context, cfg *config.Config, loaders map[string]LibraryL
 
 	app := &App{
 		Context: &AppContext{
-			Context:  ctx,
-			Config:   cfg,
-			Web:      nil,
-			Root:     nil,
-			EventBus: NewEventBus(),
+			Context:     ctx,
+			Config:      cfg,
+			Web:         nil,
+			Root:        nil,
+			EventBus:    NewEventBus(),
+			Security:    auth.NewSecurityRegistry(),
+			RowSecurity: auth.NewRowSecurity(),
 		},
 		ModuleManager:  manModule,
 		LibraryManager: manLibrary,
@@ -84,8 +90,33 @@ func (a *App) Start() error {
 	// Setup routes
 	a.setupRoutes()
 
+	// Anonymous and optional authentication routes from config
+	if err := a.setupAccessRules(); err != nil {
+		return err
+	}
+
+	// Protected routes without authorization rule
+	if err := a.reportRouteCoverage(); err != nil {
+		return err
+	}
+
 	// Start server
 	addr := fmt.Sprintf("%s:%d", a.Context.Config.Server.Host, a.Context.Config.Server.Port)
+	if a.Context.Config.Server.TLS.Enabled {
+		tlsConfig, err := NewTLSConfig(a.Context.Config.Server.TLS)
+		if err != nil {
+			return err
+		}
+
+		listener, err := tls.Listen("tcp", addr, tlsConfig)
+		if err != nil {
+			return err
+		}
+
+		log.Printf("Server starting on %s (TLS, client certificates: %s)", addr, a.Context.Config.Server.TLS.ClientAuth)
+		return a.Context.Web.Listener(listener)
+	}
+
 	log.Printf("Server starting on %s", addr)
 
 	return a.Context.Web.Listen(addr)
@@ -112,31 +143,357 @@ func (a *App) setupGlobalMiddleware() {
 
 func (a *App) setupAuthMiddleware() {
 	var handler fiber.Handler
-	if a.Context.Config.Auth.Type == "none" {
+	var schemes []auth.IAuthScheme
+	var chain *auth.SchemeChain
+	types := a.Context.Config.Auth.Type
+	if len(types) == 0 || slices.Contains(types, "none") {
 		handler = func(c *fiber.Ctx) error {
 			return c.Next()
 		}
 	} else {
-		// lName := "authentication:" + a.Context.Config.Auth.Type
-		// loader, ok := a.LibraryManager.GetLoader(lName)
-		loader, e := a.Context.GetDefaultLibraryLoader("authentication")
-		if e != nil {
-			logger.Fatal(e.Error())
+		// the JWT login endpoint of the loaders below counts failures as well
+		a.Context.Lockout = a.setupLockout()
+		a.Context.Revocation = a.setupRevocation()
+		a.Context.MFA = a.setupMFA()
+
+		// every configured type is loaded, the order of auth.type is kept
+		for _, authType := range types {
+			loader, e := a.Context.GetLibraryLoader("authentication:" + authType)
+			if e != nil {
+				logger.Fatal(e.Error())
+			}
+
+			// Initialize module components
+			library, err := a.LibraryManager.LoadSingletonFromLoader(loader, a.Context, a.Context.Config.Auth)
+			if err != nil {
+				logger.Fatal("Setup Authentication middleware", "type", authType, "error", err)
+			}
+
+			scheme, ok := library.(auth.IAuthScheme)
+			if !ok {
+				logger.Fatal("Authentication library does not implement IAuthScheme", "type", authType)
+			}
+			schemes = append(schemes, scheme)
 		}
 
-		// Initialize module components
-		library, err := a.LibraryManager.LoadSingletonFromLoader(loader, a.Context, a.Context.Config.Auth)
+		chain = auth.NewSchemeChain(schemes, a.Context.Security)
+		chain.Audit = a.setupAudit()
+		chain.Lockout = a.Context.Lockout
+		chain.Impersonation = a.setupImpersonation()
+		handler = chain.Handler()
+	}
+
+	// Apply authentication to protected routes
+	a.Context.Root = a.Context.Web.Group(a.Context.Config.Server.PathPrefix, handler)
+
+	// endpoints of the schemes, e.g. key management, are protected as well
+	for _, scheme := range schemes {
+		if registrar, ok := scheme.(auth.IRouteRegistrar); ok {
+			registrar.RegisterRoutes(a.Context.Root)
+		}
+	}
+
+	// authorization dry run for admins and the permissions of the current user
+	if chain != nil {
+		NewExplainHandler(a, chain).Register(a.Context.Root)
+	}
+
+	if a.Context.Revocation != nil {
+		NewRevocationHandler(a.Context.Revocation).Register(a.Context.Root, a.Context.Config.Auth.Revocation)
+	}
+
+	if a.Context.MFA != nil {
+		NewMFAHandler(a.Context.MFA).Register(a.Context.Root, a.Context.Config.Auth.MFA)
+	}
+}
+
+// setupAudit loads the audit log when auth.audit.sinks is set
+func (a *App) setupAudit() *auth.Auditor {
+	if len(a.Context.Config.Auth.Audit.Sinks) == 0 {
+		return nil
+	}
+
+	loader, err := a.Context.GetLibraryLoader("authaudit")
+	if err != nil {
+		logger.Fatal(err.Error())
+	}
+
+	library, err := a.LibraryManager.LoadSingletonFromLoader(loader, a.Context, a.Context.Config.Auth)
+	if err != nil {
+		logger.Fatal("Setup audit log", "error", err)
+	}
+
+	auditor, ok := library.(*auth.Auditor)
+	if !ok {
+		logger.Fatal("Audit library does not return an auth.Auditor", "loader", loader.Name())
+	}
+
+	return auditor
+}
+
+// setupLockout creates the brute-force protection when auth.lockout.enabled is set
+func (a *App) setupLockout() *auth.Lockout {
+	config := a.Context.Config.Auth.Lockout
+	if !config.Enabled {
+		return nil
+	}
+
+	var store auth.ILockoutStore
+	switch config.Store {
+	case "", "memory":
+		store = auth.NewMemoryLockoutStore()
+	case "cache":
+		cacheStore, err := auth.NewCacheLockoutStore(a.memoryCache("lockout"))
+		if err != nil {
+			logger.Fatal("Setup auth lockout", "error", err)
+		}
+		store = cacheStore
+	default:
+		logger.Fatal("Unknown auth lockout store", "store", config.Store)
+	}
+
+	lockout := auth.NewLockout(auth.LockoutPolicy{
+		MaxFailures:   config.MaxFailures,
+		IPMaxFailures: config.IPMaxFailures,
+		Window:        config.Window,
+		Duration:      config.Duration,
+		MaxDuration:   config.MaxDuration,
+		BanDuration:   config.BanDuration,
+		CaptchaAfter:  config.CaptchaAfter,
+		ResetAfter:    config.ResetAfter,
+	}, store)
+	lockout.Publish = a.Context.EventBus.Publish
+
+	return lockout
+}
+
+// setupRevocation creates the token revocation when auth.revocation.enabled is set
+func (a *App) setupRevocation() *auth.Revocation {
+	config := a.Context.Config.Auth.Revocation
+	if !config.Enabled {
+		return nil
+	}
+
+	// entries of single tokens are kept as long as the longest token or session lives
+	maxLifetime := max(a.Context.Config.Auth.ExpiresIn, a.Context.Config.Auth.JWT.RefreshExpiresIn, a.Context.Config.Auth.Session.AbsoluteTimeout)
+
+	var revocation *auth.Revocation
+	switch config.Store {
+	case "", "memory":
+		revocation = auth.NewRevocation(auth.NewMemoryRevocationStore(), maxLifetime)
+	case "cache":
+		store, err := auth.NewCacheRevocationStore(a.memoryCache("revocation"))
 		if err != nil {
-			logger.Fatal("Setup Authentication middleware", "error", err)
+			logger.Fatal("Setup auth revocation", "error", err)
 		}
+		revocation = auth.NewRevocation(store, maxLifetime)
+		revocation.EnableCache(config.CacheSize, config.CacheTTL)
+	default:
+		logger.Fatal("Unknown auth revocation store", "store", config.Store)
+	}
+
+	revocation.FailClosed = config.FailClosed
+	revocation.Publish = a.Context.EventBus.Publish
+
+	return revocation
+}
 
-		authn := library.(auth.IAuthenticationManager)
-		handler = authn.GetAuthenticatonHandler()
+// setupMFA creates the TOTP second factor when auth.mfa.enabled is set
+func (a *App) setupMFA() *auth.MFA {
+	config := a.Context.Config.Auth.MFA
+	if !config.Enabled {
+		return nil
 	}
 
-	// Apply authentication to protected routes
-	a.Context.Root = a.Context.Web.Group(a.Context.Config.Server.PathPrefix, handler)
+	loader, err := a.Context.GetDefaultLibraryLoader("authstorage")
+	if err != nil {
+		logger.Fatal(err.Error())
+	}
+
+	library, err := a.LibraryManager.LoadSingletonFromLoader(loader, a.Context, a.Context.Config.Auth)
+	if err != nil {
+		logger.Fatal("Setup auth MFA", "error", err)
+	}
+
+	authstore, ok := library.(auth.IAuthStore)
+	if !ok {
+		logger.Fatal("Library does not implement IAuthStore", "loader", loader.Name())
+	}
+
+	// enrollments live in the auth store when it has an mfa table, otherwise in a JSON file
+	store, ok := authstore.GetStore().(auth.IMFAStore)
+	if !ok {
+		if config.File == "" {
+			logger.Fatal("Auth store has no mfa table, set auth.mfa.file")
+		}
+		fileStore, err := NewFileMFAStore(config.File)
+		if err != nil {
+			logger.Fatal("Setup auth MFA", "error", err)
+		}
+		store = fileStore
+	}
+
+	issuer := config.Issuer
+	if issuer == "" {
+		issuer = a.Context.Config.App.Name
+	}
+
+	mfa := auth.NewMFA(store, issuer)
+	mfa.Skew = config.Skew
+	mfa.MaxAge = config.MaxAge
+	mfa.Header = config.Header
+	mfa.HeaderSchemes = config.HeaderSchemes
+	mfa.RecoveryCodes = config.RecoveryCodes
+	mfa.Publish = a.Context.EventBus.Publish
+
+	return mfa
+}
+
+// setupImpersonation enables the act-as header when auth.impersonation.enabled is set
+func (a *App) setupImpersonation() *auth.Impersonation {
+	config := a.Context.Config.Auth.Impersonation
+	if !config.Enabled {
+		return nil
+	}
+
+	if config.Header == "" || len(config.Roles) == 0 {
+		logger.Fatal("auth.impersonation requires header and roles")
+	}
+
+	impersonation := auth.NewImpersonation(config.Header, config.Roles)
+	impersonation.ProtectedRoles = config.ProtectedRoles
+
+	return impersonation
+}
+
+// memoryCache returns the redis library for the cache stores of lockout and revocation
+func (a *App) memoryCache(feature string) port.IMemoryCache {
+	library, ok := a.Context.GetSingletonInstance("redis")
+	if !ok {
+		library, ok = a.Context.GetSingletonInstance("cache:redis")
+	}
+	cache, isCache := library.(port.IMemoryCache)
+	if !ok || !isCache {
+		logger.Fatal("Auth store cache requires a memory cache library, configure redis", "feature", feature)
+	}
+	return cache
+}
+
+// setupAccessRules registers auth.public and auth.optional in the security registry
+func (a *App) setupAccessRules() error {
+	rules := []struct {
+		entries  []string
+		security *auth.RouteSecurity
+	}{
+		{a.Context.Config.Auth.Public, &auth.RouteSecurity{Public: true}},
+		{a.Context.Config.Auth.Optional, &auth.RouteSecurity{Optional: true}},
+		{a.Context.Config.Auth.Impersonation.Forbidden, &auth.RouteSecurity{NoImpersonation: true}},
+	}
+
+	for _, rule := range rules {
+		for _, entry := range rule.entries {
+			// "module:<name>" selects every route of a module
+			if name, ok := strings.CutPrefix(entry, "module:"); ok {
+				module, err := a.ModuleManager.GetModule(name)
+				if err != nil {
+					return fmt.Errorf("Auth access rule %s: %v", entry, err)
+				}
+
+				for _, route := range module.Routes() {
+					if err := a.Context.Security.Allow(route.Method, route.FullPath(), rule.security); err != nil {
+						return fmt.Errorf("Auth access rule %s: %v", entry, err)
+					}
+				}
+				continue
+			}
+
+			// "GET /api/catalog/*" or "/api/catalog/*" for all methods
+			method, pattern := "*", entry
+			if fields := strings.Fields(entry); len(fields) == 2 {
+				method, pattern = fields[0], fields[1]
+			}
+
+			if err := a.Context.Security.Allow(method, pattern, rule.security); err != nil {
+				return fmt.Errorf("Auth access rule %s: %v", entry, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// UncoveredRoutes returns the protected module routes that have neither a
+// resource in the auth store nor an authorization rule on the route, its
+// group or the allowlist
+func (a *App) UncoveredRoutes() ([]*ModuleRoute, error) {
+	types := a.Context.Config.Auth.Type
+	if len(types) == 0 || slices.Contains(types, "none") {
+		return nil, nil
+	}
+
+	loader, err := a.Context.GetDefaultLibraryLoader("authstorage")
+	if err != nil {
+		return nil, err
+	}
+
+	library, err := a.LibraryManager.LoadSingletonFromLoader(loader, a.Context, a.Context.Config.Auth)
+	if err != nil {
+		return nil, err
+	}
+
+	authstore, ok := library.(auth.IAuthStore)
+	if !ok {
+		return nil, fmt.Errorf("Library %s does not implement IAuthStore", loader.Name())
+	}
+	store := authstore.GetStore()
+
+	prefix := a.Context.Config.Server.PathPrefix
+	var uncovered []*ModuleRoute
+	for _, route := range a.ModuleManager.GetRoutes() {
+		path := route.FullPath()
+		// routes outside the prefix do not pass the authentication middleware
+		if !strings.HasPrefix(path, prefix) {
+			continue
+		}
+
+		if a.Context.Security.IsCovered(route.Method, path) {
+			continue
+		}
+
+		resource, err := store.GetResourceInfo(route.Method, path)
+		if err != nil {
+			return nil, err
+		}
+		if resource == nil {
+			uncovered = append(uncovered, route)
+		}
+	}
+
+	return uncovered, nil
+}
+
+// reportRouteCoverage logs the routes without authorization rule, with
+// auth.strict the application does not start when there are any
+func (a *App) reportRouteCoverage() error {
+	uncovered, err := a.UncoveredRoutes()
+	if err != nil {
+		return fmt.Errorf("Auth route coverage: %v", err)
+	}
+	if len(uncovered) == 0 {
+		return nil
+	}
+
+	policy := a.Context.Config.Auth.DefaultPolicy
+	for _, route := range uncovered {
+		logger.Warn("Route has no authorization rule", "method", route.Method, "path", route.FullPath(), "default_policy", policy)
+	}
+	logger.Warn("Auth route coverage", "uncovered", len(uncovered), "routes", len(a.ModuleManager.GetRoutes()))
+
+	if a.Context.Config.Auth.Strict {
+		return fmt.Errorf("auth.strict: %d routes have no authorization rule", len(uncovered))
+	}
 
+	return nil
 }
 
 // setupRoutes sets up application routes
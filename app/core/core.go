@@ -6,7 +6,10 @@ import (
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/webcore-go/webcore/infra/config"
+	"github.com/webcore-go/webcore/infra/logger"
+	"github.com/webcore-go/webcore/infra/middleware"
 	"github.com/webcore-go/webcore/port"
+	"github.com/webcore-go/webcore/port/auth"
 )
 
 // Context represents shared dependencies that can be injected into modules
@@ -16,6 +19,13 @@ type AppContext struct {
 	Web      *fiber.App
 	Root     fiber.Router
 	EventBus *EventBus
+	Security *auth.SecurityRegistry // security metadata of module routes
+	Lockout  *auth.Lockout          // brute-force protection, nil when auth.lockout.enabled is false
+
+	Revocation *auth.Revocation // revoked tokens and sessions, nil when auth.revocation.enabled is false
+	MFA        *auth.MFA        // TOTP second factor, nil when auth.mfa.enabled is false
+
+	RowSecurity *auth.RowSecurity // row policies of the tables, applied by SecureDatabase
 }
 
 func (a *AppContext) Start() error {
@@ -135,6 +145,22 @@ func (a *AppContext) GetDefaultInstance(name string, key string) (port.Library,
 	return a.GetInstance(a.getDefaultName(name), key)
 }
 
+// SecureDatabase returns the default database filtered by the row policies
+// of the principal in the query context, see auth.SystemContext for jobs
+func (a *AppContext) SecureDatabase() (port.IDatabase, error) {
+	library, ok := a.GetDefaultSingletonInstance("database")
+	if !ok {
+		return nil, fmt.Errorf("Library '%s' tidak ditemukan", a.getDefaultName("database"))
+	}
+
+	database, ok := library.(port.IDatabase)
+	if !ok {
+		return nil, fmt.Errorf("Library %s does not implement IDatabase", a.getDefaultName("database"))
+	}
+
+	return auth.NewSecureDatabase(database, a.RowSecurity), nil
+}
+
 func (a *AppContext) getDefaultName(name string) string {
 	switch name {
 	case "database":
@@ -142,14 +168,49 @@ func (a *AppContext) getDefaultName(name string) string {
 	case "authstorage":
 		name = name + ":" + a.Config.Auth.Store
 	case "authentication":
-		name = name + ":" + a.Config.Auth.Type
+		// the first of the configured authentication types
+		if len(a.Config.Auth.Type) > 0 {
+			name = name + ":" + a.Config.Auth.Type[0]
+		}
 	}
 	return name
 }
 
 func AppendRouteToArray(routes []*ModuleRoute, route *ModuleRoute) []*ModuleRoute {
-	route.Root.Add(route.Method, route.Path, route.Handler)
+	if route.Security == nil {
+		route.Root.Add(route.Method, route.Path, route.Handler)
+	} else {
+		registerRouteSecurity(route)
+		route.Root.Add(route.Method, route.Path, middleware.Secure(route.Security), route.Handler)
+	}
 
 	routes = append(routes, route)
 	return routes
 }
+
+// registerRouteSecurity makes the route metadata visible to the authentication middleware
+func registerRouteSecurity(route *ModuleRoute) {
+	app := Instance()
+	if app == nil || app.Context.Security == nil {
+		return
+	}
+
+	if err := app.Context.Security.Register(route.Method, route.FullPath(), route.Security); err != nil {
+		logger.Warn("Register route security failed", "error", err)
+	}
+}
+
+// SecureGroup applies security metadata to every route of a group. Schemes and
+// Public are used by the authentication middleware, the other requirements
+// are enforced by a group middleware.
+func SecureGroup(group fiber.Router, security *auth.RouteSecurity) {
+	if app := Instance(); app != nil && app.Context.Security != nil {
+		if g, ok := group.(*fiber.Group); ok {
+			if err := app.Context.Security.RegisterGroup(g.Prefix, security); err != nil {
+				logger.Warn("Register group security failed", "error", err)
+			}
+		}
+	}
+
+	group.Use(middleware.Secure(security))
+}
@@ -1,10 +1,13 @@
 package core
 
+import "sync"
+
 // EventBus represents shared event bus
 type EventBus struct {
 	// This is a simplified implementation
 	// In a real scenario, you would use a proper message bus
 	subscribers map[string][]func(any)
+	mu          sync.RWMutex
 }
 
 // NewEventBus creates a new event bus instance
@@ -16,19 +19,25 @@ func NewEventBus() *EventBus {
 
 // Subscribe subscribes to an event
 func (eb *EventBus) Subscribe(event string, handler func(any)) {
+	eb.mu.Lock()
+	defer eb.mu.Unlock()
 	eb.subscribers[event] = append(eb.subscribers[event], handler)
 }
 
-// Publish publishes an event
+// Publish publishes an event. It is safe to publish from background goroutines.
 func (eb *EventBus) Publish(event string, data any) {
-	if handlers, exists := eb.subscribers[event]; exists {
-		for _, handler := range handlers {
-			handler(data)
-		}
+	eb.mu.RLock()
+	handlers := eb.subscribers[event]
+	eb.mu.RUnlock()
+
+	for _, handler := range handlers {
+		handler(data)
 	}
 }
 
 // GetSubscribers returns the number of subscribers for an event
 func (eb *EventBus) GetSubscribers(event string) int {
+	eb.mu.RLock()
+	defer eb.mu.RUnlock()
 	return len(eb.subscribers[event])
 }
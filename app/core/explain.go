@@ -0,0 +1,175 @@
+package core
+
+import (
+	"slices"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/valyala/fasthttp"
+	"github.com/webcore-go/webcore/app/out"
+	"github.com/webcore-go/webcore/infra/logger"
+	"github.com/webcore-go/webcore/port/auth"
+)
+
+// Permission is a route the current user may call
+type Permission struct {
+	Method string `json:"method"`
+	Path   string `json:"path"`
+	Action string `json:"action,omitempty"`
+	Public bool   `json:"public,omitempty"`
+}
+
+// ExplainHandler serves the authorization dry run endpoints
+type ExplainHandler struct {
+	App   *App
+	Chain *auth.SchemeChain
+}
+
+func NewExplainHandler(app *App, chain *auth.SchemeChain) *ExplainHandler {
+	return &ExplainHandler{
+		App:   app,
+		Chain: chain,
+	}
+}
+
+// Register mounts the endpoints below the protected prefix. The explain
+// endpoint is limited to the admin roles, every authenticated user may list
+// the own permissions.
+func (h *ExplainHandler) Register(root fiber.Router) {
+	config := h.App.Context.Config.Auth.Explain
+
+	// without admin roles the route would be open to every authenticated user
+	if config.Path != "" && len(config.AdminRoles) == 0 {
+		logger.Error("auth.explain.admin_roles is empty, the explain endpoint is not registered")
+	} else if config.Path != "" {
+		AppendRouteToArray(nil, &ModuleRoute{
+			Method:   fiber.MethodPost,
+			Path:     config.Path,
+			Handler:  h.Explain,
+			Root:     root,
+			Security: &auth.RouteSecurity{Roles: config.AdminRoles},
+		})
+	}
+
+	if config.PermissionsPath != "" {
+		// optional, so the route has a rule under auth.default_policy deny;
+		// anonymous requests are rejected by the handler
+		AppendRouteToArray(nil, &ModuleRoute{
+			Method:   fiber.MethodGet,
+			Path:     config.PermissionsPath,
+			Handler:  h.Permissions,
+			Root:     root,
+			Security: &auth.RouteSecurity{Optional: true},
+		})
+	}
+}
+
+// Explain runs the authorization of a request as a dry run, for a user of
+// the store or for the credential headers of the request
+func (h *ExplainHandler) Explain(c *fiber.Ctx) error {
+	var req auth.ExplainRequest
+	if err := c.BodyParser(&req); err != nil || req.Method == "" || req.Path == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(out.Error(fiber.StatusBadRequest, 1, "BAD_REQUEST", "method and path are required"))
+	}
+	if (req.User == "") == (len(req.Headers) == 0) {
+		return c.Status(fiber.StatusBadRequest).JSON(out.Error(fiber.StatusBadRequest, 1, "BAD_REQUEST", "either user or headers is required"))
+	}
+
+	request := auth.NewDryRunRequest(c, req.Method, req.Path, req.Headers, req.Query)
+
+	var principal *auth.Principal
+	if req.User != "" {
+		explainer, ok := h.scheme(req.AuthType).(auth.IExplainer)
+		if !ok {
+			return c.Status(fiber.StatusBadRequest).JSON(out.Error(fiber.StatusBadRequest, 1, "BAD_REQUEST", "unknown auth_type "+req.AuthType))
+		}
+
+		var err error
+		principal, err = explainer.FindPrincipal(c, req.User)
+		if err != nil {
+			return c.Status(fiber.StatusNotFound).JSON(out.Error(fiber.StatusNotFound, 1, "NOT_FOUND", err.Error()))
+		}
+	} else {
+		var authErr *auth.AuthError
+		principal, authErr = h.authenticate(c, request.Method, request.Path, req.Headers)
+		if authErr != nil {
+			explanation := &auth.Explanation{Method: request.Method, Path: request.Path, Trace: []string{}}
+			explanation.Tracef("credential rejected by the authentication middleware")
+			return c.JSON(out.SuccessData(explanation.Deny(authErr)))
+		}
+	}
+
+	return c.JSON(out.SuccessData(h.Chain.Explain(principal, request)))
+}
+
+// Permissions lists the module routes the current user may call
+func (h *ExplainHandler) Permissions(c *fiber.Ctx) error {
+	principal := auth.GetPrincipal(c)
+	if principal == nil {
+		return auth.ErrCredentialsMissing.Respond(c, auth.GetChallenges(c))
+	}
+
+	prefix := h.App.Context.Config.Server.PathPrefix
+	permissions := []Permission{}
+	for _, route := range h.App.ModuleManager.GetRoutes() {
+		path := route.FullPath()
+		if !strings.HasPrefix(path, prefix) {
+			continue
+		}
+
+		// every request gets its own copy, the dry run sets the matched resource
+		dryRun := *principal
+		explanation := h.Chain.Explain(&dryRun, auth.NewDryRunRequest(c, route.Method, path, nil, nil))
+		if explanation.Decision != auth.DecisionAllow {
+			continue
+		}
+
+		permission := Permission{Method: route.Method, Path: path, Public: explanation.Public}
+		if explanation.Resource != nil {
+			permission.Action = explanation.Resource.Action
+		} else if route.Security != nil {
+			permission.Action = route.Security.Action
+		}
+		permissions = append(permissions, permission)
+	}
+
+	return c.JSON(out.SuccessData(permissions))
+}
+
+// scheme returns the scheme of the authentication type, the first configured one when empty
+func (h *ExplainHandler) scheme(authType string) auth.IAuthScheme {
+	if authType == "" && len(h.Chain.Schemes) > 0 {
+		return h.Chain.Schemes[0]
+	}
+
+	idx := slices.IndexFunc(h.Chain.Schemes, func(scheme auth.IAuthScheme) bool {
+		return scheme.Name() == authType
+	})
+	if idx < 0 {
+		return nil
+	}
+	return h.Chain.Schemes[idx]
+}
+
+// authenticate verifies the credential headers on a separate request context
+// as a dry run, so no single-use material is consumed and the lockout of the
+// admin's IP and the guessed identities applies
+func (h *ExplainHandler) authenticate(c *fiber.Ctx, method string, path string, headers map[string]string) (*auth.Principal, *auth.AuthError) {
+	request := &fasthttp.RequestCtx{}
+	request.SetRemoteAddr(c.Context().RemoteAddr())
+	request.Request.Header.SetMethod(method)
+	request.Request.SetRequestURI(path)
+	for name, value := range headers {
+		request.Request.Header.Set(name, value)
+	}
+
+	ctx := c.App().AcquireCtx(request)
+	defer c.App().ReleaseCtx(ctx)
+	ctx.SetUserContext(c.UserContext())
+
+	principal, err := h.Chain.DryRun(ctx)
+	if err != nil {
+		return nil, auth.AsAuthError(err, auth.ErrCredentialsInvalid)
+	}
+	return principal, nil
+}
@@ -0,0 +1,166 @@
+package core
+
+import (
+	"errors"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/webcore-go/webcore/app/out"
+	"github.com/webcore-go/webcore/infra/config"
+	"github.com/webcore-go/webcore/infra/logger"
+	"github.com/webcore-go/webcore/port/auth"
+)
+
+type MFACodeRequest struct {
+	Code string `json:"code" form:"code"`
+}
+
+// MFAHandler serves the enrollment endpoints of the TOTP second factor
+type MFAHandler struct {
+	MFA *auth.MFA
+}
+
+func NewMFAHandler(mfa *auth.MFA) *MFAHandler {
+	return &MFAHandler{
+		MFA: mfa,
+	}
+}
+
+// Register mounts the endpoints below the protected prefix. Every
+// authenticated user manages the own factor; changing a confirmed factor
+// needs a verified second factor, resetting the factor of another user the
+// admin roles.
+func (h *MFAHandler) Register(root fiber.Router, config config.MFAConfig) {
+	if config.Path == "" {
+		return
+	}
+
+	// optional, so the routes have a rule under auth.default_policy deny;
+	// anonymous requests are rejected by the route security or the handler
+	// the factor belongs to the user, an impersonating admin must not change it
+	self := &auth.RouteSecurity{Optional: true, NoImpersonation: true}
+	stepUp := &auth.RouteSecurity{Optional: true, MFA: true, NoImpersonation: true}
+	routes := []*ModuleRoute{
+		{Method: fiber.MethodGet, Path: config.Path, Handler: h.Status, Security: self},
+		{Method: fiber.MethodPost, Path: config.Path + "/enroll", Handler: h.Enroll, Security: self},
+		{Method: fiber.MethodPost, Path: config.Path + "/confirm", Handler: h.Confirm, Security: self},
+		{Method: fiber.MethodPost, Path: config.Path + "/recovery-codes", Handler: h.RecoveryCodes, Security: stepUp},
+		{Method: fiber.MethodDelete, Path: config.Path, Handler: h.Disable, Security: stepUp},
+	}
+
+	// without admin roles the reset would be open to every authenticated user
+	if len(config.AdminRoles) == 0 {
+		logger.Error("auth.mfa.admin_roles is empty, the MFA reset endpoint is not registered")
+	} else {
+		admin := &auth.RouteSecurity{Roles: config.AdminRoles, NoImpersonation: true}
+		routes = append(routes, &ModuleRoute{Method: fiber.MethodDelete, Path: config.Path + "/users/:id", Handler: h.Reset, Security: admin})
+	}
+
+	for _, route := range routes {
+		route.Root = root
+		AppendRouteToArray(nil, route)
+	}
+}
+
+func (h *MFAHandler) Status(c *fiber.Ctx) error {
+	principal := auth.GetPrincipal(c)
+	if principal == nil {
+		return auth.ErrCredentialsMissing.Respond(c, auth.GetChallenges(c))
+	}
+
+	status, err := h.MFA.Status(c.UserContext(), principal.UserId)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(out.ErrorDetail(fiber.StatusInternalServerError, 1, "UNKNOWN", "Failed to load MFA", err))
+	}
+
+	return c.JSON(out.SuccessData(status))
+}
+
+// Enroll returns a new secret, replacing a confirmed factor needs the current one
+func (h *MFAHandler) Enroll(c *fiber.Ctx) error {
+	principal := auth.GetPrincipal(c)
+	if principal == nil {
+		return auth.ErrCredentialsMissing.Respond(c, auth.GetChallenges(c))
+	}
+
+	status, err := h.MFA.Status(c.UserContext(), principal.UserId)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(out.ErrorDetail(fiber.StatusInternalServerError, 1, "UNKNOWN", "Failed to load MFA", err))
+	}
+	if status.Enrolled && !principal.MFA {
+		return auth.ErrMFARequired.Respond(c, auth.GetChallenges(c))
+	}
+
+	account := principal.Username
+	if account == "" {
+		account = principal.UserId
+	}
+
+	setup, err := h.MFA.Enroll(c.UserContext(), principal.UserId, account)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(out.ErrorDetail(fiber.StatusInternalServerError, 1, "UNKNOWN", "Failed to enroll MFA", err))
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(out.SuccessData(setup))
+}
+
+// Confirm activates the enrollment and returns the recovery codes, they are not shown again
+func (h *MFAHandler) Confirm(c *fiber.Ctx) error {
+	principal := auth.GetPrincipal(c)
+	if principal == nil {
+		return auth.ErrCredentialsMissing.Respond(c, auth.GetChallenges(c))
+	}
+
+	var req MFACodeRequest
+	if err := c.BodyParser(&req); err != nil || req.Code == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(out.Error(fiber.StatusBadRequest, 1, "BAD_REQUEST", "code is required"))
+	}
+
+	codes, err := h.MFA.Confirm(c.UserContext(), principal.UserId, req.Code)
+	if err != nil {
+		return h.respondError(c, err, "Failed to confirm MFA")
+	}
+
+	return c.JSON(out.SuccessData(fiber.Map{"recovery_codes": codes}))
+}
+
+func (h *MFAHandler) RecoveryCodes(c *fiber.Ctx) error {
+	principal := auth.GetPrincipal(c)
+
+	codes, err := h.MFA.RegenerateRecoveryCodes(c.UserContext(), principal.UserId)
+	if err != nil {
+		return h.respondError(c, err, "Failed to create recovery codes")
+	}
+
+	return c.JSON(out.SuccessData(fiber.Map{"recovery_codes": codes}))
+}
+
+func (h *MFAHandler) Disable(c *fiber.Ctx) error {
+	principal := auth.GetPrincipal(c)
+
+	if err := h.MFA.Disable(c.UserContext(), principal.UserId, principal.UserId); err != nil {
+		return h.respondError(c, err, "Failed to disable MFA")
+	}
+
+	return c.JSON(out.SuccessMessage("MFA disabled"))
+}
+
+// Reset removes the factor of a user who lost the device and the recovery codes
+func (h *MFAHandler) Reset(c *fiber.Ctx) error {
+	principal := auth.GetPrincipal(c)
+
+	if err := h.MFA.Disable(c.UserContext(), c.Params("id"), principal.UserId); err != nil {
+		return h.respondError(c, err, "Failed to reset MFA")
+	}
+
+	return c.JSON(out.SuccessMessage("MFA reset"))
+}
+
+// respondError answers code errors with their auth error code and store errors with 500
+func (h *MFAHandler) respondError(c *fiber.Ctx, err error, message string) error {
+	var authErr *auth.AuthError
+	if errors.As(err, &authErr) {
+		return authErr.Respond(c, nil)
+	}
+
+	return c.Status(fiber.StatusInternalServerError).JSON(out.ErrorDetail(fiber.StatusInternalServerError, 1, "UNKNOWN", message, err))
+}
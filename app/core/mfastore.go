@@ -0,0 +1,142 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+
+	"github.com/webcore-go/webcore/app/helper"
+	"github.com/webcore-go/webcore/port/auth"
+)
+
+// fileMFA is the stored form of an enrollment, including the fields that MFAEnrollment hides from JSON
+type fileMFA struct {
+	auth.MFAEnrollment
+	Secret        string   `json:"secret"`
+	PendingSecret string   `json:"pending_secret,omitempty"`
+	RecoveryCodes []string `json:"recovery_codes"`
+	LastStep      int64    `json:"last_step"`
+}
+
+// FileMFAStore keeps the second factors in a JSON file. It is used when the
+// auth store (e.g. access.yaml) has no mfa table.
+type FileMFAStore struct {
+	Path string
+
+	mu      sync.RWMutex
+	entries map[string]*auth.MFAEnrollment
+}
+
+func NewFileMFAStore(path string) (*FileMFAStore, error) {
+	s := &FileMFAStore{
+		Path:    path,
+		entries: make(map[string]*auth.MFAEnrollment),
+	}
+
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Read MFA file %s: %v", path, err)
+	}
+
+	var list []fileMFA
+	if len(data) > 0 {
+		if err := helper.JSONUnmarshal(data, &list); err != nil {
+			return nil, fmt.Errorf("Parse MFA file %s: %v", path, err)
+		}
+	}
+
+	for i := range list {
+		enrollment := list[i].MFAEnrollment
+		enrollment.Secret = list[i].Secret
+		enrollment.PendingSecret = list[i].PendingSecret
+		enrollment.RecoveryCodes = list[i].RecoveryCodes
+		enrollment.LastStep = list[i].LastStep
+		s.entries[enrollment.UserId] = &enrollment
+	}
+
+	return s, nil
+}
+
+func (s *FileMFAStore) GetMFA(ctx context.Context, userId string) (*auth.MFAEnrollment, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	enrollment, ok := s.entries[userId]
+	if !ok {
+		return nil, nil
+	}
+
+	copied := *enrollment
+	copied.RecoveryCodes = append([]string(nil), enrollment.RecoveryCodes...)
+	return &copied, nil
+}
+
+func (s *FileMFAStore) SaveMFA(ctx context.Context, enrollment *auth.MFAEnrollment) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	copied := *enrollment
+	copied.RecoveryCodes = append([]string(nil), enrollment.RecoveryCodes...)
+	s.entries[enrollment.UserId] = &copied
+	return s.save()
+}
+
+func (s *FileMFAStore) DeleteMFA(ctx context.Context, userId string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.entries[userId]; !ok {
+		return nil
+	}
+
+	delete(s.entries, userId)
+	return s.save()
+}
+
+// save writes all enrollments to a temporary file and renames it, so a crash never leaves a partial file
+func (s *FileMFAStore) save() error {
+	list := make([]fileMFA, 0, len(s.entries))
+	for _, enrollment := range s.entries {
+		list = append(list, fileMFA{
+			MFAEnrollment: *enrollment,
+			Secret:        enrollment.Secret,
+			PendingSecret: enrollment.PendingSecret,
+			RecoveryCodes: enrollment.RecoveryCodes,
+			LastStep:      enrollment.LastStep,
+		})
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].UserId < list[j].UserId
+	})
+
+	data, err := helper.JSONMarshalIndent(list, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(s.Path), filepath.Base(s.Path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Chmod(0600); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), s.Path)
+}
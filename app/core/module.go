@@ -14,6 +14,7 @@ import (
 	"github.com/gofiber/fiber/v2"
 	"github.com/webcore-go/webcore/infra/config"
 	"github.com/webcore-go/webcore/infra/logger"
+	"github.com/webcore-go/webcore/port/auth"
 )
 
 // Module represents a pluggable module interface
@@ -46,10 +47,19 @@ type Module interface {
 }
 
 type ModuleRoute struct {
-	Method  string
-	Path    string
-	Handler fiber.Handler
-	Root    fiber.Router
+	Method   string
+	Path     string
+	Handler  fiber.Handler
+	Root     fiber.Router
+	Security *auth.RouteSecurity // optional, enforced from the authenticated principal
+}
+
+// FullPath returns the path including the prefixes of the route group
+func (r *ModuleRoute) FullPath() string {
+	if group, ok := r.Root.(*fiber.Group); ok {
+		return group.Prefix + r.Path
+	}
+	return r.Path
 }
 
 // ModuleManager manages module registration and loading
@@ -0,0 +1,112 @@
+package core
+
+import (
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/webcore-go/webcore/app/out"
+	"github.com/webcore-go/webcore/infra/config"
+	"github.com/webcore-go/webcore/infra/logger"
+	"github.com/webcore-go/webcore/port/auth"
+)
+
+type RevokeRequest struct {
+	Kind      string     `json:"kind"`   // "jti", "issued_before" or "subject"
+	Value     string     `json:"value"`  // token id or subject
+	Before    *time.Time `json:"before"` // issued_before: default now
+	ExpiresIn string     `json:"expires_in"`
+	Reason    string     `json:"reason"`
+}
+
+// RevocationHandler serves the admin endpoints of the token revocation
+type RevocationHandler struct {
+	Revocation *auth.Revocation
+}
+
+func NewRevocationHandler(revocation *auth.Revocation) *RevocationHandler {
+	return &RevocationHandler{
+		Revocation: revocation,
+	}
+}
+
+// Register mounts the endpoints below the protected prefix, limited to the admin roles
+func (h *RevocationHandler) Register(root fiber.Router, config config.RevocationConfig) {
+	if config.AdminPath == "" {
+		return
+	}
+
+	// without admin roles the routes would be open to every authenticated user
+	if len(config.AdminRoles) == 0 {
+		logger.Error("auth.revocation.admin_roles is empty, the revocation endpoints are not registered")
+		return
+	}
+
+	security := &auth.RouteSecurity{Roles: config.AdminRoles, NoImpersonation: true}
+	for _, route := range []*ModuleRoute{
+		{Method: fiber.MethodPost, Path: config.AdminPath, Handler: h.Revoke},
+		{Method: fiber.MethodGet, Path: config.AdminPath + "/:kind/:value", Handler: h.Get},
+		{Method: fiber.MethodDelete, Path: config.AdminPath + "/:kind/:value", Handler: h.Remove},
+	} {
+		route.Root = root
+		route.Security = security
+		AppendRouteToArray(nil, route)
+	}
+}
+
+func (h *RevocationHandler) Revoke(c *fiber.Ctx) error {
+	var req RevokeRequest
+	if err := c.BodyParser(&req); err != nil || req.Value == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(out.Error(fiber.StatusBadRequest, 1, "BAD_REQUEST", "kind and value are required"))
+	}
+
+	var expiresAt time.Time
+	if req.ExpiresIn != "" {
+		ttl, err := time.ParseDuration(req.ExpiresIn)
+		if err != nil || ttl <= 0 {
+			return c.Status(fiber.StatusBadRequest).JSON(out.Error(fiber.StatusBadRequest, 1, "BAD_REQUEST", "expires_in must be a positive duration"))
+		}
+		expiresAt = time.Now().Add(ttl)
+	}
+
+	var err error
+	switch req.Kind {
+	case auth.RevokeToken:
+		err = h.Revocation.RevokeToken(c.UserContext(), req.Value, expiresAt, req.Reason)
+	case auth.RevokeIssuedBefore:
+		before := time.Now()
+		if req.Before != nil {
+			before = *req.Before
+		}
+		err = h.Revocation.RevokeIssuedBefore(c.UserContext(), req.Value, before, req.Reason)
+	case auth.RevokeSubject:
+		err = h.Revocation.RevokeSubject(c.UserContext(), req.Value, expiresAt, req.Reason)
+	default:
+		return c.Status(fiber.StatusBadRequest).JSON(out.Error(fiber.StatusBadRequest, 1, "BAD_REQUEST", "kind must be jti, issued_before or subject"))
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(out.ErrorDetail(fiber.StatusInternalServerError, 1, "UNKNOWN", "Failed to revoke", err))
+	}
+
+	entry, _ := h.Revocation.Get(c.UserContext(), req.Kind, req.Value)
+	return c.Status(fiber.StatusCreated).JSON(out.SuccessData(entry))
+}
+
+func (h *RevocationHandler) Get(c *fiber.Ctx) error {
+	entry, err := h.Revocation.Get(c.UserContext(), c.Params("kind"), c.Params("value"))
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(out.ErrorDetail(fiber.StatusInternalServerError, 1, "UNKNOWN", "Failed to load revocation", err))
+	}
+	if entry == nil {
+		return c.Status(fiber.StatusNotFound).JSON(out.Error(fiber.StatusNotFound, 1, "NOT_FOUND", "not revoked"))
+	}
+
+	return c.JSON(out.SuccessData(entry))
+}
+
+func (h *RevocationHandler) Remove(c *fiber.Ctx) error {
+	if err := h.Revocation.Remove(c.UserContext(), c.Params("kind"), c.Params("value")); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(out.ErrorDetail(fiber.StatusInternalServerError, 1, "UNKNOWN", "Failed to remove revocation", err))
+	}
+
+	return c.JSON(out.SuccessMessage("Revocation removed"))
+}
@@ -0,0 +1,65 @@
+package core
+
+import (
+	"crypto/tls"
+	"fmt"
+
+	"github.com/webcore-go/webcore/app/helper"
+	"github.com/webcore-go/webcore/infra/config"
+)
+
+// NewTLSConfig returns the TLS settings of the listener. Client certificates
+// are verified against server.tls.client_ca, the mtls authentication adapter
+// maps them onto users.
+func NewTLSConfig(config config.TLSConfig) (*tls.Config, error) {
+	if config.CertFile == "" || config.KeyFile == "" {
+		return nil, fmt.Errorf("server.tls.cert_file and server.tls.key_file are required")
+	}
+
+	cert, err := tls.LoadX509KeyPair(config.CertFile, config.KeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("Load server certificate: %v", err)
+	}
+
+	tlsConfig := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+	}
+
+	switch config.MinVersion {
+	case "", "1.2":
+		tlsConfig.MinVersion = tls.VersionTLS12
+	case "1.3":
+		tlsConfig.MinVersion = tls.VersionTLS13
+	default:
+		return nil, fmt.Errorf("Unknown server.tls.min_version %s, use 1.2 or 1.3", config.MinVersion)
+	}
+
+	switch config.ClientAuth {
+	case "", "none":
+		tlsConfig.ClientAuth = tls.NoClientCert
+		return tlsConfig, nil
+	case "request":
+		// the certificate is verified by the mtls adapter, e.g. when only some routes need it
+		tlsConfig.ClientAuth = tls.RequestClientCert
+	case "verify_if_given":
+		tlsConfig.ClientAuth = tls.VerifyClientCertIfGiven
+	case "require":
+		tlsConfig.ClientAuth = tls.RequireAndVerifyClientCert
+	default:
+		return nil, fmt.Errorf("Unknown server.tls.client_auth %s, use none, request, verify_if_given or require", config.ClientAuth)
+	}
+
+	if config.ClientCA == "" {
+		if config.ClientAuth != "request" {
+			return nil, fmt.Errorf("server.tls.client_ca is required for server.tls.client_auth %s", config.ClientAuth)
+		}
+		return tlsConfig, nil
+	}
+
+	pool, err := helper.LoadCertPool(config.ClientCA)
+	if err != nil {
+		return nil, err
+	}
+	tlsConfig.ClientCAs = pool
+	return tlsConfig, nil
+}
@@ -0,0 +1,248 @@
+package helper
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+	"golang.org/x/crypto/scrypt"
+)
+
+// Supported password hash algorithms
+const (
+	PasswordArgon2id = "argon2id"
+	PasswordBcrypt   = "bcrypt"
+	PasswordScrypt   = "scrypt"
+	PasswordPlain    = "plain" // value without a known hash prefix
+)
+
+// Cost parameters of new hashes. Stored hashes with lower parameters are
+// reported as outdated by VerifyPassword.
+const (
+	argon2Time    = 3
+	argon2Memory  = 64 * 1024 // KiB
+	argon2Threads = 4
+	argon2KeyLen  = 32
+	scryptLogN    = 15
+	scryptR       = 8
+	scryptP       = 1
+	scryptKeyLen  = 32
+	bcryptCost    = 12
+	saltLen       = 16
+
+	maxVerifiedPasswords = 10000 // entries of the verified password cache
+)
+
+var b64 = base64.RawStdEncoding
+
+// PasswordHasher creates hashes with one algorithm and verifies hashes of all
+// supported algorithms
+type PasswordHasher struct {
+	Algorithm string
+	CacheTTL  time.Duration // how long a verified password is accepted without hashing again, 0 disables
+
+	mu        sync.Mutex
+	verified  map[[sha256.Size]byte]time.Time
+	cacheSalt []byte
+	dummyOnce sync.Once
+	dummy     string
+}
+
+func NewPasswordHasher(algorithm string) (*PasswordHasher, error) {
+	switch algorithm {
+	case "":
+		algorithm = PasswordArgon2id
+	case PasswordArgon2id, PasswordBcrypt, PasswordScrypt:
+	default:
+		return nil, fmt.Errorf("Unsupported password algorithm %s", algorithm)
+	}
+
+	return &PasswordHasher{Algorithm: algorithm}, nil
+}
+
+// Hash returns the PHC string ($argon2id$..., $scrypt$...) or the modular crypt
+// string ($2b$...) of the password
+func (h *PasswordHasher) Hash(password string) (string, error) {
+	switch h.Algorithm {
+	case PasswordBcrypt:
+		hash, err := bcrypt.GenerateFromPassword([]byte(password), bcryptCost)
+		if err != nil {
+			return "", err
+		}
+		return string(hash), nil
+
+	case PasswordScrypt:
+		salt := randomSalt()
+		key, err := scrypt.Key([]byte(password), salt, 1<<scryptLogN, scryptR, scryptP, scryptKeyLen)
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("$scrypt$ln=%d,r=%d,p=%d$%s$%s", scryptLogN, scryptR, scryptP, b64.EncodeToString(salt), b64.EncodeToString(key)), nil
+	}
+
+	salt := randomSalt()
+	key := argon2.IDKey([]byte(password), salt, argon2Time, argon2Memory, argon2Threads, argon2KeyLen)
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s", argon2.Version, argon2Memory, argon2Time, argon2Threads, b64.EncodeToString(salt), b64.EncodeToString(key)), nil
+}
+
+// Verify compares the password with the stored value in constant time. The
+// second result is true when the stored value should be replaced by a new hash:
+// plain text, another algorithm or lower cost parameters.
+func (h *PasswordHasher) Verify(stored string, password string) (bool, bool) {
+	if h.CacheTTL > 0 && h.isVerified(stored, password) {
+		return true, false
+	}
+
+	ok, outdated := h.verify(stored, password)
+	if ok && h.CacheTTL > 0 {
+		h.setVerified(stored, password)
+	}
+	return ok, outdated
+}
+
+// VerifyDummy compares the password with a hash of no user and discards the
+// result, so an unknown username costs as much time as a wrong password
+func (h *PasswordHasher) VerifyDummy(password string) {
+	h.dummyOnce.Do(func() {
+		h.dummy, _ = h.Hash(string(randomSalt()))
+	})
+	h.verify(h.dummy, password)
+}
+
+func (h *PasswordHasher) verify(stored string, password string) (bool, bool) {
+	algorithm := PasswordAlgorithm(stored)
+
+	var ok, weak bool
+	switch algorithm {
+	case PasswordBcrypt:
+		ok = bcrypt.CompareHashAndPassword([]byte(stored), []byte(password)) == nil
+		if cost, err := bcrypt.Cost([]byte(stored)); err == nil {
+			weak = cost < bcryptCost
+		}
+	case PasswordArgon2id:
+		ok, weak = verifyArgon2id(stored, password)
+	case PasswordScrypt:
+		ok, weak = verifyScrypt(stored, password)
+	default:
+		ok = subtle.ConstantTimeCompare([]byte(stored), []byte(password)) == 1
+	}
+
+	return ok, ok && (weak || algorithm != h.Algorithm)
+}
+
+// verifiedKey is a salted digest of the stored hash and the password, a
+// changed password never matches the entry of the old one
+func (h *PasswordHasher) verifiedKey(stored string, password string) [sha256.Size]byte {
+	if h.cacheSalt == nil {
+		h.cacheSalt = randomSalt()
+	}
+	return sha256.Sum256([]byte(string(h.cacheSalt) + stored + "\x00" + password))
+}
+
+func (h *PasswordHasher) isVerified(stored string, password string) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	expires, ok := h.verified[h.verifiedKey(stored, password)]
+	return ok && time.Now().Before(expires)
+}
+
+func (h *PasswordHasher) setVerified(stored string, password string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	now := time.Now()
+	if len(h.verified) >= maxVerifiedPasswords {
+		for key, expires := range h.verified {
+			if !now.Before(expires) {
+				delete(h.verified, key)
+			}
+		}
+	}
+	if h.verified == nil || len(h.verified) >= maxVerifiedPasswords {
+		h.verified = make(map[[sha256.Size]byte]time.Time)
+	}
+	h.verified[h.verifiedKey(stored, password)] = now.Add(h.CacheTTL)
+}
+
+// PasswordAlgorithm detects the algorithm from the hash prefix
+func PasswordAlgorithm(stored string) string {
+	switch {
+	case strings.HasPrefix(stored, "$argon2id$"):
+		return PasswordArgon2id
+	case strings.HasPrefix(stored, "$scrypt$"):
+		return PasswordScrypt
+	case strings.HasPrefix(stored, "$2a$"), strings.HasPrefix(stored, "$2b$"), strings.HasPrefix(stored, "$2y$"):
+		return PasswordBcrypt
+	}
+	return PasswordPlain
+}
+
+func randomSalt() []byte {
+	salt := make([]byte, saltLen)
+	_, _ = rand.Read(salt)
+	return salt
+}
+
+// verifyArgon2id checks "$argon2id$v=19$m=65536,t=3,p=4$<salt>$<key>"
+func verifyArgon2id(stored string, password string) (bool, bool) {
+	parts := strings.Split(stored, "$")
+	if len(parts) != 6 {
+		return false, false
+	}
+
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return false, false
+	}
+
+	var memory, time uint32
+	var threads uint8
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &memory, &time, &threads); err != nil {
+		return false, false
+	}
+
+	salt, err1 := b64.DecodeString(parts[4])
+	key, err2 := b64.DecodeString(parts[5])
+	if err1 != nil || err2 != nil || len(key) == 0 {
+		return false, false
+	}
+
+	actual := argon2.IDKey([]byte(password), salt, time, memory, threads, uint32(len(key)))
+	ok := subtle.ConstantTimeCompare(actual, key) == 1
+	return ok, memory < argon2Memory || time < argon2Time
+}
+
+// verifyScrypt checks "$scrypt$ln=15,r=8,p=1$<salt>$<key>"
+func verifyScrypt(stored string, password string) (bool, bool) {
+	parts := strings.Split(stored, "$")
+	if len(parts) != 5 {
+		return false, false
+	}
+
+	var logN, r, p int
+	if _, err := fmt.Sscanf(parts[2], "ln=%d,r=%d,p=%d", &logN, &r, &p); err != nil || logN < 1 || logN > 30 {
+		return false, false
+	}
+
+	salt, err1 := b64.DecodeString(parts[3])
+	key, err2 := b64.DecodeString(parts[4])
+	if err1 != nil || err2 != nil || len(key) == 0 {
+		return false, false
+	}
+
+	actual, err := scrypt.Key([]byte(password), salt, 1<<logN, r, p, len(key))
+	if err != nil {
+		return false, false
+	}
+
+	ok := subtle.ConstantTimeCompare(actual, key) == 1
+	return ok, logN < scryptLogN
+}
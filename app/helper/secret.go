@@ -0,0 +1,71 @@
+package helper
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+)
+
+// SecretKeySize is the length of the AES-256 key of stored secrets
+const SecretKeySize = 32
+
+// ParseSecretKey decodes a base64 AES-256 key, e.g. of auth.hmac.secret_key
+func ParseSecretKey(value string) ([]byte, error) {
+	key, err := base64.StdEncoding.DecodeString(value)
+	if err != nil || len(key) != SecretKeySize {
+		return nil, fmt.Errorf("Secret key must be %d bytes encoded as base64", SecretKeySize)
+	}
+	return key, nil
+}
+
+// EncryptSecret seals a secret for storage with AES-256-GCM. The owner, e.g.
+// the username, is authenticated with it, so a sealed secret copied to
+// another user does not decrypt.
+func EncryptSecret(key []byte, secret string, owner string) (string, error) {
+	aead, err := newSecretAEAD(key)
+	if err != nil {
+		return "", err
+	}
+
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+
+	sealed := aead.Seal(nonce, nonce, []byte(secret), []byte(owner))
+	return base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// DecryptSecret opens a secret sealed by EncryptSecret for the same owner
+func DecryptSecret(key []byte, sealed string, owner string) (string, error) {
+	aead, err := newSecretAEAD(key)
+	if err != nil {
+		return "", err
+	}
+
+	data, err := base64.StdEncoding.DecodeString(sealed)
+	if err != nil || len(data) < aead.NonceSize() {
+		return "", fmt.Errorf("Sealed secret is malformed")
+	}
+
+	nonce, ciphertext := data[:aead.NonceSize()], data[aead.NonceSize():]
+	secret, err := aead.Open(nil, nonce, ciphertext, []byte(owner))
+	if err != nil {
+		return "", fmt.Errorf("Sealed secret does not decrypt with the key for %s", owner)
+	}
+	return string(secret), nil
+}
+
+func newSecretAEAD(key []byte) (cipher.AEAD, error) {
+	if len(key) != SecretKeySize {
+		return nil, fmt.Errorf("Secret key must be %d bytes", SecretKeySize)
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
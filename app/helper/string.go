@@ -120,10 +120,10 @@ func GenerateUUID() (string, error) {
 	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16]), nil
 }
 
-// HashPassword hashes a password (placeholder - implement actual hashing)
-func HashPassword(password string) string {
-	// In a real implementation, use bcrypt or similar
-	return password
+// HashPassword hashes a password with argon2id, see PasswordHasher for other algorithms
+func HashPassword(password string) (string, error) {
+	hasher := &PasswordHasher{Algorithm: PasswordArgon2id}
+	return hasher.Hash(password)
 }
 
 // ValidateEmail validates an email address
@@ -0,0 +1,53 @@
+// Command hashpassword prints password hashes for the password field of
+// access.yaml users or the auth users table.
+//
+//	go run github.com/webcore-go/webcore/cmd/hashpassword -algorithm bcrypt secret
+//	echo secret | go run github.com/webcore-go/webcore/cmd/hashpassword
+//
+// Without arguments every line of stdin is hashed.
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/webcore-go/webcore/app/helper"
+)
+
+func main() {
+	algorithm := flag.String("algorithm", helper.PasswordArgon2id, "argon2id, bcrypt or scrypt")
+	flag.Parse()
+
+	hasher, err := helper.NewPasswordHasher(*algorithm)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+
+	passwords := flag.Args()
+	if len(passwords) == 0 {
+		scanner := bufio.NewScanner(os.Stdin)
+		for scanner.Scan() {
+			passwords = append(passwords, scanner.Text())
+		}
+		if err := scanner.Err(); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+	}
+
+	for _, password := range passwords {
+		if password == "" {
+			continue
+		}
+
+		hash, err := hasher.Hash(password)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		fmt.Println(hash)
+	}
+}
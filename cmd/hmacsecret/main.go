@@ -0,0 +1,66 @@
+// Command hmacsecret creates the shared secret of an HMAC signing client and
+// prints it together with the hmac_secret value for access.yaml or the auth
+// users table, encrypted with auth.hmac.secret_key.
+//
+//	AUTH_HMAC_SECRET_KEY=... go run github.com/webcore-go/webcore/cmd/hmacsecret -user billing-service
+//	go run github.com/webcore-go/webcore/cmd/hmacsecret -genkey
+//
+// A secret given as argument is encrypted instead of a random one.
+package main
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/webcore-go/webcore/app/helper"
+)
+
+func main() {
+	user := flag.String("user", "", "username of the signing client, the credential of its requests")
+	key := flag.String("key", os.Getenv("AUTH_HMAC_SECRET_KEY"), "base64 auth.hmac.secret_key, default $AUTH_HMAC_SECRET_KEY")
+	genkey := flag.Bool("genkey", false, "print a new auth.hmac.secret_key and exit")
+	flag.Parse()
+
+	if *genkey {
+		fmt.Println(base64.StdEncoding.EncodeToString(random(helper.SecretKeySize)))
+		return
+	}
+
+	if *user == "" {
+		fmt.Fprintln(os.Stderr, "-user is required")
+		os.Exit(2)
+	}
+
+	secretKey, err := helper.ParseSecretKey(*key)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+
+	secret := flag.Arg(0)
+	if secret == "" {
+		secret = hex.EncodeToString(random(32))
+	}
+
+	sealed, err := helper.EncryptSecret(secretKey, secret, *user)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	fmt.Println("secret:     ", secret)
+	fmt.Println("hmac_secret:", sealed)
+}
+
+func random(size int) []byte {
+	data := make([]byte, size)
+	if _, err := rand.Read(data); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	return data
+}
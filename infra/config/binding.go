@@ -32,6 +32,14 @@ func (c *Config) SetEnvBindings() map[string]string {
 		"server.read_timeout":  "SERVER_READ_TIMEOUT",
 		"server.write_timeout": "SERVER_WRITE_TIMEOUT",
 
+		// Server TLS
+		"server.tls.enabled":     "SERVER_TLS_ENABLED",
+		"server.tls.cert_file":   "SERVER_TLS_CERT_FILE",
+		"server.tls.key_file":    "SERVER_TLS_KEY_FILE",
+		"server.tls.client_ca":   "SERVER_TLS_CLIENT_CA",
+		"server.tls.client_auth": "SERVER_TLS_CLIENT_AUTH",
+		"server.tls.min_version": "SERVER_TLS_MIN_VERSION",
+
 		// Auth
 		"auth.control":        "AUTH_CONTROL",
 		"auth.store":          "AUTH_STORE",
@@ -40,6 +48,149 @@ func (c *Config) SetEnvBindings() map[string]string {
 		"auth.expires_in":     "AUTH_EXPIRES_IN",
 		"auth.api_key_header": "AUTH_API_KEY_HEADER",
 		"auth.api_key_name":   "AUTH_API_KEY_NAME",
+		"auth.public":         "AUTH_PUBLIC",
+		"auth.optional":       "AUTH_OPTIONAL",
+		"auth.default_policy": "AUTH_DEFAULT_POLICY",
+		"auth.strict":         "AUTH_STRICT",
+		"auth.realm":          "AUTH_REALM",
+
+		// Auth JWT
+		"auth.jwt.algorithm":          "AUTH_JWT_ALGORITHM",
+		"auth.jwt.private_key":        "AUTH_JWT_PRIVATE_KEY",
+		"auth.jwt.public_key":         "AUTH_JWT_PUBLIC_KEY",
+		"auth.jwt.issuer":             "AUTH_JWT_ISSUER",
+		"auth.jwt.audience":           "AUTH_JWT_AUDIENCE",
+		"auth.jwt.leeway":             "AUTH_JWT_LEEWAY",
+		"auth.jwt.refresh_expires_in": "AUTH_JWT_REFRESH_EXPIRES_IN",
+		"auth.jwt.groups_claim":       "AUTH_JWT_GROUPS_CLAIM",
+		"auth.jwt.roles_claim":        "AUTH_JWT_ROLES_CLAIM",
+		"auth.jwt.login_path":         "AUTH_JWT_LOGIN_PATH",
+		"auth.jwt.refresh_path":       "AUTH_JWT_REFRESH_PATH",
+		"auth.jwt.logout_path":        "AUTH_JWT_LOGOUT_PATH",
+
+		// Auth YAML Store
+		"auth.yaml.watch":    "AUTH_YAML_WATCH",
+		"auth.yaml.debounce": "AUTH_YAML_DEBOUNCE",
+
+		// Auth DB Store
+		"auth.db.table_prefix":     "AUTH_DB_TABLE_PREFIX",
+		"auth.db.refresh_interval": "AUTH_DB_REFRESH_INTERVAL",
+		"auth.db.create_schema":    "AUTH_DB_CREATE_SCHEMA",
+
+		// Auth Password
+		"auth.password.algorithm": "AUTH_PASSWORD_ALGORITHM",
+		"auth.password.cache_ttl": "AUTH_PASSWORD_CACHE_TTL",
+
+		// Auth API Keys
+		"auth.api_keys.prefix":       "AUTH_API_KEYS_PREFIX",
+		"auth.api_keys.file":         "AUTH_API_KEYS_FILE",
+		"auth.api_keys.default_ttl":  "AUTH_API_KEYS_DEFAULT_TTL",
+		"auth.api_keys.grace_period": "AUTH_API_KEYS_GRACE_PERIOD",
+		"auth.api_keys.allow_plain":  "AUTH_API_KEYS_ALLOW_PLAIN",
+		"auth.api_keys.admin_path":   "AUTH_API_KEYS_ADMIN_PATH",
+		"auth.api_keys.admin_roles":  "AUTH_API_KEYS_ADMIN_ROLES",
+
+		// Auth Audit
+		"auth.audit.sinks":       "AUTH_AUDIT_SINKS",
+		"auth.audit.file":        "AUTH_AUDIT_FILE",
+		"auth.audit.table":       "AUTH_AUDIT_TABLE",
+		"auth.audit.sample_rate": "AUTH_AUDIT_SAMPLE_RATE",
+		"auth.audit.buffer":      "AUTH_AUDIT_BUFFER",
+
+		// Auth Explain
+		"auth.explain.path":             "AUTH_EXPLAIN_PATH",
+		"auth.explain.permissions_path": "AUTH_EXPLAIN_PERMISSIONS_PATH",
+		"auth.explain.admin_roles":      "AUTH_EXPLAIN_ADMIN_ROLES",
+
+		// Auth Lockout
+		"auth.lockout.enabled":         "AUTH_LOCKOUT_ENABLED",
+		"auth.lockout.store":           "AUTH_LOCKOUT_STORE",
+		"auth.lockout.max_failures":    "AUTH_LOCKOUT_MAX_FAILURES",
+		"auth.lockout.ip_max_failures": "AUTH_LOCKOUT_IP_MAX_FAILURES",
+		"auth.lockout.window":          "AUTH_LOCKOUT_WINDOW",
+		"auth.lockout.duration":        "AUTH_LOCKOUT_DURATION",
+		"auth.lockout.max_duration":    "AUTH_LOCKOUT_MAX_DURATION",
+		"auth.lockout.ban_duration":    "AUTH_LOCKOUT_BAN_DURATION",
+		"auth.lockout.captcha_after":   "AUTH_LOCKOUT_CAPTCHA_AFTER",
+		"auth.lockout.reset_after":     "AUTH_LOCKOUT_RESET_AFTER",
+
+		// Auth Revocation
+		"auth.revocation.enabled":     "AUTH_REVOCATION_ENABLED",
+		"auth.revocation.store":       "AUTH_REVOCATION_STORE",
+		"auth.revocation.cache_size":  "AUTH_REVOCATION_CACHE_SIZE",
+		"auth.revocation.cache_ttl":   "AUTH_REVOCATION_CACHE_TTL",
+		"auth.revocation.fail_closed": "AUTH_REVOCATION_FAIL_CLOSED",
+		"auth.revocation.admin_path":  "AUTH_REVOCATION_ADMIN_PATH",
+		"auth.revocation.admin_roles": "AUTH_REVOCATION_ADMIN_ROLES",
+
+		// Auth Session
+		"auth.session.store":            "AUTH_SESSION_STORE",
+		"auth.session.path":             "AUTH_SESSION_PATH",
+		"auth.session.cookie_name":      "AUTH_SESSION_COOKIE_NAME",
+		"auth.session.cookie_domain":    "AUTH_SESSION_COOKIE_DOMAIN",
+		"auth.session.cookie_path":      "AUTH_SESSION_COOKIE_PATH",
+		"auth.session.secure":           "AUTH_SESSION_SECURE",
+		"auth.session.same_site":        "AUTH_SESSION_SAME_SITE",
+		"auth.session.idle_timeout":     "AUTH_SESSION_IDLE_TIMEOUT",
+		"auth.session.absolute_timeout": "AUTH_SESSION_ABSOLUTE_TIMEOUT",
+		"auth.session.csrf":             "AUTH_SESSION_CSRF",
+		"auth.session.csrf_cookie_name": "AUTH_SESSION_CSRF_COOKIE_NAME",
+		"auth.session.csrf_header":      "AUTH_SESSION_CSRF_HEADER",
+		"auth.session.csrf_field":       "AUTH_SESSION_CSRF_FIELD",
+
+		// Auth OIDC
+		"auth.oidc.issuer":                  "AUTH_OIDC_ISSUER",
+		"auth.oidc.discovery_url":           "AUTH_OIDC_DISCOVERY_URL",
+		"auth.oidc.jwks_url":                "AUTH_OIDC_JWKS_URL",
+		"auth.oidc.audience":                "AUTH_OIDC_AUDIENCE",
+		"auth.oidc.required_scopes":         "AUTH_OIDC_REQUIRED_SCOPES",
+		"auth.oidc.algorithms":              "AUTH_OIDC_ALGORITHMS",
+		"auth.oidc.leeway":                  "AUTH_OIDC_LEEWAY",
+		"auth.oidc.jwks_cache_ttl":          "AUTH_OIDC_JWKS_CACHE_TTL",
+		"auth.oidc.jwks_min_refresh":        "AUTH_OIDC_JWKS_MIN_REFRESH",
+		"auth.oidc.http_timeout":            "AUTH_OIDC_HTTP_TIMEOUT",
+		"auth.oidc.introspection":           "AUTH_OIDC_INTROSPECTION",
+		"auth.oidc.introspection_url":       "AUTH_OIDC_INTROSPECTION_URL",
+		"auth.oidc.client_id":               "AUTH_OIDC_CLIENT_ID",
+		"auth.oidc.client_secret":           "AUTH_OIDC_CLIENT_SECRET",
+		"auth.oidc.introspection_cache_ttl": "AUTH_OIDC_INTROSPECTION_CACHE_TTL",
+		"auth.oidc.subject_claim":           "AUTH_OIDC_SUBJECT_CLAIM",
+		"auth.oidc.username_claim":          "AUTH_OIDC_USERNAME_CLAIM",
+		"auth.oidc.groups_claim":            "AUTH_OIDC_GROUPS_CLAIM",
+		"auth.oidc.roles_claim":             "AUTH_OIDC_ROLES_CLAIM",
+		"auth.oidc.scope_claim":             "AUTH_OIDC_SCOPE_CLAIM",
+		"auth.oidc.lookup_user":             "AUTH_OIDC_LOOKUP_USER",
+
+		// Auth mTLS
+		"auth.mtls.ca_file":         "AUTH_MTLS_CA_FILE",
+		"auth.mtls.identity":        "AUTH_MTLS_IDENTITY",
+		"auth.mtls.proxy_header":    "AUTH_MTLS_PROXY_HEADER",
+		"auth.mtls.trusted_proxies": "AUTH_MTLS_TRUSTED_PROXIES",
+
+		// Auth HMAC
+		"auth.hmac.store":            "AUTH_HMAC_STORE",
+		"auth.hmac.clock_skew":       "AUTH_HMAC_CLOCK_SKEW",
+		"auth.hmac.required_headers": "AUTH_HMAC_REQUIRED_HEADERS",
+		"auth.hmac.secret_key":       "AUTH_HMAC_SECRET_KEY",
+
+		// Auth MFA
+		"auth.mfa.enabled":        "AUTH_MFA_ENABLED",
+		"auth.mfa.issuer":         "AUTH_MFA_ISSUER",
+		"auth.mfa.file":           "AUTH_MFA_FILE",
+		"auth.mfa.skew":           "AUTH_MFA_SKEW",
+		"auth.mfa.max_age":        "AUTH_MFA_MAX_AGE",
+		"auth.mfa.header":         "AUTH_MFA_HEADER",
+		"auth.mfa.header_schemes": "AUTH_MFA_HEADER_SCHEMES",
+		"auth.mfa.recovery_codes": "AUTH_MFA_RECOVERY_CODES",
+		"auth.mfa.path":           "AUTH_MFA_PATH",
+		"auth.mfa.admin_roles":    "AUTH_MFA_ADMIN_ROLES",
+
+		// Auth impersonation
+		"auth.impersonation.enabled":         "AUTH_IMPERSONATION_ENABLED",
+		"auth.impersonation.header":          "AUTH_IMPERSONATION_HEADER",
+		"auth.impersonation.roles":           "AUTH_IMPERSONATION_ROLES",
+		"auth.impersonation.protected_roles": "AUTH_IMPERSONATION_PROTECTED_ROLES",
+		"auth.impersonation.forbidden":       "AUTH_IMPERSONATION_FORBIDDEN",
 
 		// Database
 		"database.driver":            "DATABASE_DRIVER",
@@ -62,6 +62,16 @@ type ServerConfig struct {
 	PathPrefix   string        `mapstructure:"path"`
 	ReadTimeout  time.Duration `mapstructure:"read_timeout"`
 	WriteTimeout time.Duration `mapstructure:"write_timeout"`
+	TLS          TLSConfig     `mapstructure:"tls"`
+}
+
+type TLSConfig struct {
+	Enabled    bool   `mapstructure:"enabled"`
+	CertFile   string `mapstructure:"cert_file"`   // PEM certificate chain of the server
+	KeyFile    string `mapstructure:"key_file"`    // PEM private key of the server
+	ClientCA   string `mapstructure:"client_ca"`   // PEM bundle of the CAs that issue client certificates
+	ClientAuth string `mapstructure:"client_auth"` // "none", "request", "verify_if_given" or "require"
+	MinVersion string `mapstructure:"min_version"` // "1.2" or "1.3"
 }
 
 type DatabaseConfig struct {
@@ -125,13 +135,187 @@ type ProducerConfig struct {
 }
 
 type AuthConfig struct {
-	Control      string        `mapstructure:"control"` // e.g., "RBAC", "ABAC"
-	Store        string        `mapstructure:"store"`   // e.g., "yaml", "db"
-	Type         string        `mapstructure:"type"`    // e.g., "jwt", "apikey"
-	SecretKey    string        `mapstructure:"secret_key"`
-	ExpiresIn    time.Duration `mapstructure:"expires_in"`     // In seconds
-	APIKeyHeader string        `mapstructure:"api_key_header"` // Header name for API key (default: "X-API-Key")
-	APIKeyPrefix string        `mapstructure:"api_key_prefix"` // Optional prefix for API key validation
+	Control       string              `mapstructure:"control"` // e.g., "RBAC", "ABAC"
+	Store         string              `mapstructure:"store"`   // e.g., "yaml", "db"
+	Type          []string            `mapstructure:"type"`    // ordered list, e.g. ["jwt", "apikey"] or "jwt,apikey"
+	SecretKey     string              `mapstructure:"secret_key"`
+	ExpiresIn     time.Duration       `mapstructure:"expires_in"`     // In seconds
+	APIKeyHeader  string              `mapstructure:"api_key_header"` // Header name for API key (default: "X-API-Key")
+	APIKeyPrefix  string              `mapstructure:"api_key_prefix"` // Optional prefix for API key validation
+	Public        []string            `mapstructure:"public"`         // Anonymous routes: "GET /api/catalog/*", "/api/status" or "module:<name>"
+	Optional      []string            `mapstructure:"optional"`       // Routes where authentication is optional, same format as Public
+	DefaultPolicy string              `mapstructure:"default_policy"` // "allow" or "deny" requests without a matching resource
+	Strict        bool                `mapstructure:"strict"`         // Fail on start when a protected route has no authorization rule
+	Realm         string              `mapstructure:"realm"`          // Realm of the WWW-Authenticate challenges
+	JWT           JWTConfig           `mapstructure:"jwt"`
+	DB            AuthDBConfig        `mapstructure:"db"`
+	YAML          AuthYAMLConfig      `mapstructure:"yaml"`
+	Password      PasswordConfig      `mapstructure:"password"`
+	APIKeys       APIKeysConfig       `mapstructure:"api_keys"`
+	Audit         AuditConfig         `mapstructure:"audit"`
+	Explain       ExplainConfig       `mapstructure:"explain"`
+	Lockout       LockoutConfig       `mapstructure:"lockout"`
+	Revocation    RevocationConfig    `mapstructure:"revocation"`
+	Session       SessionConfig       `mapstructure:"session"`
+	OIDC          OIDCConfig          `mapstructure:"oidc"`
+	MTLS          MTLSConfig          `mapstructure:"mtls"`
+	HMAC          HMACConfig          `mapstructure:"hmac"`
+	MFA           MFAConfig           `mapstructure:"mfa"`
+	Impersonation ImpersonationConfig `mapstructure:"impersonation"`
+}
+
+type APIKeysConfig struct {
+	Prefix      string        `mapstructure:"prefix"`       // Visible prefix of issued keys, e.g. "wk"
+	File        string        `mapstructure:"file"`         // JSON file for keys when the auth store has no key table
+	DefaultTTL  time.Duration `mapstructure:"default_ttl"`  // Lifetime of new keys, 0 never expires
+	GracePeriod time.Duration `mapstructure:"grace_period"` // How long a rotated key keeps working
+	AllowPlain  bool          `mapstructure:"allow_plain"`  // Migration opt-in: accept the user key of the store as API key
+	AdminPath   string        `mapstructure:"admin_path"`   // Key management endpoints below server.path, empty to disable
+	AdminRoles  []string      `mapstructure:"admin_roles"`  // Roles allowed to manage keys of all users
+}
+
+type AuditConfig struct {
+	Sinks      []string `mapstructure:"sinks"`       // "file", "db" and/or "event", empty disables the audit log
+	File       string   `mapstructure:"file"`        // JSON lines file of the file sink
+	Table      string   `mapstructure:"table"`       // Table/collection of the db sink
+	SampleRate float64  `mapstructure:"sample_rate"` // Share of allow decisions that are recorded, denials are always recorded
+	Buffer     int      `mapstructure:"buffer"`      // Queued events before new events are dropped
+}
+
+type LockoutConfig struct {
+	Enabled       bool          `mapstructure:"enabled"`
+	Store         string        `mapstructure:"store"`           // "memory" (per instance) or "cache" (shared via the redis library)
+	MaxFailures   int           `mapstructure:"max_failures"`    // Failures of a user or API key before it is locked, 0 disables
+	IPMaxFailures int           `mapstructure:"ip_max_failures"` // Failures from one IP before the IP is banned, 0 disables
+	Window        time.Duration `mapstructure:"window"`          // Failures are counted within this window
+	Duration      time.Duration `mapstructure:"duration"`        // First lockout, doubled for every further lockout
+	MaxDuration   time.Duration `mapstructure:"max_duration"`    // Upper limit of the lockout
+	BanDuration   time.Duration `mapstructure:"ban_duration"`    // Ban of an IP
+	CaptchaAfter  int           `mapstructure:"captcha_after"`   // Failures after which a CAPTCHA is required, 0 disables
+	ResetAfter    time.Duration `mapstructure:"reset_after"`     // The lockout count is forgotten after this time without failures
+}
+
+type RevocationConfig struct {
+	Enabled    bool          `mapstructure:"enabled"`
+	Store      string        `mapstructure:"store"`       // "memory" (per instance) or "cache" (shared via the redis library)
+	CacheSize  int           `mapstructure:"cache_size"`  // Lookups kept in the local LRU of the cache store
+	CacheTTL   time.Duration `mapstructure:"cache_ttl"`   // Age of cached lookups, revocations of other instances apply after it
+	FailClosed bool          `mapstructure:"fail_closed"` // Reject tokens when the store is unavailable
+	AdminPath  string        `mapstructure:"admin_path"`  // Revocation endpoints below server.path, empty to disable
+	AdminRoles []string      `mapstructure:"admin_roles"` // Roles allowed to revoke tokens
+}
+
+type SessionConfig struct {
+	Store           string        `mapstructure:"store"`       // "memory" (per instance) or "cache" (shared via the redis library)
+	Path            string        `mapstructure:"path"`        // Login, logout and current session endpoints, empty to disable
+	CookieName      string        `mapstructure:"cookie_name"` // HttpOnly cookie with the session id
+	CookieDomain    string        `mapstructure:"cookie_domain"`
+	CookiePath      string        `mapstructure:"cookie_path"`
+	Secure          bool          `mapstructure:"secure"`           // Send the cookies over HTTPS only
+	SameSite        string        `mapstructure:"same_site"`        // "Lax", "Strict" or "None"
+	IdleTimeout     time.Duration `mapstructure:"idle_timeout"`     // Session ends after this time without requests
+	AbsoluteTimeout time.Duration `mapstructure:"absolute_timeout"` // Session ends this time after the login
+	CSRF            string        `mapstructure:"csrf"`             // "synchronizer", "double_submit" or "none"
+	CSRFCookieName  string        `mapstructure:"csrf_cookie_name"` // Readable cookie of double_submit
+	CSRFHeader      string        `mapstructure:"csrf_header"`      // Header with the CSRF token of unsafe requests
+	CSRFField       string        `mapstructure:"csrf_field"`       // Form field with the CSRF token, used when the header is missing
+}
+
+type OIDCConfig struct {
+	Issuer                string            `mapstructure:"issuer"`            // Expected "iss", the discovery document is read from issuer/.well-known/openid-configuration
+	DiscoveryURL          string            `mapstructure:"discovery_url"`     // Overrides the location of the discovery document
+	JWKSURL               string            `mapstructure:"jwks_url"`          // Overrides jwks_uri of the discovery document
+	Audience              []string          `mapstructure:"audience"`          // Accepted "aud" values, checked when not empty
+	RequiredScopes        []string          `mapstructure:"required_scopes"`   // Scopes every token must carry
+	Algorithms            []string          `mapstructure:"algorithms"`        // Accepted signing algorithms of JWT access tokens
+	Leeway                time.Duration     `mapstructure:"leeway"`            // Clock skew tolerance for exp/nbf/iat
+	JWKSCacheTTL          time.Duration     `mapstructure:"jwks_cache_ttl"`    // Keys are fetched again after this time
+	JWKSMinRefresh        time.Duration     `mapstructure:"jwks_min_refresh"`  // Minimum time between fetches, e.g. for tokens with unknown kid
+	HTTPTimeout           time.Duration     `mapstructure:"http_timeout"`      // Timeout of requests to the identity provider
+	Introspection         string            `mapstructure:"introspection"`     // "auto" (opaque tokens only), "always" or "never"
+	IntrospectionURL      string            `mapstructure:"introspection_url"` // Overrides introspection_endpoint of the discovery document
+	ClientID              string            `mapstructure:"client_id"`         // Client credentials of the introspection request
+	ClientSecret          string            `mapstructure:"client_secret"`
+	IntrospectionCacheTTL time.Duration     `mapstructure:"introspection_cache_ttl"` // How long introspection results are reused, 0 disables
+	SubjectClaim          string            `mapstructure:"subject_claim"`           // Claim paths (dot separated for nested claims) of the user
+	UsernameClaim         string            `mapstructure:"username_claim"`
+	GroupsClaim           string            `mapstructure:"groups_claim"`
+	RolesClaim            string            `mapstructure:"roles_claim"` // e.g. "realm_access.roles"
+	ScopeClaim            string            `mapstructure:"scope_claim"`
+	AttributeClaims       map[string]string `mapstructure:"attribute_claims"` // ABAC user attributes, attribute name to claim path
+	LookupUser            bool              `mapstructure:"lookup_user"`      // Load the user of the subject from the auth store instead of the claims
+}
+
+type MTLSConfig struct {
+	CAFile         string   `mapstructure:"ca_file"`         // PEM bundle of the client CAs, empty uses server.tls.client_ca
+	Identity       string   `mapstructure:"identity"`        // "subject" (common name), "dn", "san" or "fingerprint", matched with user key or username
+	ProxyHeader    string   `mapstructure:"proxy_header"`    // Client certificate forwarded by a TLS terminating proxy, empty disables
+	TrustedProxies []string `mapstructure:"trusted_proxies"` // IPs or CIDRs allowed to send proxy_header
+}
+
+type HMACConfig struct {
+	Store           string        `mapstructure:"store"`            // Nonces of signed requests, "memory" or "cache" (redis, shared by all instances)
+	ClockSkew       time.Duration `mapstructure:"clock_skew"`       // Accepted difference between X-Date and the server clock
+	RequiredHeaders []string      `mapstructure:"required_headers"` // Headers that must be signed besides host, x-date, x-nonce and x-content-sha256
+	SecretKey       string        `mapstructure:"secret_key"`       // Base64 AES-256 key that decrypts the hmac_secret of the users
+}
+
+type MFAConfig struct {
+	Enabled       bool          `mapstructure:"enabled"`        // TOTP second factor for resources and routes that require it
+	Issuer        string        `mapstructure:"issuer"`         // Name shown in authenticator apps, empty uses app.name
+	File          string        `mapstructure:"file"`           // JSON file for enrollments when the auth store has no mfa table
+	Skew          int           `mapstructure:"skew"`           // Accepted 30 second steps before and after the current one
+	MaxAge        time.Duration `mapstructure:"max_age"`        // How long the step-up of a session counts, 0 for the whole session
+	Header        string        `mapstructure:"header"`         // Request header with the code of per-request schemes
+	HeaderSchemes []string      `mapstructure:"header_schemes"` // Schemes that send the code in the header, e.g. basic
+	RecoveryCodes int           `mapstructure:"recovery_codes"` // Recovery codes issued per enrollment
+	Path          string        `mapstructure:"path"`           // Enrollment endpoints below server.path, empty to disable
+	AdminRoles    []string      `mapstructure:"admin_roles"`    // Roles allowed to reset the second factor of other users
+}
+
+type ImpersonationConfig struct {
+	Enabled        bool     `mapstructure:"enabled"`         // Admins may run requests as another user of the auth store
+	Header         string   `mapstructure:"header"`          // Request header with the user id or username to act as
+	Roles          []string `mapstructure:"roles"`           // Roles allowed to impersonate
+	ProtectedRoles []string `mapstructure:"protected_roles"` // Users with one of these roles cannot be impersonated
+	Forbidden      []string `mapstructure:"forbidden"`       // Routes that reject impersonated requests, same format as auth.public
+}
+
+type ExplainConfig struct {
+	Path            string   `mapstructure:"path"`             // Admin dry run endpoint below server.path, empty to disable
+	PermissionsPath string   `mapstructure:"permissions_path"` // Routes of the current user below server.path, empty to disable
+	AdminRoles      []string `mapstructure:"admin_roles"`      // Roles allowed to explain requests of other users
+}
+
+type PasswordConfig struct {
+	Algorithm string        `mapstructure:"algorithm"` // "argon2id", "bcrypt" or "scrypt" for new and upgraded hashes
+	CacheTTL  time.Duration `mapstructure:"cache_ttl"` // Accept a verified password this long without hashing again, 0 disables
+}
+
+type AuthYAMLConfig struct {
+	Watch    bool          `mapstructure:"watch"`    // Reload access.yaml when the file changes
+	Debounce time.Duration `mapstructure:"debounce"` // Wait for further changes before reloading
+}
+
+type AuthDBConfig struct {
+	TablePrefix     string        `mapstructure:"table_prefix"`     // Prefix of the auth tables/collections
+	RefreshInterval time.Duration `mapstructure:"refresh_interval"` // How long resources and groups are cached
+	CreateSchema    bool          `mapstructure:"create_schema"`    // Create missing tables on start (SQL drivers)
+}
+
+type JWTConfig struct {
+	Algorithm        string        `mapstructure:"algorithm"`          // "HS256", "RS256" or "ES256"
+	PrivateKey       string        `mapstructure:"private_key"`        // PEM file used to sign tokens (RS256/ES256)
+	PublicKey        string        `mapstructure:"public_key"`         // PEM file used to verify tokens (RS256/ES256)
+	Issuer           string        `mapstructure:"issuer"`             // Value of "iss", checked when not empty
+	Audience         []string      `mapstructure:"audience"`           // Accepted "aud" values, checked when not empty
+	Leeway           time.Duration `mapstructure:"leeway"`             // Clock skew tolerance for exp/nbf/iat
+	RefreshExpiresIn time.Duration `mapstructure:"refresh_expires_in"` // Lifetime of refresh tokens
+	GroupsClaim      string        `mapstructure:"groups_claim"`       // Claim mapped to UserAuthInfoRBAC.Groups
+	RolesClaim       string        `mapstructure:"roles_claim"`        // Claim mapped to UserAuthInfoRBAC.Roles
+	LoginPath        string        `mapstructure:"login_path"`         // Token endpoint, empty to disable
+	RefreshPath      string        `mapstructure:"refresh_path"`       // Refresh endpoint, empty to disable
+	LogoutPath       string        `mapstructure:"logout_path"`        // Logout endpoint, requires auth.revocation.enabled
 }
 
 type ModuleConfig struct {
@@ -32,14 +32,165 @@ func (c *Config) SetDefaults() map[string]any {
 		"server.read_timeout":  "30s",
 		"server.write_timeout": "30s",
 
+		// Server TLS
+		"server.tls.enabled":     false,
+		"server.tls.cert_file":   "",
+		"server.tls.key_file":    "",
+		"server.tls.client_ca":   "",
+		"server.tls.client_auth": "none",
+		"server.tls.min_version": "1.2",
+
 		// Auth
 		"auth.control":        "RBAC",
 		"auth.store":          "yaml",
-		"auth.type":           "jwt",
+		"auth.type":           []string{"jwt"},
 		"auth.secret_key":     "",
 		"auth.expires_in":     "24h", // 24 hours
 		"auth.api_key_header": "X-API-Key",
 		"auth.api_key_prefix": "",
+		"auth.public":         []string{},
+		"auth.optional":       []string{},
+		"auth.default_policy": "allow",
+		"auth.strict":         false,
+		"auth.realm":          "api",
+
+		// Auth JWT
+		"auth.jwt.algorithm":          "HS256",
+		"auth.jwt.private_key":        "",
+		"auth.jwt.public_key":         "",
+		"auth.jwt.issuer":             "",
+		"auth.jwt.audience":           []string{},
+		"auth.jwt.leeway":             "30s",
+		"auth.jwt.refresh_expires_in": "168h", // 7 days
+		"auth.jwt.groups_claim":       "groups",
+		"auth.jwt.roles_claim":        "roles",
+		"auth.jwt.login_path":         "/auth/login",
+		"auth.jwt.refresh_path":       "/auth/refresh",
+		"auth.jwt.logout_path":        "/auth/logout",
+
+		// Auth YAML Store
+		"auth.yaml.watch":    true,
+		"auth.yaml.debounce": "500ms",
+
+		// Auth DB Store
+		"auth.db.table_prefix":     "auth_",
+		"auth.db.refresh_interval": "60s",
+		"auth.db.create_schema":    true,
+
+		// Auth Password
+		"auth.password.algorithm": "argon2id",
+		"auth.password.cache_ttl": "1m",
+
+		// Auth API Keys
+		"auth.api_keys.prefix":       "wk",
+		"auth.api_keys.file":         "apikeys.json",
+		"auth.api_keys.default_ttl":  "0s",
+		"auth.api_keys.grace_period": "24h",
+		"auth.api_keys.allow_plain":  false,
+		"auth.api_keys.admin_path":   "/auth/keys",
+		"auth.api_keys.admin_roles":  []string{"admin"},
+
+		// Auth Audit
+		"auth.audit.sinks":       []string{},
+		"auth.audit.file":        "audit.log",
+		"auth.audit.table":       "auth_audit",
+		"auth.audit.sample_rate": 1.0,
+		"auth.audit.buffer":      1024,
+
+		// Auth Explain
+		"auth.explain.path":             "/auth/explain",
+		"auth.explain.permissions_path": "/auth/permissions",
+		"auth.explain.admin_roles":      []string{"admin"},
+
+		// Auth Lockout
+		"auth.lockout.enabled":         false,
+		"auth.lockout.store":           "memory",
+		"auth.lockout.max_failures":    5,
+		"auth.lockout.ip_max_failures": 20,
+		"auth.lockout.window":          "15m",
+		"auth.lockout.duration":        "1m",
+		"auth.lockout.max_duration":    "1h",
+		"auth.lockout.ban_duration":    "1h",
+		"auth.lockout.captcha_after":   0,
+		"auth.lockout.reset_after":     "24h",
+
+		// Auth Revocation
+		"auth.revocation.enabled":     false,
+		"auth.revocation.store":       "memory",
+		"auth.revocation.cache_size":  10000,
+		"auth.revocation.cache_ttl":   "5s",
+		"auth.revocation.fail_closed": false,
+		"auth.revocation.admin_path":  "/auth/revocations",
+		"auth.revocation.admin_roles": []string{"admin"},
+
+		// Auth Session
+		"auth.session.store":            "memory",
+		"auth.session.path":             "/auth/session",
+		"auth.session.cookie_name":      "session",
+		"auth.session.cookie_domain":    "",
+		"auth.session.cookie_path":      "/",
+		"auth.session.secure":           true,
+		"auth.session.same_site":        "Lax",
+		"auth.session.idle_timeout":     "30m",
+		"auth.session.absolute_timeout": "12h",
+		"auth.session.csrf":             "synchronizer",
+		"auth.session.csrf_cookie_name": "csrf_token",
+		"auth.session.csrf_header":      "X-CSRF-Token",
+		"auth.session.csrf_field":       "_csrf",
+
+		// Auth OIDC
+		"auth.oidc.issuer":                  "",
+		"auth.oidc.discovery_url":           "",
+		"auth.oidc.jwks_url":                "",
+		"auth.oidc.audience":                []string{},
+		"auth.oidc.required_scopes":         []string{},
+		"auth.oidc.algorithms":              []string{"RS256", "RS384", "RS512", "PS256", "ES256", "ES384", "EdDSA"},
+		"auth.oidc.leeway":                  "30s",
+		"auth.oidc.jwks_cache_ttl":          "1h",
+		"auth.oidc.jwks_min_refresh":        "1m",
+		"auth.oidc.http_timeout":            "10s",
+		"auth.oidc.introspection":           "auto",
+		"auth.oidc.introspection_url":       "",
+		"auth.oidc.client_id":               "",
+		"auth.oidc.client_secret":           "",
+		"auth.oidc.introspection_cache_ttl": "1m",
+		"auth.oidc.subject_claim":           "sub",
+		"auth.oidc.username_claim":          "preferred_username",
+		"auth.oidc.groups_claim":            "groups",
+		"auth.oidc.roles_claim":             "roles",
+		"auth.oidc.scope_claim":             "scope",
+		"auth.oidc.lookup_user":             false,
+
+		// Auth mTLS
+		"auth.mtls.ca_file":         "",
+		"auth.mtls.identity":        "subject",
+		"auth.mtls.proxy_header":    "",
+		"auth.mtls.trusted_proxies": []string{},
+
+		// Auth HMAC
+		"auth.hmac.store":            "memory",
+		"auth.hmac.clock_skew":       "5m",
+		"auth.hmac.required_headers": []string{},
+		"auth.hmac.secret_key":       "",
+
+		// Auth MFA
+		"auth.mfa.enabled":        false,
+		"auth.mfa.issuer":         "",
+		"auth.mfa.file":           "mfa.json",
+		"auth.mfa.skew":           1,
+		"auth.mfa.max_age":        "0s",
+		"auth.mfa.header":         "X-MFA-Code",
+		"auth.mfa.header_schemes": []string{"basic"},
+		"auth.mfa.recovery_codes": 10,
+		"auth.mfa.path":           "/auth/mfa",
+		"auth.mfa.admin_roles":    []string{"admin"},
+
+		// Auth impersonation
+		"auth.impersonation.enabled":         false,
+		"auth.impersonation.header":          "X-Act-As",
+		"auth.impersonation.roles":           []string{"impersonator"},
+		"auth.impersonation.protected_roles": []string{"admin"},
+		"auth.impersonation.forbidden":       []string{},
 
 		// Database
 		"database.driver":            "postgres",
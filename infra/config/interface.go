@@ -88,6 +88,17 @@ func LoadConfig[T Configurable](prefix string, c T, file string, ext string, pat
 	return nil
 }
 
+// ReloadConfig reads the file of a config loaded by LoadConfig again and
+// decodes it with the same defaults and environment variables
+func ReloadConfig[T Configurable](prefix string, c T, file string, ext string, path []string) error {
+	if holder := InstanceViper[file+"."+ext]; holder != nil {
+		if err := holder.Engine.ReadInConfig(); err != nil {
+			return err
+		}
+	}
+	return LoadConfig(prefix, c, file, ext, path)
+}
+
 func getKeyPrefix(prefix string, ismodule bool) string {
 	if prefix != "" {
 		if ismodule {
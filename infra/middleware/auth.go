@@ -1,97 +1,78 @@
 package middleware
 
 import (
+	"time"
+
 	"github.com/gofiber/fiber/v2"
-	"github.com/webcore-go/webcore/app/out"
+	"github.com/webcore-go/webcore/port/auth"
 )
 
 // GetAuthType returns the authentication type from the context
 func GetAuthType(c *fiber.Ctx) string {
-	authType := c.Locals("auth_type")
-	if authType == nil {
+	authType, ok := c.Locals(auth.LocalAuthType).(string)
+	if !ok {
 		return "unknown"
 	}
-	return authType.(string)
+	return authType
 }
 
 // GetUserID returns the user ID from the context
 func GetUserID(c *fiber.Ctx) any {
-	return c.Locals("user_id")
+	return c.Locals(auth.LocalUserID)
 }
 
 // GetUserRole returns the user role from the context
 func GetUserRole(c *fiber.Ctx) any {
-	return c.Locals("user_role")
+	return c.Locals(auth.LocalUserRole)
 }
 
 // GetUserPermissions returns the user permissions from the context
 func GetUserPermissions(c *fiber.Ctx) any {
-	return c.Locals("user_permissions")
+	return c.Locals(auth.LocalPermissions)
 }
 
 // GetAPIKey returns the API key from the context
 func GetAPIKey(c *fiber.Ctx) string {
-	apiKey := c.Locals("api_key")
-	if apiKey == nil {
+	apiKey, ok := c.Locals(auth.LocalAPIKey).(string)
+	if !ok {
 		return ""
 	}
-	return apiKey.(string)
+	return apiKey
 }
 
-// RoleRequired creates a middleware to check user roles
-func RoleRequired(allowedRoles ...string) fiber.Handler {
+// Secure creates a middleware that enforces route security metadata from the
+// principal of the authentication middleware
+func Secure(security *auth.RouteSecurity) fiber.Handler {
 	return func(c *fiber.Ctx) error {
-		authType := GetAuthType(c)
+		start := time.Now()
+		request := auth.NewAccessRequest(c)
+		request.Params = c.AllParams()
 
-		// For API key authentication, you might want to implement different role checking logic
-		if authType == "apikey" {
-			// In a real implementation, you might want to check API key permissions/roles
-			// For now, we'll allow access if API key is valid
+		principal := auth.GetPrincipal(c)
+		err := security.Check(principal, request)
+		if err == nil {
 			return c.Next()
 		}
 
-		// For JWT authentication, check the role claims
-		userRole := GetUserRole(c)
-		if userRole == nil {
-			return c.Status(fiber.StatusUnauthorized).JSON(out.Error(fiber.StatusUnauthorized, 2, "UNAUTHORIZED", "User role not found in context"))
+		// the allow decision was already recorded by the authentication middleware
+		authErr := auth.AsAuthError(err, auth.ErrForbidden)
+		if auditor := auth.GetAuditor(c); auditor != nil {
+			auditor.Record(auth.NewAuditEvent(c, start, auth.DecisionDeny).WithPrincipal(principal).WithError(authErr))
 		}
-
-		role := userRole.(string)
-		for _, allowedRole := range allowedRoles {
-			if role == allowedRole {
-				return c.Next()
-			}
+		if authErr.IsUnauthorized() {
+			return authErr.Respond(c, auth.GetChallenges(c))
 		}
 
-		return c.Status(fiber.StatusForbidden).JSON(out.Error(fiber.StatusUnauthorized, 2, "UNAUTHORIZED", "Insufficient permissions"))
+		return authErr.Respond(c, nil)
 	}
 }
 
+// RoleRequired creates a middleware to check user roles
+func RoleRequired(allowedRoles ...string) fiber.Handler {
+	return Secure(&auth.RouteSecurity{Roles: allowedRoles})
+}
+
 // PermissionRequired creates a middleware to check user permissions
 func PermissionRequired(requiredPermission string) fiber.Handler {
-	return func(c *fiber.Ctx) error {
-		authType := GetAuthType(c)
-
-		// For API key authentication, you might want to implement different permission checking logic
-		if authType == "apikey" {
-			// In a real implementation, you might want to check API key permissions
-			// For now, we'll allow access if API key is valid
-			return c.Next()
-		}
-
-		// For JWT authentication, check the permission claims
-		userPermissions := GetUserPermissions(c)
-		if userPermissions == nil {
-			return c.Status(fiber.StatusUnauthorized).JSON(out.Error(fiber.StatusUnauthorized, 2, "UNAUTHORIZED", "User permissions not found in context"))
-		}
-
-		permissions := userPermissions.([]any)
-		for _, permission := range permissions {
-			if permission == requiredPermission {
-				return c.Next()
-			}
-		}
-
-		return c.Status(fiber.StatusForbidden).JSON(out.Error(fiber.StatusUnauthorized, 2, "UNAUTHORIZED", "Insufficient permissions"))
-	}
+	return Secure(&auth.RouteSecurity{Permissions: []string{requiredPermission}})
 }
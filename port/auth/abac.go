@@ -0,0 +1,384 @@
+package auth
+
+import (
+	"fmt"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	EffectAllow = "Allow"
+	EffectDeny  = "Deny"
+)
+
+// Attributes is the nested attribute tree a policy condition is evaluated against.
+// The top level keys are "user", "request" and "resource", e.g. "user.id",
+// "request.params.id", "request.headers.x-tenant" or "resource.attributes.owner".
+type Attributes map[string]any
+
+// Get returns the value at a dotted attribute path
+func (a Attributes) Get(path string) (any, bool) {
+	var current any = map[string]any(a)
+	for _, part := range strings.Split(path, ".") {
+		switch node := current.(type) {
+		case map[string]any:
+			value, ok := node[part]
+			if !ok {
+				return nil, false
+			}
+			current = value
+		case map[string]string:
+			value, ok := node[part]
+			if !ok {
+				return nil, false
+			}
+			current = value
+		default:
+			return nil, false
+		}
+	}
+
+	return current, true
+}
+
+// NewAttributes collects the attributes of user, request and resource
+func NewAttributes(user *UserAuthInfoABAC, request *AccessRequest, resource *ResourceInfoABAC) Attributes {
+	attrs := Attributes{}
+
+	if user != nil {
+		username := ""
+		if user.Username != nil {
+			username = *user.Username
+		}
+		attrs["user"] = map[string]any{
+			"id":         user.UserId,
+			"username":   username,
+			"groups":     user.Groups,
+			"attributes": user.Attributes,
+		}
+	}
+
+	if request != nil {
+		now := request.Time
+		if now.IsZero() {
+			now = time.Now()
+		}
+		attrs["request"] = map[string]any{
+			"method":  request.Method,
+			"path":    request.Path,
+			"params":  request.Params,
+			"headers": request.Headers,
+			"query":   request.Query,
+			"ip":      request.IP,
+			"time":    now,
+			"hour":    now.Hour(),
+			"weekday": now.Weekday().String(),
+		}
+	}
+
+	if resource != nil {
+		attrs["resource"] = map[string]any{
+			"action":     resource.Action,
+			"path":       resource.Path,
+			"method":     resource.Method,
+			"attributes": resource.Attributes,
+		}
+	}
+
+	return attrs
+}
+
+// EvaluatePolicies applies deny-overrides: a matching Deny policy always wins,
+// otherwise at least one matching Allow policy is required.
+func EvaluatePolicies(policies []PolicyABAC, action string, attrs Attributes) (bool, error) {
+	allowed := false
+	for _, policy := range policies {
+		if !policy.AppliesTo(action) {
+			continue
+		}
+
+		ok, err := EvaluateConditions(policy.Condition, attrs)
+		if err != nil {
+			return false, err
+		}
+		if !ok {
+			continue
+		}
+
+		switch {
+		case strings.EqualFold(policy.Effect, EffectDeny):
+			return false, nil
+		case strings.EqualFold(policy.Effect, EffectAllow):
+			allowed = true
+		default:
+			return false, fmt.Errorf("Unknown policy effect %s", policy.Effect)
+		}
+	}
+
+	return allowed, nil
+}
+
+// EvaluateConditions returns true when all conditions match (AND)
+func EvaluateConditions(conditions []ConditionABAC, attrs Attributes) (bool, error) {
+	for _, condition := range conditions {
+		ok, err := condition.Evaluate(attrs)
+		if err != nil || !ok {
+			return false, err
+		}
+	}
+
+	return true, nil
+}
+
+// AppliesTo checks whether the policy covers the action, empty or "*" covers all actions
+func (p *PolicyABAC) AppliesTo(action string) bool {
+	return p.Action == "" || p.Action == "*" || p.Action == action
+}
+
+// Evaluate evaluates a single comparison or a nested AND ("all") / OR ("any") group
+func (c *ConditionABAC) Evaluate(attrs Attributes) (bool, error) {
+	if len(c.All) > 0 || len(c.Any) > 0 {
+		if len(c.All) > 0 {
+			ok, err := EvaluateConditions(c.All, attrs)
+			if err != nil || !ok {
+				return false, err
+			}
+		}
+
+		if len(c.Any) > 0 {
+			for _, condition := range c.Any {
+				ok, err := condition.Evaluate(attrs)
+				if err != nil {
+					return false, err
+				}
+				if ok {
+					return true, nil
+				}
+			}
+			return false, nil
+		}
+
+		return true, nil
+	}
+
+	// a missing attribute or reference never matches, also for the negated
+	// operators, so an Allow policy fails closed
+	actual, found := attrs.Get(c.Attribute)
+	expected, resolved := resolveValue(c.Value, attrs)
+
+	switch strings.ToLower(c.Operator) {
+	case "eq", "":
+		return found && equalValues(actual, expected), nil
+	case "ne":
+		return found && resolved && !equalValues(actual, expected), nil
+	case "in":
+		return found && inValues(actual, expected), nil
+	case "not_in":
+		return found && resolved && !inValues(actual, expected), nil
+	case "gt":
+		cmp, ok := compareValues(actual, expected)
+		return found && ok && cmp > 0, nil
+	case "lt":
+		cmp, ok := compareValues(actual, expected)
+		return found && ok && cmp < 0, nil
+	case "contains":
+		return found && containsValue(actual, expected), nil
+	case "prefix":
+		return found && strings.HasPrefix(toString(actual), toString(expected)), nil
+	case "regex":
+		// patterns of the policy are cached, patterns taken from the request are
+		// chosen by the client and compiled per evaluation
+		re, err := compileRegex(toString(expected), !isReference(c.Value))
+		if err != nil {
+			return false, err
+		}
+		return found && re.MatchString(toString(actual)), nil
+	}
+
+	return false, fmt.Errorf("Unknown condition operator %s", c.Operator)
+}
+
+// resolveValue replaces "${attribute.path}" with the attribute value, so
+// conditions can compare two attributes (e.g. request.params.id eq ${user.id}).
+// false when the referenced attribute does not exist.
+func resolveValue(value any, attrs Attributes) (any, bool) {
+	if !isReference(value) {
+		return value, true
+	}
+
+	s := value.(string)
+	return attrs.Get(s[2 : len(s)-1])
+}
+
+// isReference reports whether the value is an attribute reference "${...}"
+func isReference(value any) bool {
+	s, ok := value.(string)
+	return ok && strings.HasPrefix(s, "${") && strings.HasSuffix(s, "}")
+}
+
+func equalValues(a any, b any) bool {
+	if cmp, ok := compareValues(a, b); ok {
+		return cmp == 0
+	}
+	return reflect.DeepEqual(a, b)
+}
+
+func inValues(actual any, expected any) bool {
+	list := toList(expected)
+	if list == nil {
+		return false
+	}
+
+	// a list attribute (e.g. user.groups) matches when any element is in the list
+	if actualList := toList(actual); actualList != nil {
+		for _, a := range actualList {
+			if inValues(a, list) {
+				return true
+			}
+		}
+		return false
+	}
+
+	for _, item := range list {
+		if equalValues(actual, item) {
+			return true
+		}
+	}
+	return false
+}
+
+func containsValue(actual any, expected any) bool {
+	if list := toList(actual); list != nil {
+		for _, item := range list {
+			if equalValues(item, expected) {
+				return true
+			}
+		}
+		return false
+	}
+
+	return strings.Contains(toString(actual), toString(expected))
+}
+
+// compareValues compares numbers, times or strings; ok is false when the values are not comparable
+func compareValues(a any, b any) (int, bool) {
+	if a == nil || b == nil {
+		return 0, false
+	}
+
+	if fa, ok := toFloat(a); ok {
+		if fb, ok := toFloat(b); ok {
+			switch {
+			case fa < fb:
+				return -1, true
+			case fa > fb:
+				return 1, true
+			}
+			return 0, true
+		}
+	}
+
+	if ta, ok := toTime(a); ok {
+		if tb, ok := toTime(b); ok {
+			return ta.Compare(tb), true
+		}
+	}
+
+	sa, okA := a.(string)
+	sb, okB := b.(string)
+	if okA && okB {
+		return strings.Compare(sa, sb), true
+	}
+
+	return 0, false
+}
+
+func toFloat(value any) (float64, bool) {
+	switch v := value.(type) {
+	case int:
+		return float64(v), true
+	case int32:
+		return float64(v), true
+	case int64:
+		return float64(v), true
+	case uint:
+		return float64(v), true
+	case uint32:
+		return float64(v), true
+	case uint64:
+		return float64(v), true
+	case float32:
+		return float64(v), true
+	case float64:
+		return v, true
+	case string:
+		f, err := strconv.ParseFloat(v, 64)
+		return f, err == nil
+	}
+	return 0, false
+}
+
+func toTime(value any) (time.Time, bool) {
+	switch v := value.(type) {
+	case time.Time:
+		return v, true
+	case string:
+		t, err := time.Parse(time.RFC3339, v)
+		return t, err == nil
+	}
+	return time.Time{}, false
+}
+
+func toString(value any) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case time.Time:
+		return v.Format(time.RFC3339)
+	}
+	return fmt.Sprint(value)
+}
+
+func toList(value any) []any {
+	if value == nil {
+		return nil
+	}
+
+	v := reflect.ValueOf(value)
+	if v.Kind() != reflect.Slice && v.Kind() != reflect.Array {
+		return nil
+	}
+
+	list := make([]any, v.Len())
+	for i := range list {
+		list[i] = v.Index(i).Interface()
+	}
+	return list
+}
+
+// regexCache holds the literal patterns of the loaded policies, so it is
+// bounded by the policy files and the database store
+var regexCache sync.Map
+
+func compileRegex(pattern string, cache bool) (*regexp.Regexp, error) {
+	if cache {
+		if re, ok := regexCache.Load(pattern); ok {
+			return re.(*regexp.Regexp), nil
+		}
+	}
+
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid regex in condition: %v", err)
+	}
+	if cache {
+		regexCache.Store(pattern, re)
+	}
+	return re, nil
+}
@@ -0,0 +1,62 @@
+package auth
+
+import (
+	"context"
+	"strings"
+	"time"
+)
+
+// APIKey is a managed API key. Only the hash of the secret is stored; the
+// plain key is shown once when the key is created or rotated.
+type APIKey struct {
+	Id         string     `json:"id"`
+	Prefix     string     `json:"prefix"` // visible part of the key, e.g. "wk_3f9a1c2b7d40"
+	Hash       string     `json:"-"`      // hex SHA-256 of the secret
+	UserId     string     `json:"user_id"`
+	Name       string     `json:"name"`
+	Scopes     []string   `json:"scopes"` // empty allows every action of the user
+	CreatedAt  time.Time  `json:"created_at"`
+	ExpiresAt  *time.Time `json:"expires_at,omitempty"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+	ReplacedBy string     `json:"replaced_by,omitempty"` // id of the key created by rotation
+	GraceUntil *time.Time `json:"grace_until,omitempty"` // a rotated key is accepted until then
+}
+
+// IsActive reports whether the key can authenticate at the given time
+func (k *APIKey) IsActive(now time.Time) bool {
+	if k.RevokedAt != nil {
+		return false
+	}
+	if k.ExpiresAt != nil && now.After(*k.ExpiresAt) {
+		return false
+	}
+	if k.GraceUntil != nil && now.After(*k.GraceUntil) {
+		return false
+	}
+	return true
+}
+
+// IAPIKeyStore persists managed API keys
+type IAPIKeyStore interface {
+	CreateAPIKey(ctx context.Context, key *APIKey) error
+	GetAPIKey(ctx context.Context, id string) (*APIKey, error)
+	ListAPIKeys(ctx context.Context, userId string) ([]*APIKey, error) // empty userId lists all keys
+	UpdateAPIKey(ctx context.Context, key *APIKey) error
+	// TouchAPIKey writes only the last use, so it never undoes a concurrent revoke or rotate
+	TouchAPIKey(ctx context.Context, id string, at time.Time) error
+}
+
+// ScopeAllows reports whether one of the scopes grants the action. A scope is
+// "*", an exact action or a prefix ending with ".*" such as "order.*".
+func ScopeAllows(scopes []string, action string) bool {
+	for _, scope := range scopes {
+		if scope == "*" || scope == action {
+			return true
+		}
+		if prefix, ok := strings.CutSuffix(scope, "*"); ok && action != "" && strings.HasPrefix(action, prefix) {
+			return true
+		}
+	}
+	return false
+}
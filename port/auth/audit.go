@@ -0,0 +1,207 @@
+package auth
+
+import (
+	"io"
+	"math/rand/v2"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/webcore-go/webcore/infra/logger"
+)
+
+// key in fiber.Ctx locals with the Auditor of the authentication middleware
+const LocalAuditor = "auth_auditor"
+
+// Decisions of an AuditEvent
+const (
+	DecisionAllow = "allow"
+	DecisionDeny  = "deny"
+)
+
+// AuditEvent records one authentication failure or authorization decision
+type AuditEvent struct {
+	Time       time.Time     `json:"time"`
+	RequestID  string        `json:"request_id,omitempty"`
+	Decision   string        `json:"decision"`         // DecisionAllow or DecisionDeny
+	Reason     string        `json:"reason,omitempty"` // why the request was denied
+	Code       string        `json:"code,omitempty"`   // errorName of the response, e.g. CREDENTIALS_EXPIRED
+	Status     int           `json:"status"`
+	Principal  string        `json:"principal,omitempty"` // username, or a hash of the user id when the user has no name
+	Credential string        `json:"credential,omitempty"`
+	Actor      string        `json:"actor,omitempty"` // admin who impersonated the principal
+	Scheme     string        `json:"scheme,omitempty"`
+	Method     string        `json:"method"`
+	Path       string        `json:"path"`
+	Resource   string        `json:"resource,omitempty"` // path pattern of the matched resource
+	Action     string        `json:"action,omitempty"`
+	IP         string        `json:"ip,omitempty"`
+	Latency    time.Duration `json:"latency_ns"`
+}
+
+// IAuditSink stores audit events. Write is called from a single goroutine.
+type IAuditSink interface {
+	Write(event *AuditEvent) error
+}
+
+// NewAuditEvent fills the request attributes of an event, the latency is
+// measured from start
+func NewAuditEvent(ctx *fiber.Ctx, start time.Time, decision string) *AuditEvent {
+	event := &AuditEvent{
+		Time:     start,
+		Decision: decision,
+		Status:   fiber.StatusOK,
+		Method:   ctx.Method(),
+		Path:     ctx.Path(),
+		IP:       ctx.IP(),
+		Latency:  time.Since(start),
+	}
+
+	if requestID, ok := ctx.Locals("request_id").(string); ok {
+		event.RequestID = requestID
+	} else {
+		event.RequestID = ctx.Get(fiber.HeaderXRequestID)
+	}
+
+	return event
+}
+
+// WithPrincipal adds the identity and the matched resource of the principal
+func (e *AuditEvent) WithPrincipal(principal *Principal) *AuditEvent {
+	if principal == nil {
+		return e
+	}
+
+	e.Principal = principal.Name()
+	if principal.Actor != nil {
+		e.Actor = principal.Actor.Name()
+	}
+	e.Credential = principal.CredentialId
+	e.Scheme = principal.AuthType
+	if principal.Resource != nil {
+		e.Resource = principal.Resource.GetPath()
+		e.Action = principal.Resource.GetAction()
+	}
+	return e
+}
+
+// WithError adds the response of a denied request
+func (e *AuditEvent) WithError(err *AuthError) *AuditEvent {
+	e.Status = err.Status
+	e.Code = err.Name
+	e.Reason = err.Reason()
+	return e
+}
+
+// Auditor writes audit events to its sinks in the background, so slow sinks
+// do not delay requests. Allowed requests are sampled, denials are always kept.
+type Auditor struct {
+	Sinks      []IAuditSink
+	SampleRate float64 // share of allow decisions that are recorded, 0..1
+
+	events  chan *AuditEvent
+	dropped atomic.Int64
+	done    chan struct{}
+	mu      sync.RWMutex // guards sending on events against closing it
+	closed  bool
+}
+
+func NewAuditor(sinks []IAuditSink, sampleRate float64, buffer int) *Auditor {
+	if buffer <= 0 {
+		buffer = 1
+	}
+
+	a := &Auditor{
+		Sinks:      sinks,
+		SampleRate: sampleRate,
+		events:     make(chan *AuditEvent, buffer),
+		done:       make(chan struct{}),
+	}
+
+	go a.run()
+	return a
+}
+
+func (a *Auditor) run() {
+	defer close(a.done)
+	for event := range a.events {
+		for _, sink := range a.Sinks {
+			if err := sink.Write(event); err != nil {
+				logger.Error("Write audit event failed", "sink", sinkName(sink), "error", err)
+			}
+		}
+	}
+}
+
+// Record queues the event. When the queue is full the event is dropped and
+// counted, the request is never blocked.
+func (a *Auditor) Record(event *AuditEvent) {
+	if a == nil {
+		return
+	}
+
+	// impersonated requests are always recorded
+	if event.Decision == DecisionAllow && event.Actor == "" && a.SampleRate < 1 && rand.Float64() >= a.SampleRate {
+		return
+	}
+
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	if a.closed {
+		return
+	}
+
+	select {
+	case a.events <- event:
+	default:
+		if dropped := a.dropped.Add(1); dropped == 1 || dropped%1000 == 0 {
+			logger.Warn("Audit queue is full, events are dropped", "dropped", dropped)
+		}
+	}
+}
+
+// Dropped returns the number of events lost because the queue was full
+func (a *Auditor) Dropped() int64 {
+	return a.dropped.Load()
+}
+
+// Install library
+func (a *Auditor) Install(args ...any) error {
+	return nil
+}
+
+// Uninstall writes the queued events and closes the sinks
+func (a *Auditor) Uninstall() error {
+	a.mu.Lock()
+	if a.closed {
+		a.mu.Unlock()
+		return nil
+	}
+	a.closed = true
+	close(a.events)
+	a.mu.Unlock()
+
+	<-a.done
+	for _, sink := range a.Sinks {
+		if closer, ok := sink.(io.Closer); ok {
+			if err := closer.Close(); err != nil {
+				logger.Warn("Close audit sink failed", "sink", sinkName(sink), "error", err)
+			}
+		}
+	}
+	return nil
+}
+
+// GetAuditor returns the Auditor of the authentication middleware, nil when auditing is off
+func GetAuditor(ctx *fiber.Ctx) *Auditor {
+	auditor, _ := ctx.Locals(LocalAuditor).(*Auditor)
+	return auditor
+}
+
+func sinkName(sink IAuditSink) string {
+	if named, ok := sink.(interface{ Name() string }); ok {
+		return named.Name()
+	}
+	return "unknown"
+}
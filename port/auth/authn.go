@@ -10,10 +10,12 @@ type IAuthenticationManager interface {
 	GetAuthenticatonHandler() fiber.Handler
 }
 
+// IAuthValidator extracts the credential of a request and matches it with
+// users of the store. Validators are shared by all requests, so the credential
+// is returned by ValidateKey instead of being kept in the validator.
 type IAuthValidator interface {
 	Name() string
-	GetValue() string
-	ValidateKey(ctx *fiber.Ctx) error
+	ValidateKey(ctx *fiber.Ctx) (string, error)
 	VerifyUser(ctx *fiber.Ctx, userKey string, userInfo IUserAuthInfo) (bool, error)
 }
 
@@ -29,19 +31,17 @@ func NewAuthenticator(validator IAuthValidator, loader IStoreWrapper) *Authentic
 	}
 }
 
-func (a *Authenticator) Check(ctx *fiber.Ctx) error {
-	// userKey := a.Validator.GetValue()
-	err := a.Loader.CheckUser(ctx, a.Validator)
+func (a *Authenticator) Check(ctx *fiber.Ctx, userKey string) (IUserAuthInfo, error) {
+	userInfo, err := a.Loader.CheckUser(ctx, a.Validator, userKey)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	userInfo := a.Loader.GetLoadedUser()
 	if userInfo == nil {
-		return fmt.Errorf("User not found: nil")
+		return nil, fmt.Errorf("User not found: nil")
 	}
 
-	return nil
+	return userInfo, nil
 }
 
 type IUserAuthInfo interface {
@@ -52,11 +52,12 @@ type UserAuthInfo struct {
 }
 
 type UserAuthInfoRBAC struct {
-	UserId   string   `mapstructure:"key"`         // used by Api Key and JWT
-	Username *string  `mapstructure:"user"`        // used by Basic Auth
-	Password *string  `mapstructure:"password"`    // used by Basic Auth
-	Groups   []string `mapstructure:"groups"`      // used by JWT Auth
-	Roles    []string `mapstructure:"permissions"` // combination of roles from all user groups owned by user
+	UserId     string   `mapstructure:"key"`         // used by Api Key and JWT
+	Username   *string  `mapstructure:"user"`        // used by Basic Auth
+	Password   *string  `mapstructure:"password"`    // used by Basic Auth
+	HmacSecret *string  `mapstructure:"hmac_secret"` // used by HMAC signing, encrypted with auth.hmac.secret_key
+	Groups     []string `mapstructure:"groups"`      // used by JWT Auth
+	Roles      []string `mapstructure:"permissions"` // combination of roles from all user groups owned by user
 }
 
 func (u1 *UserAuthInfoRBAC) GetControlType() string {
@@ -68,24 +69,28 @@ func (u1 *UserAuthInfoRBAC) GetUserID() string {
 }
 
 type PolicyABAC struct {
-	Effect    string // 'Allow' or 'Deny'
-	Action    string
-	Condition []ConditionABAC // condition with 'AND' operator (Nested and OR operation not supported yet)
+	Effect    string          `mapstructure:"effect"`    // 'Allow' or 'Deny'
+	Action    string          `mapstructure:"action"`    // resource action, empty or '*' for all actions
+	Condition []ConditionABAC `mapstructure:"condition"` // condition with 'AND' operator, use 'all'/'any' for nested groups
 }
 
 type ConditionABAC struct {
-	Attribute string
-	Operator  string
-	Value     any
+	Attribute string          `mapstructure:"attribute"` // e.g. 'user.attributes.department', 'request.params.id'
+	Operator  string          `mapstructure:"operator"`  // eq, ne, in, not_in, gt, lt, contains, regex, prefix
+	Value     any             `mapstructure:"value"`     // literal or '${attribute.path}'
+	All       []ConditionABAC `mapstructure:"all"`       // nested group with 'AND' operator
+	Any       []ConditionABAC `mapstructure:"any"`       // nested group with 'OR' operator
 }
 
 type UserAuthInfoABAC struct {
 	UserAuthInfo
-	UserId   string       `mapstructure:"key"`      // used by Api Key and JWT
-	Username *string      `mapstructure:"user"`     // used by Basic Auth
-	Password *string      `mapstructure:"password"` // used by Basic Auth
-	Groups   []string     `mapstructure:"groups"`   // used by JWT Auth
-	Policies []PolicyABAC `mapstructure:"policies"`
+	UserId     string         `mapstructure:"key"`         // used by Api Key and JWT
+	Username   *string        `mapstructure:"user"`        // used by Basic Auth
+	Password   *string        `mapstructure:"password"`    // used by Basic Auth
+	HmacSecret *string        `mapstructure:"hmac_secret"` // used by HMAC signing, encrypted with auth.hmac.secret_key
+	Groups     []string       `mapstructure:"groups"`      // used by JWT Auth
+	Attributes map[string]any `mapstructure:"attributes"`
+	Policies   []PolicyABAC   `mapstructure:"policies"`
 }
 
 func (u2 *UserAuthInfoABAC) GetControlType() string {
@@ -3,8 +3,10 @@ package auth
 import (
 	"fmt"
 	"slices"
+	"strings"
+	"time"
 
-	"github.com/webcore-go/webcore/infra/logger"
+	"github.com/gofiber/fiber/v2"
 	"github.com/webcore-go/webcore/port"
 )
 
@@ -15,11 +17,49 @@ type IAuthorizationManager interface {
 type IAuthorization interface {
 	port.Library
 
-	Check(user IUserAuthInfo, method string, path string) error
+	Check(user IUserAuthInfo, request *AccessRequest) (IResourceInfo, error)
 }
 
+// AccessRequest holds the request attributes used by the authorization check
+type AccessRequest struct {
+	Method  string
+	Path    string
+	Params  map[string]string // path parameters of the matched resource
+	Headers map[string]string // header names in lower case
+	Query   map[string]string
+	IP      string
+	Time    time.Time
+}
+
+func NewAccessRequest(ctx *fiber.Ctx) *AccessRequest {
+	headers := make(map[string]string)
+	for name, values := range ctx.GetReqHeaders() {
+		if len(values) > 0 {
+			headers[strings.ToLower(name)] = values[0]
+		}
+	}
+
+	return &AccessRequest{
+		Method:  ctx.Method(),
+		Path:    ctx.Path(),
+		Params:  make(map[string]string),
+		Headers: headers,
+		Query:   ctx.Queries(),
+		IP:      ctx.IP(),
+		Time:    time.Now(),
+	}
+}
+
+// Values of auth.default_policy, used for requests without a matching resource
+const (
+	DefaultPolicyAllow = "allow"
+	DefaultPolicyDeny  = "deny"
+)
+
 type Authorization struct {
-	Loader IStoreWrapper
+	Loader        IStoreWrapper
+	DefaultPolicy string            // DefaultPolicyAllow or DefaultPolicyDeny
+	Security      *SecurityRegistry // route rules that cover paths without a resource, may be nil
 }
 
 func NewAuthorization(loader IStoreWrapper) (*Authorization, error) {
@@ -28,21 +68,26 @@ func NewAuthorization(loader IStoreWrapper) (*Authorization, error) {
 	}, nil
 }
 
-func (a *Authorization) Check(user IUserAuthInfo, method string, path string) error {
-	ok, err := a.Loader.CheckResource(method, path)
+// Check authorizes the user for the request and returns the matched resource,
+// which is nil when no resource is defined for the path
+func (a *Authorization) Check(user IUserAuthInfo, request *AccessRequest) (IResourceInfo, error) {
+	resourceInfo, err := a.Loader.CheckResource(request.Method, request.Path)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	if ok {
-		resourceInfo := a.Loader.GetLoadedResource()
-		if resourceInfo != nil {
-			return resourceInfo.IsUserPermitted(user)
-		}
+	if resourceInfo != nil {
+		request.Params = PathParams(resourceInfo.GetPath(), request.Path)
+		return resourceInfo, resourceInfo.IsUserPermitted(user, request)
+	}
+
+	// default permission untuk resource yang tidak memiliki permission,
+	// kecuali route sudah memiliki aturan sendiri (roles, permissions, action)
+	if a.DefaultPolicy == DefaultPolicyDeny && (a.Security == nil || !a.Security.IsCovered(request.Method, request.Path)) {
+		return nil, ErrForbidden.Withf("no authorization rule for %s %s", request.Method, request.Path)
 	}
 
-	// defaulf permission untuk resource yang tidak memiliki permission
-	return nil
+	return nil, nil
 }
 
 type IResourceInfo interface {
@@ -50,7 +95,7 @@ type IResourceInfo interface {
 	GetMethod() string
 	GetPath() string
 	GetControlType() string // 'RBAC' or 'ABAC'
-	IsUserPermitted(user IUserAuthInfo) error
+	IsUserPermitted(user IUserAuthInfo, request *AccessRequest) error
 }
 
 type ResourceInfoRBAC struct {
@@ -58,6 +103,7 @@ type ResourceInfoRBAC struct {
 	Path           string   `mapstructure:"path"`
 	Method         string   `mapstructure:"method"`
 	PermittedRoles []string `mapstructure:"permissions"`
+	MFA            bool     `mapstructure:"mfa"` // requires a verified second factor
 }
 
 func (r1 *ResourceInfoRBAC) GetControlType() string {
@@ -76,7 +122,11 @@ func (r1 *ResourceInfoRBAC) GetPath() string {
 	return r1.Path
 }
 
-func (r1 *ResourceInfoRBAC) IsUserPermitted(user IUserAuthInfo) error {
+func (r1 *ResourceInfoRBAC) RequiresMFA() bool {
+	return r1.MFA
+}
+
+func (r1 *ResourceInfoRBAC) IsUserPermitted(user IUserAuthInfo, request *AccessRequest) error {
 	// Ensure the user auth info is compatible (RBAC).
 	if user.GetControlType() != "RBAC" {
 		return fmt.Errorf("Load wrong User Access Control Type User (%s) and Resource (RBAC)", user.GetControlType())
@@ -103,10 +153,12 @@ func (r1 *ResourceInfoRBAC) IsUserPermitted(user IUserAuthInfo) error {
 }
 
 type ResourceInfoABAC struct {
-	Action            string       `mapstructure:"action"`
-	Path              string       `mapstructure:"path"`
-	Method            string       `mapstructure:"method"`
-	PermittedPolicies []PolicyABAC `mapstructure:"policies"`
+	Action            string         `mapstructure:"action"`
+	Path              string         `mapstructure:"path"`
+	Method            string         `mapstructure:"method"`
+	Attributes        map[string]any `mapstructure:"attributes"`
+	PermittedPolicies []PolicyABAC   `mapstructure:"policies"`
+	MFA               bool           `mapstructure:"mfa"` // requires a verified second factor
 }
 
 func (r2 *ResourceInfoABAC) GetControlType() string {
@@ -125,32 +177,40 @@ func (r2 *ResourceInfoABAC) GetPath() string {
 	return r2.Path
 }
 
-func (r2 *ResourceInfoABAC) IsUserPermitted(user IUserAuthInfo) error {
-	// Ensure the user auth info is compatible (RBAC).
-	if user.GetControlType() != "RBAC" {
-		return fmt.Errorf("Load wrong User Access Control Type User (%s) and Resource (RBAC)", user.GetControlType())
+func (r2 *ResourceInfoABAC) RequiresMFA() bool {
+	return r2.MFA
+}
+
+func (r2 *ResourceInfoABAC) IsUserPermitted(user IUserAuthInfo, request *AccessRequest) error {
+	// Ensure the user auth info is compatible (ABAC).
+	if user.GetControlType() != "ABAC" {
+		return fmt.Errorf("Load wrong User Access Control Type User (%s) and Resource (ABAC)", user.GetControlType())
 	}
 
-	// Type assert the user to the concrete RBAC type to access roles.
+	// Type assert the user to the concrete ABAC type to access policies.
 	abacUser, ok := user.(*UserAuthInfoABAC)
 	if !ok {
-		// This case should ideally not be reached if GetControlType() is 'RBAC',
-		// but it's a safe check to have.
-		return fmt.Errorf("RBAC properties not found in user")
+		return fmt.Errorf("ABAC properties not found in user")
 	}
 
-	// Check if any of the user's roles are in the permitted set.
-	for _, userPolicy := range abacUser.Policies {
-		if r2.IsAccessGranted(userPolicy, r2.PermittedPolicies) {
-			// The user has a permitted role, grant access.
-			return nil
-		}
+	// Resource policies and user policies are evaluated together.
+	policies := make([]PolicyABAC, 0, len(r2.PermittedPolicies)+len(abacUser.Policies))
+	policies = append(policies, r2.PermittedPolicies...)
+	policies = append(policies, abacUser.Policies...)
+
+	granted, err := r2.IsAccessGranted(policies, NewAttributes(abacUser, request, r2))
+	if err != nil {
+		return err
+	}
+
+	if granted {
+		return nil
 	}
 
 	return fmt.Errorf("User access denied")
 }
 
-func (r2 *ResourceInfoABAC) IsAccessGranted(userPolicy PolicyABAC, policies []PolicyABAC) bool {
-	logger.Fatal("ABAC Policy enforcement logic not implemented yet")
-	return false
+// IsAccessGranted evaluates the policies for the resource action with deny-overrides
+func (r2 *ResourceInfoABAC) IsAccessGranted(policies []PolicyABAC, attrs Attributes) (bool, error) {
+	return EvaluatePolicies(policies, r2.Action, attrs)
 }
@@ -0,0 +1,176 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/webcore-go/webcore/app/out"
+	"github.com/webcore-go/webcore/infra/logger"
+)
+
+// key in fiber.Ctx locals with the challenges of a route that was passed without authentication
+const LocalChallenges = "auth_challenges"
+
+// AuthError is an authentication or authorization failure with a stable
+// error code. Message is sent to the client, Cause is only logged because it
+// may contain the submitted credential.
+type AuthError struct {
+	Status  int
+	Code    int
+	Name    string
+	Message string
+	Scope   string // required scope of ErrInsufficientScope, used in the challenge
+	Cause   error
+
+	RetryAfter time.Duration // sent as Retry-After header when set
+}
+
+// Error codes of out.Response for authentication and authorization failures
+var (
+	ErrCredentialsMissing   = &AuthError{Status: fiber.StatusUnauthorized, Code: 10, Name: "CREDENTIALS_MISSING", Message: "Authentication required"}
+	ErrCredentialsMalformed = &AuthError{Status: fiber.StatusUnauthorized, Code: 11, Name: "CREDENTIALS_MALFORMED", Message: "Malformed credentials"}
+	ErrCredentialsInvalid   = &AuthError{Status: fiber.StatusUnauthorized, Code: 12, Name: "CREDENTIALS_INVALID", Message: "Invalid credentials"}
+	ErrCredentialsExpired   = &AuthError{Status: fiber.StatusUnauthorized, Code: 13, Name: "CREDENTIALS_EXPIRED", Message: "Credentials have expired"}
+	ErrCredentialsRevoked   = &AuthError{Status: fiber.StatusUnauthorized, Code: 14, Name: "CREDENTIALS_REVOKED", Message: "Credentials have been revoked"}
+	ErrForbidden            = &AuthError{Status: fiber.StatusForbidden, Code: 3, Name: "FORBIDDEN", Message: "Access denied"}
+	ErrInsufficientScope    = &AuthError{Status: fiber.StatusForbidden, Code: 15, Name: "INSUFFICIENT_SCOPE", Message: "Insufficient scope"}
+	ErrTooManyAttempts      = &AuthError{Status: fiber.StatusTooManyRequests, Code: 16, Name: "TOO_MANY_ATTEMPTS", Message: "Too many failed attempts, try again later"}
+	ErrCaptchaRequired      = &AuthError{Status: fiber.StatusUnauthorized, Code: 17, Name: "CAPTCHA_REQUIRED", Message: "CAPTCHA verification required"}
+	ErrCSRFInvalid          = &AuthError{Status: fiber.StatusForbidden, Code: 18, Name: "CSRF_INVALID", Message: "Invalid or missing CSRF token"}
+	ErrMFARequired          = &AuthError{Status: fiber.StatusUnauthorized, Code: 19, Name: "MFA_REQUIRED", Message: "Second factor required"}
+	ErrMFAInvalid           = &AuthError{Status: fiber.StatusUnauthorized, Code: 20, Name: "MFA_INVALID", Message: "Invalid second factor code"}
+	ErrImpersonationDenied  = &AuthError{Status: fiber.StatusForbidden, Code: 21, Name: "IMPERSONATION_DENIED", Message: "Impersonation not allowed"}
+	ErrStoreUnavailable     = &AuthError{Status: fiber.StatusServiceUnavailable, Code: 22, Name: "AUTH_STORE_UNAVAILABLE", Message: "Authentication is temporarily unavailable"}
+)
+
+func (e *AuthError) Error() string {
+	if e.Cause != nil {
+		return e.Message + ": " + e.Cause.Error()
+	}
+	return e.Message
+}
+
+func (e *AuthError) Unwrap() error {
+	return e.Cause
+}
+
+// Is matches errors of the same code, so errors.Is(err, ErrCredentialsExpired) works for wrapped copies
+func (e *AuthError) Is(target error) bool {
+	t, ok := target.(*AuthError)
+	return ok && t.Code == e.Code
+}
+
+// With returns a copy of the error with the internal cause
+func (e *AuthError) With(cause error) *AuthError {
+	copied := *e
+	copied.Cause = cause
+	return &copied
+}
+
+// Withf returns a copy of the error with a formatted internal cause
+func (e *AuthError) Withf(format string, args ...any) *AuthError {
+	return e.With(fmt.Errorf(format, args...))
+}
+
+// WithScope returns a copy of ErrInsufficientScope naming the required scope
+func (e *AuthError) WithScope(scope string) *AuthError {
+	copied := *e
+	copied.Scope = scope
+	if copied.Cause == nil {
+		copied.Cause = fmt.Errorf("scope %s required", scope)
+	}
+	return &copied
+}
+
+// WithRetryAfter returns a copy of the error telling the client when to try again
+func (e *AuthError) WithRetryAfter(wait time.Duration) *AuthError {
+	copied := *e
+	copied.RetryAfter = wait
+	return &copied
+}
+
+// IsUnauthorized reports whether the client has to (re)authenticate
+func (e *AuthError) IsUnauthorized() bool {
+	return e.Status == fiber.StatusUnauthorized
+}
+
+// IsCountedFailure reports whether the error counts as a failed attempt for
+// the lockout: a credential was sent and the store could be asked
+func (e *AuthError) IsCountedFailure() bool {
+	return !errors.Is(e, ErrCredentialsMissing) && !errors.Is(e, ErrStoreUnavailable)
+}
+
+// Reason describes the failure for logs and reports. The cause of an
+// authentication error may contain the credential and is left out.
+func (e *AuthError) Reason() string {
+	if e.IsUnauthorized() || e.Cause == nil {
+		return e.Message
+	}
+	return e.Cause.Error()
+}
+
+// AsAuthError returns the AuthError in the chain of err, or fallback with err as cause
+func AsAuthError(err error, fallback *AuthError) *AuthError {
+	var authErr *AuthError
+	if errors.As(err, &authErr) {
+		return authErr
+	}
+	return fallback.With(err)
+}
+
+// IChallenger is implemented by validators that describe their credential in
+// a WWW-Authenticate challenge, e.g. `Bearer realm="api", error="invalid_token"`
+type IChallenger interface {
+	Challenge(err *AuthError) string
+}
+
+// Respond writes the error as out.Response with one WWW-Authenticate header per challenge
+func (e *AuthError) Respond(ctx *fiber.Ctx, challenges []string) error {
+	if e.Cause != nil {
+		logger.Debug("Auth request rejected", "error", e.Name, "path", ctx.Path(), "cause", e.Cause)
+	}
+
+	if e.RetryAfter > 0 {
+		ctx.Set(fiber.HeaderRetryAfter, strconv.Itoa(int(math.Ceil(e.RetryAfter.Seconds()))))
+	}
+
+	for _, challenge := range challenges {
+		if challenge != "" {
+			ctx.Response().Header.Add(fiber.HeaderWWWAuthenticate, challenge)
+		}
+	}
+
+	return ctx.Status(e.Status).JSON(out.Error(e.Status, e.Code, e.Name, e.Message))
+}
+
+// BearerChallenge builds a challenge in the format of RFC 6750
+func BearerChallenge(scheme string, realm string, err *AuthError) string {
+	params := []string{fmt.Sprintf("realm=%q", realm)}
+	if err != nil {
+		switch err.Code {
+		case ErrCredentialsMissing.Code, ErrForbidden.Code:
+			// no error attribute when the request had no credential
+		case ErrCredentialsMalformed.Code:
+			params = append(params, `error="invalid_request"`)
+		case ErrInsufficientScope.Code:
+			params = append(params, `error="insufficient_scope"`)
+			if err.Scope != "" {
+				params = append(params, fmt.Sprintf("scope=%q", err.Scope))
+			}
+		default:
+			params = append(params, `error="invalid_token"`, fmt.Sprintf("error_description=%q", err.Message))
+		}
+	}
+	return scheme + " " + strings.Join(params, ", ")
+}
+
+// GetChallenges returns the challenges stored for a route that was passed without authentication
+func GetChallenges(ctx *fiber.Ctx) []string {
+	challenges, _ := ctx.Locals(LocalChallenges).([]string)
+	return challenges
+}
@@ -0,0 +1,51 @@
+package auth
+
+import "time"
+
+// Events published on the application EventBus
+const (
+	EventStoreReloaded = "auth.store.reloaded"
+	EventAuthDecision  = "auth.decision" // data is an AuditEvent
+	EventLocked        = "auth.lockout.locked"
+	EventUnlocked      = "auth.lockout.unlocked"
+	EventTokenRevoked  = "auth.token.revoked" // data is a RevocationEntry
+	EventMFAChanged    = "auth.mfa.changed"   // data is an MFAEvent
+)
+
+// StoreReloaded is the data of EventStoreReloaded
+type StoreReloaded struct {
+	Store     string // e.g. "yaml"
+	Source    string // file the data was read from
+	Users     int
+	Resources int
+	LoadedAt  time.Time
+}
+
+// LockoutEvent is the data of EventLocked and EventUnlocked
+type LockoutEvent struct {
+	Kind     string // LockoutIdentity or LockoutIP
+	Key      string // identity (e.g. username, API key id) or IP
+	Scheme   string // authentication type of the failed attempts
+	Failures int
+	Lockouts int
+	Until    time.Time
+	Reason   string // "expired" or "manual" for EventUnlocked
+}
+
+// Changes of a second factor, the Action of MFAEvent
+const (
+	MFAEnrolled            = "enrolled"
+	MFADisabled            = "disabled"
+	MFAReset               = "reset" // by an admin
+	MFARecoveryUsed        = "recovery_used"
+	MFARecoveryRegenerated = "recovery_regenerated"
+)
+
+// MFAEvent is the data of EventMFAChanged
+type MFAEvent struct {
+	UserId    string
+	Action    string
+	By        string // admin of MFAReset, else the user
+	Remaining int    // unused recovery codes
+	Time      time.Time
+}
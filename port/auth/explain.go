@@ -0,0 +1,341 @@
+package auth
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// key in fiber.Ctx locals marking the authentication of an explained request
+const LocalDryRun = "auth_dry_run"
+
+// IsDryRun reports whether the request is authenticated for the explain
+// endpoint. Schemes then consume no single-use material (nonces, TOTP steps)
+// and record no usage (last used, session touch and rotation, rehashes).
+func IsDryRun(ctx *fiber.Ctx) bool {
+	dryRun, _ := ctx.Locals(LocalDryRun).(bool)
+	return dryRun
+}
+
+// IExplainer is implemented by schemes that can run their authorization as a
+// dry run and find users of the store without a credential
+type IExplainer interface {
+	IPrincipalFinder
+	Explain(principal *Principal, request *AccessRequest, explanation *Explanation) error
+}
+
+// Explanation is the result of an authorization dry run
+type Explanation struct {
+	Method    string              `json:"method"`
+	Path      string              `json:"path"`
+	Principal *ExplainedPrincipal `json:"principal,omitempty"`
+	Public    bool                `json:"public"`
+	Optional  bool                `json:"optional"`
+	Resource  *ExplainedResource  `json:"resource,omitempty"`
+	Roles     *RoleTrace          `json:"roles,omitempty"`
+	Policies  []PolicyTrace       `json:"policies,omitempty"`
+	Decision  string              `json:"decision"` // DecisionAllow or DecisionDeny
+	Status    int                 `json:"status"`
+	Code      string              `json:"code,omitempty"`
+	Reason    string              `json:"reason,omitempty"`
+	Trace     []string            `json:"trace"`
+}
+
+// ExplainedPrincipal names the user like the audit log, the user id of a
+// plain API key user is the key itself
+type ExplainedPrincipal struct {
+	Name        string   `json:"name"` // username, or "user:" with a hash of the user id
+	Username    string   `json:"username,omitempty"`
+	AuthType    string   `json:"auth_type"`
+	ControlType string   `json:"control_type,omitempty"`
+	Groups      []string `json:"groups,omitempty"`
+	Roles       []string `json:"roles,omitempty"` // effective roles after groups and inheritance
+	Scopes      []string `json:"scopes,omitempty"`
+	Actor       string   `json:"actor,omitempty"` // admin of an impersonated request
+}
+
+type ExplainedResource struct {
+	Action      string `json:"action"`
+	Method      string `json:"method"`
+	Path        string `json:"path"`
+	ControlType string `json:"control_type"`
+	MFA         bool   `json:"mfa,omitempty"` // requires a second factor
+}
+
+// RoleTrace compares the roles of the user with the roles of an RBAC resource
+type RoleTrace struct {
+	User      []string `json:"user"`
+	Permitted []string `json:"permitted"`
+	Matched   []string `json:"matched"`
+}
+
+// PolicyTrace is the evaluation of one ABAC policy
+type PolicyTrace struct {
+	Source  string `json:"source"` // "resource" or "user"
+	Effect  string `json:"effect"`
+	Action  string `json:"action,omitempty"`
+	Applies bool   `json:"applies"` // the policy covers the action
+	Matched bool   `json:"matched"` // all conditions are true
+	Error   string `json:"error,omitempty"`
+}
+
+// Tracef adds a step to the trace
+func (e *Explanation) Tracef(format string, args ...any) {
+	e.Trace = append(e.Trace, fmt.Sprintf(format, args...))
+}
+
+func (e *Explanation) allow(format string, args ...any) *Explanation {
+	e.Tracef(format, args...)
+	e.Decision = DecisionAllow
+	e.Status = fiber.StatusOK
+	return e
+}
+
+// Deny records the final decision of a rejected request
+func (e *Explanation) Deny(err *AuthError) *Explanation {
+	e.Decision = DecisionDeny
+	e.Status = err.Status
+	e.Code = err.Name
+	e.Reason = err.Reason()
+	e.Tracef("denied: %s", e.Reason)
+	return e
+}
+
+// Explain runs the checks of the authentication middleware and the route
+// middleware for the principal, without calling the route. A nil principal
+// explains an anonymous request.
+func (s *SchemeChain) Explain(principal *Principal, request *AccessRequest) *Explanation {
+	explanation := &Explanation{
+		Method:    request.Method,
+		Path:      request.Path,
+		Principal: explainPrincipal(principal),
+		Trace:     []string{},
+	}
+
+	if s.Security != nil {
+		explanation.Public = s.Security.IsPublic(request.Method, request.Path)
+		explanation.Optional = s.Security.IsOptional(request.Method, request.Path)
+	}
+
+	if explanation.Public {
+		return explanation.allow("route is public, authentication and authorization are skipped")
+	}
+
+	if principal == nil {
+		if !explanation.Optional {
+			return explanation.Deny(ErrCredentialsMissing)
+		}
+		explanation.Tracef("route is optional, anonymous request passes the authentication middleware")
+		return s.explainRoute(nil, request, explanation)
+	}
+
+	schemes := s.schemesFor(request.Method, request.Path)
+	idx := slices.IndexFunc(schemes, func(scheme IAuthScheme) bool {
+		return scheme.Name() == principal.AuthType
+	})
+	if idx < 0 {
+		return explanation.Deny(ErrForbidden.Withf("authentication type %s is not allowed for this route", principal.AuthType))
+	}
+	explanation.Tracef("authentication type %s is allowed for the route", principal.AuthType)
+
+	explainer, ok := schemes[idx].(IExplainer)
+	if !ok {
+		return explanation.Deny(ErrForbidden.Withf("authentication type %s cannot explain its authorization", principal.AuthType))
+	}
+
+	if err := explainer.Explain(principal, request, explanation); err != nil {
+		return explanation.Deny(AsAuthError(err, ErrForbidden))
+	}
+
+	return s.explainRoute(principal, request, explanation)
+}
+
+// explainRoute checks the metadata of the route and its group, which the
+// route middleware enforces after the authentication middleware
+func (s *SchemeChain) explainRoute(principal *Principal, request *AccessRequest, explanation *Explanation) *Explanation {
+	if s.Security != nil {
+		checks := []struct {
+			name  string
+			match func(string, string) (*RouteSecurity, bool)
+		}{
+			{"route", s.Security.Match},
+			{"group", s.Security.MatchGroup},
+		}
+
+		for _, check := range checks {
+			security, ok := check.match(request.Method, request.Path)
+			if !ok {
+				continue
+			}
+
+			if err := security.Check(principal, request); err != nil {
+				explanation.Tracef("%s requirements not met", check.name)
+				return explanation.Deny(AsAuthError(err, ErrForbidden))
+			}
+			explanation.Tracef("%s requirements met", check.name)
+		}
+	}
+
+	return explanation.allow("allowed")
+}
+
+// ExplainAuthorization is the dry run of Authorization.Check. The decision
+// comes from Check itself, the evaluated roles or policies are added to the
+// explanation.
+func (a *Authorization) ExplainAuthorization(user IUserAuthInfo, request *AccessRequest, explanation *Explanation) (IResourceInfo, error) {
+	resourceInfo, err := a.Check(user, request)
+	if resourceInfo == nil {
+		if err == nil {
+			explanation.Tracef("no resource matches %s %s, default policy %s applies", request.Method, request.Path, a.DefaultPolicy)
+		}
+		return nil, err
+	}
+
+	explanation.Resource = &ExplainedResource{
+		Action:      resourceInfo.GetAction(),
+		Method:      resourceInfo.GetMethod(),
+		Path:        resourceInfo.GetPath(),
+		ControlType: resourceInfo.GetControlType(),
+		MFA:         ResourceRequiresMFA(resourceInfo),
+	}
+	explanation.Tracef("resource %s %s matched, action %s", resourceInfo.GetMethod(), resourceInfo.GetPath(), resourceInfo.GetAction())
+
+	switch resource := resourceInfo.(type) {
+	case *ResourceInfoRBAC:
+		if rbac, ok := user.(*UserAuthInfoRBAC); ok {
+			trace := &RoleTrace{User: rbac.Roles, Permitted: resource.PermittedRoles, Matched: []string{}}
+			for _, role := range rbac.Roles {
+				if slices.Contains(resource.PermittedRoles, role) {
+					trace.Matched = append(trace.Matched, role)
+				}
+			}
+			explanation.Roles = trace
+			explanation.Tracef("roles %v of the user, roles %v permitted", rbac.Roles, resource.PermittedRoles)
+		}
+	case *ResourceInfoABAC:
+		if abac, ok := user.(*UserAuthInfoABAC); ok {
+			attrs := NewAttributes(abac, request, resource)
+			explanation.Policies = append(explainPolicies("resource", resource.PermittedPolicies, resource.Action, attrs),
+				explainPolicies("user", abac.Policies, resource.Action, attrs)...)
+			explanation.Tracef("%d policies evaluated with deny-overrides", len(explanation.Policies))
+		}
+	}
+
+	if err != nil {
+		return resourceInfo, err
+	}
+
+	explanation.Tracef("store authorization passed")
+	return resourceInfo, nil
+}
+
+func explainPolicies(source string, policies []PolicyABAC, action string, attrs Attributes) []PolicyTrace {
+	traces := make([]PolicyTrace, 0, len(policies))
+	for _, policy := range policies {
+		trace := PolicyTrace{
+			Source:  source,
+			Effect:  policy.Effect,
+			Action:  policy.Action,
+			Applies: policy.AppliesTo(action),
+		}
+
+		if trace.Applies {
+			matched, err := EvaluateConditions(policy.Condition, attrs)
+			trace.Matched = matched
+			if err != nil {
+				trace.Error = err.Error()
+			}
+		}
+
+		traces = append(traces, trace)
+	}
+	return traces
+}
+
+func explainPrincipal(principal *Principal) *ExplainedPrincipal {
+	if principal == nil {
+		return nil
+	}
+
+	explained := &ExplainedPrincipal{
+		Name:     principal.Name(),
+		Username: principal.Username,
+		AuthType: principal.AuthType,
+		Groups:   principal.Groups,
+		Roles:    principal.Roles,
+		Scopes:   principal.Scopes,
+	}
+	if principal.Actor != nil {
+		explained.Actor = principal.Actor.Name()
+	}
+	if principal.User != nil {
+		explained.ControlType = principal.User.GetControlType()
+	}
+	return explained
+}
+
+// identityValidator finds a user of the store by user id or username,
+// without a credential. It is only used by dry runs.
+type identityValidator struct {
+	name string
+}
+
+// NewIdentityValidator returns a validator that matches userKey with the user id or username
+func NewIdentityValidator(name string) IAuthValidator {
+	return &identityValidator{name: name}
+}
+
+func (v *identityValidator) Name() string {
+	return v.name
+}
+
+func (v *identityValidator) ValidateKey(ctx *fiber.Ctx) (string, error) {
+	return "", ErrCredentialsMissing
+}
+
+func (v *identityValidator) UserLookups(ctx *fiber.Ctx, userKey string) []UserLookup {
+	return []UserLookup{{Field: "key", Value: userKey}, {Field: "user", Value: userKey}}
+}
+
+func (v *identityValidator) VerifyUser(ctx *fiber.Ctx, userKey string, userInfo IUserAuthInfo) (bool, error) {
+	if userKey == "" {
+		return false, nil
+	}
+
+	switch user := userInfo.(type) {
+	case *UserAuthInfoRBAC:
+		return user.UserId == userKey || (user.Username != nil && *user.Username == userKey), nil
+	case *UserAuthInfoABAC:
+		return user.UserId == userKey || (user.Username != nil && *user.Username == userKey), nil
+	}
+	return false, nil
+}
+
+// ExplainRequest is the body of the explain endpoint. The principal is either
+// a user of the store or the credential headers of a request.
+type ExplainRequest struct {
+	Method   string            `json:"method"`
+	Path     string            `json:"path"`
+	User     string            `json:"user"`      // user id or username
+	AuthType string            `json:"auth_type"` // scheme the user is explained with, default the first of auth.type
+	Headers  map[string]string `json:"headers"`   // e.g. {"Authorization": "Bearer ..."}
+	Query    map[string]string `json:"query"`
+}
+
+// NewDryRunRequest builds the AccessRequest of an explained request
+func NewDryRunRequest(ctx *fiber.Ctx, method string, path string, headers map[string]string, query map[string]string) *AccessRequest {
+	request := NewAccessRequest(ctx)
+	request.Method = strings.ToUpper(method)
+	request.Path = path
+	request.Headers = make(map[string]string, len(headers))
+	for name, value := range headers {
+		request.Headers[strings.ToLower(name)] = value
+	}
+	request.Query = query
+	if request.Query == nil {
+		request.Query = map[string]string{}
+	}
+	return request
+}
@@ -0,0 +1,166 @@
+package auth
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// cached identities per hierarchy, the cache starts over when it is full
+const maxCachedIdentities = 10000
+
+// GroupDef is a group of the auth store, members get the roles of the group
+type GroupDef struct {
+	Name  string   `mapstructure:"name"`
+	Roles []string `mapstructure:"roles"`
+}
+
+// RoleDef is a role of the auth store, a role includes the roles it inherits
+type RoleDef struct {
+	Name        string   `mapstructure:"name"`
+	Inherits    []string `mapstructure:"inherits"`
+	Description string   `mapstructure:"description"`
+}
+
+// RoleHierarchy resolves groups and inherited roles into the effective roles
+// of a user. It is built once per store load and read by all requests.
+type RoleHierarchy struct {
+	groups   map[string][]string // group -> granted roles
+	expanded map[string][]string // role -> the role and all roles it inherits
+
+	mu    sync.RWMutex
+	cache map[string][]string // identity -> effective roles
+}
+
+// IRoleHierarchyProvider is implemented by stores that define groups and role inheritance
+type IRoleHierarchyProvider interface {
+	RoleHierarchy() *RoleHierarchy
+}
+
+// NewRoleHierarchy validates the definitions and expands the inheritance.
+// Roles that are used but not defined have no parents.
+func NewRoleHierarchy(groups []GroupDef, roles []RoleDef) (*RoleHierarchy, error) {
+	h := &RoleHierarchy{
+		groups:   make(map[string][]string, len(groups)),
+		expanded: make(map[string][]string, len(roles)),
+		cache:    make(map[string][]string),
+	}
+
+	for _, group := range groups {
+		if group.Name == "" {
+			return nil, fmt.Errorf("Group without name")
+		}
+		if _, ok := h.groups[group.Name]; ok {
+			return nil, fmt.Errorf("Duplicate group %s", group.Name)
+		}
+		h.groups[group.Name] = group.Roles
+	}
+
+	parents := make(map[string][]string, len(roles))
+	for _, role := range roles {
+		if role.Name == "" {
+			return nil, fmt.Errorf("Role without name")
+		}
+		if _, ok := parents[role.Name]; ok {
+			return nil, fmt.Errorf("Duplicate role %s", role.Name)
+		}
+		parents[role.Name] = role.Inherits
+	}
+
+	// depth first search, a role that is visited again on the current path is a cycle
+	const (
+		visiting = 1
+		done     = 2
+	)
+	state := make(map[string]int, len(parents))
+	var path []string
+	var visit func(role string) error
+	visit = func(role string) error {
+		switch state[role] {
+		case done:
+			return nil
+		case visiting:
+			start := slices.Index(path, role)
+			return fmt.Errorf("Role inheritance cycle: %s", strings.Join(append(path[start:], role), " -> "))
+		}
+
+		state[role] = visiting
+		path = append(path, role)
+
+		expanded := []string{role}
+		for _, parent := range parents[role] {
+			if err := visit(parent); err != nil {
+				return err
+			}
+			expanded = appendUnique(expanded, h.expanded[parent]...)
+		}
+
+		path = path[:len(path)-1]
+		state[role] = done
+		h.expanded[role] = expanded
+		return nil
+	}
+
+	for _, role := range roles {
+		if err := visit(role.Name); err != nil {
+			return nil, err
+		}
+	}
+
+	return h, nil
+}
+
+// Resolve returns the roles of the user, the roles of the user's groups and
+// all roles inherited by them
+func (h *RoleHierarchy) Resolve(groups []string, roles []string) []string {
+	direct := slices.Clone(roles)
+	for _, group := range groups {
+		direct = appendUnique(direct, h.groups[group]...)
+	}
+
+	effective := make([]string, 0, len(direct))
+	for _, role := range direct {
+		if expanded, ok := h.expanded[role]; ok {
+			effective = appendUnique(effective, expanded...)
+		} else {
+			effective = appendUnique(effective, role)
+		}
+	}
+
+	return effective
+}
+
+// EffectiveRoles is Resolve cached per identity. The returned slice is shared
+// and must not be modified.
+func (h *RoleHierarchy) EffectiveRoles(identity string, groups []string, roles []string) []string {
+	// groups and roles are part of the key, JWT claims of one subject may change
+	key := identity + "\x00" + strings.Join(groups, ",") + "\x00" + strings.Join(roles, ",")
+
+	h.mu.RLock()
+	effective, ok := h.cache[key]
+	h.mu.RUnlock()
+	if ok {
+		return effective
+	}
+
+	effective = h.Resolve(groups, roles)
+
+	h.mu.Lock()
+	if len(h.cache) >= maxCachedIdentities {
+		h.cache = make(map[string][]string)
+	}
+	h.cache[key] = effective
+	h.mu.Unlock()
+
+	return effective
+}
+
+func appendUnique(list []string, values ...string) []string {
+	for _, value := range values {
+		if !slices.Contains(list, value) {
+			list = append(list, value)
+		}
+	}
+	return list
+}
@@ -0,0 +1,80 @@
+package auth
+
+import (
+	"slices"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/webcore-go/webcore/infra/logger"
+)
+
+// Response headers of an impersonated request, so both identities show up
+// in the logs of clients and proxies
+const (
+	HeaderImpersonator = "X-Impersonator" // user of the admin who sent the request
+	HeaderActingAs     = "X-Acting-As"    // user the request ran as
+)
+
+// IPrincipalFinder is implemented by schemes that load users of the store
+// without a credential
+type IPrincipalFinder interface {
+	FindPrincipal(ctx *fiber.Ctx, identity string) (*Principal, error)
+}
+
+// Impersonation lets admins run a request as another user of the store. The
+// request is authorized as that user, the admin is kept as Actor.
+type Impersonation struct {
+	Header         string
+	Roles          []string // roles allowed to impersonate
+	ProtectedRoles []string // users with one of these roles cannot be impersonated
+}
+
+func NewImpersonation(header string, roles []string) *Impersonation {
+	return &Impersonation{
+		Header: header,
+		Roles:  roles,
+	}
+}
+
+// Target returns the user the request asks to act as, empty without header
+func (i *Impersonation) Target(ctx *fiber.Ctx) string {
+	return strings.TrimSpace(ctx.Get(i.Header))
+}
+
+// Impersonate returns the principal of the target user with the actor
+// attached. The target keeps the limits of the credential of the actor, its
+// scopes and second factor, so impersonation never widens a credential.
+func (i *Impersonation) Impersonate(ctx *fiber.Ctx, actor *Principal, finder IPrincipalFinder, target string) (*Principal, error) {
+	if !slices.ContainsFunc(actor.Roles, func(role string) bool {
+		return slices.Contains(i.Roles, role)
+	}) {
+		return nil, ErrImpersonationDenied.Withf("One of roles %v required", i.Roles)
+	}
+
+	principal, err := finder.FindPrincipal(ctx, target)
+	if err != nil {
+		return nil, ErrImpersonationDenied.With(err)
+	}
+	if principal.UserId == actor.UserId {
+		return actor, nil
+	}
+
+	// impersonators cannot act as each other or as admins, which would escalate their privileges
+	if slices.ContainsFunc(principal.Roles, func(role string) bool {
+		return slices.Contains(i.Roles, role) || slices.Contains(i.ProtectedRoles, role)
+	}) {
+		return nil, ErrImpersonationDenied.Withf("User %s cannot be impersonated", target)
+	}
+
+	principal.AuthType = actor.AuthType
+	principal.Scopes = actor.Scopes
+	principal.CredentialId = actor.CredentialId
+	principal.MFA = actor.MFA
+	principal.Actor = actor
+
+	ctx.Set(HeaderImpersonator, actor.Name())
+	ctx.Set(HeaderActingAs, principal.Name())
+	logger.Info("Impersonated request", "actor", actor.Name(), "user", principal.Name(), "method", ctx.Method(), "path", ctx.Path(), "ip", ctx.IP())
+
+	return principal, nil
+}
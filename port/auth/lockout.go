@@ -0,0 +1,355 @@
+package auth
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/webcore-go/webcore/infra/logger"
+	"github.com/webcore-go/webcore/port"
+)
+
+// Kinds of lockout counters
+const (
+	LockoutIdentity = "identity"
+	LockoutIP       = "ip"
+)
+
+// IAttemptIdentifier is implemented by validators of guessable credentials
+// (passwords, API keys). The identity names the attacked account without
+// revealing the credential, e.g. the username or the id of an API key.
+type IAttemptIdentifier interface {
+	AttemptIdentity(ctx *fiber.Ctx) string
+}
+
+// ICaptchaVerifier checks the CAPTCHA answer of a request, e.g. a token header
+type ICaptchaVerifier interface {
+	VerifyCaptcha(ctx *fiber.Ctx) bool
+}
+
+// LockoutPolicy configures the failure counters. Zero values disable a limit.
+type LockoutPolicy struct {
+	MaxFailures   int           // failures of an identity before it is locked
+	IPMaxFailures int           // failures from one IP before the IP is banned
+	Window        time.Duration // failures are counted within this window
+	Duration      time.Duration // first lockout, doubled for every further lockout
+	MaxDuration   time.Duration // upper limit of the lockout
+	BanDuration   time.Duration // ban of an IP
+	CaptchaAfter  int           // failures of an identity after which a CAPTCHA is required
+	ResetAfter    time.Duration // the lockout count is forgotten after this time without failures
+}
+
+// LockoutState is the counter of one identity or IP
+type LockoutState struct {
+	Failures     int       `json:"failures"`
+	FirstFailure time.Time `json:"first_failure"`
+	LockedUntil  time.Time `json:"locked_until"`
+	Lockouts     int       `json:"lockouts"` // lockouts so far, drives the exponential duration
+}
+
+// ILockoutStore keeps the counters, either in process or in a shared cache
+type ILockoutStore interface {
+	Load(ctx context.Context, key string) (*LockoutState, error) // nil when there is no counter
+	Save(ctx context.Context, key string, state *LockoutState, ttl time.Duration) error
+	Delete(ctx context.Context, key string) error
+	// Update changes the counter atomically, so concurrent failures are all
+	// counted. update receives nil when there is no counter and returns the
+	// new state with its ttl, nil keeps the counter unchanged.
+	Update(ctx context.Context, key string, update LockoutUpdate) error
+}
+
+// LockoutUpdate computes the new state of a counter for ILockoutStore.Update
+type LockoutUpdate func(state *LockoutState) (*LockoutState, time.Duration)
+
+// Lockout counts failed authentications per identity and per IP. Identities
+// are locked with exponential duration, IPs are banned for a fixed time.
+type Lockout struct {
+	Policy  LockoutPolicy
+	Store   ILockoutStore
+	Captcha ICaptchaVerifier             // nil answers every CAPTCHA requirement with CAPTCHA_REQUIRED
+	Publish func(event string, data any) // receives EventLocked and EventUnlocked, may be nil
+}
+
+func NewLockout(policy LockoutPolicy, store ILockoutStore) *Lockout {
+	return &Lockout{
+		Policy: policy,
+		Store:  store,
+	}
+}
+
+// Check rejects a request of a locked identity or banned IP before its
+// credential is verified, so guesses during a lockout are not evaluated
+func (l *Lockout) Check(ctx *fiber.Ctx, identities []string) error {
+	now := time.Now()
+
+	if l.Policy.IPMaxFailures > 0 {
+		if _, err := l.checkLocked(ctx, LockoutIP, ctx.IP(), now); err != nil {
+			return err
+		}
+	}
+
+	for _, identity := range identities {
+		state, err := l.checkLocked(ctx, LockoutIdentity, identity, now)
+		if err != nil {
+			return err
+		}
+
+		if l.Policy.CaptchaAfter > 0 && state != nil && state.Failures >= l.Policy.CaptchaAfter &&
+			now.Sub(state.FirstFailure) <= l.Policy.Window && (l.Captcha == nil || !l.Captcha.VerifyCaptcha(ctx)) {
+			return ErrCaptchaRequired
+		}
+	}
+
+	return nil
+}
+
+// checkLocked returns the counter of the identity or IP, or an error while it is locked
+func (l *Lockout) checkLocked(ctx *fiber.Ctx, kind string, value string, now time.Time) (*LockoutState, error) {
+	key := lockoutKey(kind, value)
+	state, err := l.Store.Load(ctx.UserContext(), key)
+	if err != nil {
+		// the counters must not make authentication unavailable
+		logger.Warn("Load lockout state failed", "kind", kind, "error", err)
+		return nil, nil
+	}
+	if state == nil || state.LockedUntil.IsZero() {
+		return state, nil
+	}
+
+	if now.Before(state.LockedUntil) {
+		return state, ErrTooManyAttempts.WithRetryAfter(state.LockedUntil.Sub(now))
+	}
+
+	// the lockout expired, the count of lockouts is kept for the next duration;
+	// only one of concurrent requests clears it and publishes the unlock
+	unlocked := false
+	l.update(ctx.UserContext(), key, func(current *LockoutState) (*LockoutState, time.Duration) {
+		if current == nil || current.LockedUntil.IsZero() || now.Before(current.LockedUntil) {
+			return nil, 0
+		}
+		current.LockedUntil = time.Time{}
+		state, unlocked = current, true
+		return current, l.ttl(current)
+	})
+	if unlocked {
+		l.publish(EventUnlocked, LockoutEvent{Kind: kind, Key: value, Lockouts: state.Lockouts, Reason: "expired"})
+	}
+	return state, nil
+}
+
+// Fail counts a failed authentication of the identities and the IP
+func (l *Lockout) Fail(ctx *fiber.Ctx, scheme string, identities []string) {
+	now := time.Now()
+
+	if l.Policy.IPMaxFailures > 0 {
+		l.fail(ctx, scheme, LockoutIP, ctx.IP(), l.Policy.IPMaxFailures, now)
+	}
+
+	if l.Policy.MaxFailures > 0 || l.Policy.CaptchaAfter > 0 {
+		for _, identity := range identities {
+			l.fail(ctx, scheme, LockoutIdentity, identity, l.Policy.MaxFailures, now)
+		}
+	}
+}
+
+func (l *Lockout) fail(ctx *fiber.Ctx, scheme string, kind string, value string, limit int, now time.Time) {
+	var locked *LockoutState
+	l.update(ctx.UserContext(), lockoutKey(kind, value), func(state *LockoutState) (*LockoutState, time.Duration) {
+		if state == nil {
+			state = &LockoutState{}
+		}
+
+		if state.Failures == 0 || now.Sub(state.FirstFailure) > l.Policy.Window {
+			state.Failures = 0
+			state.FirstFailure = now
+		}
+		state.Failures++
+
+		if limit > 0 && state.Failures >= limit {
+			duration := l.Policy.BanDuration
+			if kind == LockoutIdentity {
+				duration = l.lockDuration(state.Lockouts)
+			}
+
+			state.Lockouts++
+			state.LockedUntil = now.Add(duration)
+			state.Failures = 0
+			locked = state
+		}
+		return state, l.ttl(state)
+	})
+
+	if locked != nil {
+		event := LockoutEvent{Kind: kind, Key: value, Scheme: scheme, Failures: limit, Lockouts: locked.Lockouts, Until: locked.LockedUntil}
+		logger.Warn("Authentication locked after failed attempts", "kind", kind, "key", value, "scheme", scheme, "until", locked.LockedUntil, "lockouts", locked.Lockouts)
+		l.publish(EventLocked, event)
+	}
+}
+
+// lockDuration doubles the first lockout for every previous lockout
+func (l *Lockout) lockDuration(lockouts int) time.Duration {
+	duration := l.Policy.Duration
+	for i := 0; i < lockouts && (l.Policy.MaxDuration <= 0 || duration < l.Policy.MaxDuration); i++ {
+		duration *= 2
+	}
+	if l.Policy.MaxDuration > 0 && duration > l.Policy.MaxDuration {
+		duration = l.Policy.MaxDuration
+	}
+	return duration
+}
+
+// Succeed resets the failures of the identities after a successful authentication.
+// The IP counter is kept, one valid account must not unlock guessing others.
+func (l *Lockout) Succeed(ctx *fiber.Ctx, identities []string) {
+	for _, identity := range identities {
+		l.update(ctx.UserContext(), lockoutKey(LockoutIdentity, identity), func(state *LockoutState) (*LockoutState, time.Duration) {
+			if state == nil || state.Failures == 0 {
+				return nil, 0
+			}
+			state.Failures = 0
+			return state, l.ttl(state)
+		})
+	}
+}
+
+// Unlock removes the counter of an identity or IP, e.g. from an admin endpoint
+func (l *Lockout) Unlock(ctx context.Context, kind string, value string) error {
+	if err := l.Store.Delete(ctx, lockoutKey(kind, value)); err != nil {
+		return err
+	}
+
+	l.publish(EventUnlocked, LockoutEvent{Kind: kind, Key: value, Reason: "manual"})
+	return nil
+}
+
+func (l *Lockout) update(ctx context.Context, key string, update LockoutUpdate) {
+	if err := l.Store.Update(ctx, key, update); err != nil {
+		logger.Warn("Update lockout state failed", "error", err)
+	}
+}
+
+// ttl keeps the counter for the window or reset_after, and while it is locked
+func (l *Lockout) ttl(state *LockoutState) time.Duration {
+	ttl := l.Policy.ResetAfter
+	if ttl < l.Policy.Window {
+		ttl = l.Policy.Window
+	}
+	if until := time.Until(state.LockedUntil); until > 0 {
+		ttl += until
+	}
+	return ttl
+}
+
+func (l *Lockout) publish(event string, data LockoutEvent) {
+	if event == EventUnlocked {
+		logger.Info("Authentication unlocked", "kind", data.Kind, "key", data.Key, "reason", data.Reason)
+	}
+	if l.Publish != nil {
+		l.Publish(event, data)
+	}
+}
+
+func lockoutKey(kind string, value string) string {
+	return "auth:lockout:" + kind + ":" + value
+}
+
+// MemoryLockoutStore keeps the counters in process
+type MemoryLockoutStore struct {
+	entries *ttlMap[LockoutState]
+}
+
+func NewMemoryLockoutStore() *MemoryLockoutStore {
+	return &MemoryLockoutStore{
+		entries: newTTLMap[LockoutState](),
+	}
+}
+
+func (m *MemoryLockoutStore) Load(ctx context.Context, key string) (*LockoutState, error) {
+	state, ok := m.entries.Get(key)
+	if !ok {
+		return nil, nil
+	}
+	return &state, nil
+}
+
+func (m *MemoryLockoutStore) Save(ctx context.Context, key string, state *LockoutState, ttl time.Duration) error {
+	m.entries.Set(key, *state, ttl)
+	return nil
+}
+
+func (m *MemoryLockoutStore) Delete(ctx context.Context, key string) error {
+	m.entries.Delete(key)
+	return nil
+}
+
+func (m *MemoryLockoutStore) Update(ctx context.Context, key string, update LockoutUpdate) error {
+	m.entries.Update(key, func(state LockoutState, ok bool) (LockoutState, time.Duration, bool) {
+		var current *LockoutState
+		if ok {
+			current = &state
+		}
+
+		next, ttl := update(current)
+		if next == nil {
+			return state, 0, false
+		}
+		return *next, ttl, true
+	})
+	return nil
+}
+
+// CacheLockoutStore keeps the counters in the configured IMemoryCache, so
+// all instances of the application share them. Updates hold a lock key set
+// with ICacheAdder; without it two instances may count concurrent failures
+// of the same identity once.
+type CacheLockoutStore struct {
+	cacheJSON[LockoutState]
+}
+
+func NewCacheLockoutStore(cache port.IMemoryCache) (*CacheLockoutStore, error) {
+	client, err := cacheClient(cache)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := client.(ICacheAdder); !ok {
+		logger.Warn("Memory cache library does not implement auth.ICacheAdder, concurrent lockout failures may be lost")
+	}
+	return &CacheLockoutStore{cacheJSON[LockoutState]{Client: client}}, nil
+}
+
+// lockTimeout is the lifetime of the lock of a counter, an instance that dies
+// while holding it blocks the counter only that long
+const lockTimeout = 2 * time.Second
+
+func (c *CacheLockoutStore) Update(ctx context.Context, key string, update LockoutUpdate) error {
+	if adder, ok := c.Client.(ICacheAdder); ok {
+		lock := key + ":lock"
+		deadline := time.Now().Add(lockTimeout)
+		for {
+			acquired, err := adder.SetIfAbsent(ctx, lock, []byte{1}, lockTimeout)
+			if err != nil {
+				return err
+			}
+			if acquired {
+				break
+			}
+			if time.Now().After(deadline) {
+				return fmt.Errorf("Lock of lockout counter %s not acquired within %s", key, lockTimeout)
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		defer c.Client.Delete(ctx, lock)
+	}
+
+	state, err := c.Load(ctx, key)
+	if err != nil {
+		return err
+	}
+
+	next, ttl := update(state)
+	if next == nil {
+		return nil
+	}
+	return c.Save(ctx, key, next, ttl)
+}
@@ -0,0 +1,340 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/webcore-go/webcore/app/helper"
+	"github.com/webcore-go/webcore/infra/logger"
+)
+
+// MFAEnrollment is the TOTP second factor of a user. The secret is needed to
+// compute the codes and is stored as is, recovery codes only as hashes.
+type MFAEnrollment struct {
+	UserId        string     `json:"user_id"`
+	Secret        string     `json:"-"` // base32 secret of the confirmed factor, empty until the first confirmation
+	PendingSecret string     `json:"-"` // secret of an enrollment that waits for its first code
+	RecoveryCodes []string   `json:"-"` // hex SHA-256 of the unused recovery codes
+	LastStep      int64      `json:"-"` // time step of the last accepted code, older codes are rejected
+	CreatedAt     time.Time  `json:"created_at"`
+	ConfirmedAt   *time.Time `json:"confirmed_at,omitempty"`
+}
+
+// IsConfirmed reports whether the user has a second factor that is enforced
+func (e *MFAEnrollment) IsConfirmed() bool {
+	return e != nil && e.Secret != ""
+}
+
+// IMFAStore persists the second factors
+type IMFAStore interface {
+	GetMFA(ctx context.Context, userId string) (*MFAEnrollment, error) // nil when the user has none
+	SaveMFA(ctx context.Context, enrollment *MFAEnrollment) error      // creates or replaces
+	DeleteMFA(ctx context.Context, userId string) error
+}
+
+// IMFAResource is implemented by resources that can demand a second factor
+type IMFAResource interface {
+	RequiresMFA() bool
+}
+
+// ResourceRequiresMFA reports whether the matched resource demands a second factor
+func ResourceRequiresMFA(resource IResourceInfo) bool {
+	r, ok := resource.(IMFAResource)
+	return ok && r.RequiresMFA()
+}
+
+// MFAStatus describes the second factor of a user, without secrets
+type MFAStatus struct {
+	Enrolled      bool       `json:"enrolled"`
+	Pending       bool       `json:"pending"` // an enrollment waits for its first code
+	RecoveryCodes int        `json:"recovery_codes"`
+	ConfirmedAt   *time.Time `json:"confirmed_at,omitempty"`
+}
+
+// MFASetup is returned once when a user enrolls
+type MFASetup struct {
+	Secret string `json:"secret"`
+	URI    string `json:"uri"` // otpauth:// URI for the QR code
+}
+
+// MFA enrolls users and verifies their TOTP and recovery codes
+type MFA struct {
+	Store         IMFAStore
+	Issuer        string
+	Skew          int           // accepted steps before and after the current one
+	MaxAge        time.Duration // how long the step-up of a session counts, 0 for the whole session
+	Header        string        // request header with the code of per-request schemes
+	HeaderSchemes []string      // schemes that send the code in the header
+	RecoveryCodes int
+	Publish       func(event string, data any) // receives EventMFAChanged, may be nil
+
+	// serializes read and update of an enrollment, so a code is accepted once per instance
+	mu sync.Mutex
+}
+
+func NewMFA(store IMFAStore, issuer string) *MFA {
+	return &MFA{
+		Store:         store,
+		Issuer:        issuer,
+		Skew:          1,
+		RecoveryCodes: 10,
+	}
+}
+
+// Status returns the second factor of the user
+func (m *MFA) Status(ctx context.Context, userId string) (*MFAStatus, error) {
+	enrollment, err := m.Store.GetMFA(ctx, userId)
+	if err != nil {
+		return nil, err
+	}
+	if enrollment == nil {
+		return &MFAStatus{}, nil
+	}
+
+	return &MFAStatus{
+		Enrolled:      enrollment.IsConfirmed(),
+		Pending:       enrollment.PendingSecret != "",
+		RecoveryCodes: len(enrollment.RecoveryCodes),
+		ConfirmedAt:   enrollment.ConfirmedAt,
+	}, nil
+}
+
+// Enroll creates a new secret that becomes active with Confirm. A confirmed
+// factor keeps working until then, so an abandoned enrollment locks nobody out.
+func (m *MFA) Enroll(ctx context.Context, userId string, account string) (*MFASetup, error) {
+	secret, err := helper.GenerateTOTPSecret()
+	if err != nil {
+		return nil, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	enrollment, err := m.Store.GetMFA(ctx, userId)
+	if err != nil {
+		return nil, err
+	}
+	if enrollment == nil {
+		enrollment = &MFAEnrollment{UserId: userId, CreatedAt: time.Now()}
+	}
+
+	enrollment.PendingSecret = secret
+	if err := m.Store.SaveMFA(ctx, enrollment); err != nil {
+		return nil, err
+	}
+
+	return &MFASetup{Secret: secret, URI: helper.TOTPURI(m.Issuer, account, secret)}, nil
+}
+
+// Confirm activates the pending secret with its first code and returns new
+// recovery codes, which are shown only once
+func (m *MFA) Confirm(ctx context.Context, userId string, code string) ([]string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	enrollment, err := m.Store.GetMFA(ctx, userId)
+	if err != nil {
+		return nil, err
+	}
+	if enrollment == nil || enrollment.PendingSecret == "" {
+		return nil, ErrMFAInvalid.Withf("User %s has no pending enrollment", userId)
+	}
+
+	step, ok := helper.MatchTOTP(enrollment.PendingSecret, normalizeCode(code), time.Now(), m.Skew)
+	if !ok {
+		return nil, ErrMFAInvalid.Withf("Code does not match the pending secret")
+	}
+
+	codes, hashes, err := m.newRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	enrollment.Secret = enrollment.PendingSecret
+	enrollment.PendingSecret = ""
+	enrollment.LastStep = step
+	enrollment.RecoveryCodes = hashes
+	enrollment.ConfirmedAt = &now
+	if err := m.Store.SaveMFA(ctx, enrollment); err != nil {
+		return nil, err
+	}
+
+	m.publish(userId, MFAEnrolled, userId, len(hashes))
+	return codes, nil
+}
+
+// Verify checks a TOTP code, or with interactive a recovery code, of a
+// confirmed factor. An interactive code (login, step-up) is accepted once;
+// per-request schemes resend the code with every request, so the code of the
+// last accepted step is accepted again until a newer one was used.
+func (m *MFA) Verify(ctx context.Context, userId string, code string, interactive bool) error {
+	return m.verify(ctx, userId, code, interactive, true)
+}
+
+// verify checks the code, the accepted step is only saved with consume
+func (m *MFA) verify(ctx context.Context, userId string, code string, interactive bool, consume bool) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	enrollment, err := m.Store.GetMFA(ctx, userId)
+	if err != nil {
+		return ErrMFAInvalid.With(err)
+	}
+	if !enrollment.IsConfirmed() {
+		return ErrMFARequired.Withf("User %s has no second factor", userId)
+	}
+
+	code = normalizeCode(code)
+	if step, ok := helper.MatchTOTP(enrollment.Secret, code, time.Now(), m.Skew); ok {
+		if step < enrollment.LastStep || (step == enrollment.LastStep && interactive) {
+			return ErrMFAInvalid.Withf("Code was already used")
+		}
+		if step > enrollment.LastStep && consume {
+			enrollment.LastStep = step
+			if err := m.Store.SaveMFA(ctx, enrollment); err != nil {
+				return ErrMFAInvalid.With(err)
+			}
+		}
+		return nil
+	}
+
+	// recovery codes are single use, they are never sent with every request
+	if !interactive {
+		return ErrMFAInvalid.Withf("Code does not match")
+	}
+
+	idx := slices.Index(enrollment.RecoveryCodes, hashCode(code))
+	if idx < 0 {
+		return ErrMFAInvalid.Withf("Code does not match")
+	}
+
+	enrollment.RecoveryCodes = slices.Delete(enrollment.RecoveryCodes, idx, idx+1)
+	if err := m.Store.SaveMFA(ctx, enrollment); err != nil {
+		return ErrMFAInvalid.With(err)
+	}
+
+	logger.Warn("MFA recovery code used", "user", hashedUserName(userId), "remaining", len(enrollment.RecoveryCodes))
+	m.publish(userId, MFARecoveryUsed, userId, len(enrollment.RecoveryCodes))
+	return nil
+}
+
+// RegenerateRecoveryCodes replaces the recovery codes of a confirmed factor
+func (m *MFA) RegenerateRecoveryCodes(ctx context.Context, userId string) ([]string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	enrollment, err := m.Store.GetMFA(ctx, userId)
+	if err != nil {
+		return nil, err
+	}
+	if !enrollment.IsConfirmed() {
+		return nil, ErrMFARequired.Withf("User %s has no second factor", userId)
+	}
+
+	codes, hashes, err := m.newRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+
+	enrollment.RecoveryCodes = hashes
+	if err := m.Store.SaveMFA(ctx, enrollment); err != nil {
+		return nil, err
+	}
+
+	m.publish(userId, MFARecoveryRegenerated, userId, len(hashes))
+	return codes, nil
+}
+
+// Disable removes the second factor of the user, by itself or by an admin
+func (m *MFA) Disable(ctx context.Context, userId string, by string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.Store.DeleteMFA(ctx, userId); err != nil {
+		return err
+	}
+
+	action := MFADisabled
+	if by != userId {
+		action = MFAReset
+	}
+	logger.Info("MFA removed", "user", hashedUserName(userId), "by", hashedUserName(by))
+	m.publish(userId, action, by, 0)
+	return nil
+}
+
+// VerifyRequest checks the code header of per-request schemes such as basic.
+// A request without the header stays without second factor, a wrong code
+// fails the authentication, so it is counted by the lockout.
+func (m *MFA) VerifyRequest(ctx *fiber.Ctx, principal *Principal) error {
+	if principal.MFA || !slices.Contains(m.HeaderSchemes, principal.AuthType) {
+		return nil
+	}
+
+	code := ctx.Get(m.Header)
+	if code == "" {
+		return nil
+	}
+
+	// a dry run must not make the code of an older step unusable
+	if err := m.verify(ctx.UserContext(), principal.UserId, code, false, !IsDryRun(ctx)); err != nil {
+		return err
+	}
+	principal.MFA = true
+	return nil
+}
+
+// IsFresh reports whether a step-up at verifiedAt still counts
+func (m *MFA) IsFresh(verifiedAt *time.Time) bool {
+	return verifiedAt != nil && (m.MaxAge <= 0 || time.Since(*verifiedAt) <= m.MaxAge)
+}
+
+func (m *MFA) newRecoveryCodes() ([]string, []string, error) {
+	// no 0, 1, l and o, which are confused when the codes are typed
+	const alphabet = "abcdefghijkmnpqrstuvwxyz23456789"
+
+	codes := make([]string, 0, m.RecoveryCodes)
+	hashes := make([]string, 0, m.RecoveryCodes)
+	for range m.RecoveryCodes {
+		random := make([]byte, 10)
+		if _, err := rand.Read(random); err != nil {
+			return nil, nil, err
+		}
+
+		var b strings.Builder
+		for i, r := range random {
+			if i == 5 {
+				b.WriteByte('-')
+			}
+			b.WriteByte(alphabet[int(r)%len(alphabet)])
+		}
+		codes = append(codes, b.String())
+		hashes = append(hashes, hashCode(normalizeCode(b.String())))
+	}
+	return codes, hashes, nil
+}
+
+func (m *MFA) publish(userId string, action string, by string, remaining int) {
+	if m.Publish != nil {
+		m.Publish(EventMFAChanged, MFAEvent{UserId: userId, Action: action, By: by, Remaining: remaining, Time: time.Now()})
+	}
+}
+
+// normalizeCode removes separators and white space, recovery codes are case insensitive
+func normalizeCode(code string) string {
+	code = strings.ToLower(strings.TrimSpace(code))
+	return strings.NewReplacer("-", "", " ", "").Replace(code)
+}
+
+func hashCode(code string) string {
+	sum := sha256.Sum256([]byte(code))
+	return hex.EncodeToString(sum[:])
+}
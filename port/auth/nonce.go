@@ -0,0 +1,60 @@
+package auth
+
+import (
+	"context"
+	"time"
+
+	"github.com/webcore-go/webcore/port"
+)
+
+// INonceStore remembers the nonces of signed requests, so a captured request
+// cannot be sent again while its timestamp is accepted
+type INonceStore interface {
+	// Remember stores the nonce for ttl, false when it was already used
+	Remember(ctx context.Context, key string, ttl time.Duration) (bool, error)
+}
+
+// MemoryNonceStore keeps the nonces in process
+type MemoryNonceStore struct {
+	entries *ttlMap[struct{}]
+}
+
+func NewMemoryNonceStore() *MemoryNonceStore {
+	return &MemoryNonceStore{
+		entries: newTTLMap[struct{}](),
+	}
+}
+
+func (m *MemoryNonceStore) Remember(ctx context.Context, key string, ttl time.Duration) (bool, error) {
+	return m.entries.SetIfAbsent(key, struct{}{}, ttl), nil
+}
+
+// CacheNonceStore keeps the nonces in the configured IMemoryCache, so a
+// request cannot be replayed against another instance. Without ICacheAdder
+// two instances may accept the same nonce at the same moment.
+type CacheNonceStore struct {
+	Client ICacheClient
+}
+
+func NewCacheNonceStore(cache port.IMemoryCache) (*CacheNonceStore, error) {
+	client, err := cacheClient(cache)
+	if err != nil {
+		return nil, err
+	}
+	return &CacheNonceStore{Client: client}, nil
+}
+
+func (c *CacheNonceStore) Remember(ctx context.Context, key string, ttl time.Duration) (bool, error) {
+	if adder, ok := c.Client.(ICacheAdder); ok {
+		return adder.SetIfAbsent(ctx, key, []byte{1}, ttl)
+	}
+
+	data, err := c.Client.Get(ctx, key)
+	if err != nil {
+		return false, err
+	}
+	if data != nil {
+		return false, nil
+	}
+	return true, c.Client.Set(ctx, key, []byte{1}, ttl)
+}
@@ -0,0 +1,135 @@
+package auth
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"github.com/webcore-go/webcore/app/helper"
+	"github.com/webcore-go/webcore/infra/logger"
+)
+
+// key in fiber.Ctx locals holding the rehash of a password that needs an upgrade
+const LocalPasswordRehash = "auth_password_rehash"
+
+// key in fiber.Ctx locals set once the password of the request was compared
+const passwordCheckedLocal = "auth_password_checked"
+
+// IPasswordUpdater is implemented by stores that can persist a new password hash
+type IPasswordUpdater interface {
+	UpdatePassword(ctx *fiber.Ctx, userInfo IUserAuthInfo, hash string) error
+}
+
+// IDummyPasswordChecker is implemented by validators that check a password.
+// A failed authentication calls it, so a username without user takes as long
+// as a wrong password.
+type IDummyPasswordChecker interface {
+	CheckDummyPassword(ctx *fiber.Ctx)
+}
+
+// CheckPassword verifies the password against the stored hash in constant time.
+// When the stored value is plain text or an outdated hash, the rehash is kept
+// in the request locals for UpgradePassword. It is only computed there, for
+// stores that can persist it.
+func CheckPassword(ctx *fiber.Ctx, hasher *helper.PasswordHasher, stored *string, password string) bool {
+	if stored == nil {
+		CheckDummyPassword(ctx, hasher, password)
+		return false
+	}
+	ctx.Locals(passwordCheckedLocal, true)
+
+	ok, outdated := hasher.Verify(*stored, password)
+	if ok && outdated {
+		ctx.Locals(LocalPasswordRehash, func() (string, error) {
+			return hasher.Hash(password)
+		})
+	}
+
+	return ok
+}
+
+// CheckDummyPassword compares the password with a dummy hash, unless the
+// request already compared it with a stored one
+func CheckDummyPassword(ctx *fiber.Ctx, hasher *helper.PasswordHasher, password string) {
+	if checked, _ := ctx.Locals(passwordCheckedLocal).(bool); checked {
+		return
+	}
+	ctx.Locals(passwordCheckedLocal, true)
+	hasher.VerifyDummy(password)
+}
+
+// UpgradePassword writes the hash prepared by CheckPassword to the store
+func UpgradePassword(ctx *fiber.Ctx, store IStore, userInfo IUserAuthInfo) {
+	rehash, ok := ctx.Locals(LocalPasswordRehash).(func() (string, error))
+	if !ok {
+		return
+	}
+	ctx.Locals(LocalPasswordRehash, nil)
+	if IsDryRun(ctx) {
+		return
+	}
+
+	updater, ok := store.(IPasswordUpdater)
+	if !ok {
+		logger.Debug("Auth store cannot update password hashes, run the hash command to upgrade them")
+		return
+	}
+
+	hash, err := rehash()
+	if err != nil {
+		logger.Warn("Upgrade password hash failed", "error", err)
+		return
+	}
+
+	if err := updater.UpdatePassword(ctx, userInfo, hash); err != nil {
+		logger.Warn("Upgrade password hash failed", "error", err)
+	}
+}
+
+// PasswordValidator looks up a user by username and password for the login endpoints
+type PasswordValidator struct {
+	Username string
+	Password string
+	Hasher   *helper.PasswordHasher
+}
+
+func NewPasswordValidator(username string, password string, hasher *helper.PasswordHasher) *PasswordValidator {
+	return &PasswordValidator{
+		Username: username,
+		Password: password,
+		Hasher:   hasher,
+	}
+}
+
+func (v *PasswordValidator) Name() string {
+	return "password"
+}
+
+func (v *PasswordValidator) ValidateKey(ctx *fiber.Ctx) (string, error) {
+	return v.Username, nil
+}
+
+func (v *PasswordValidator) UserLookups(ctx *fiber.Ctx, userKey string) []UserLookup {
+	return []UserLookup{{Field: "user", Value: v.Username}}
+}
+
+func (v *PasswordValidator) VerifyUser(ctx *fiber.Ctx, userKey string, userInfo IUserAuthInfo) (bool, error) {
+	var username, password *string
+	switch user := userInfo.(type) {
+	case *UserAuthInfoRBAC:
+		username, password = user.Username, user.Password
+	case *UserAuthInfoABAC:
+		username, password = user.Username, user.Password
+	default:
+		return false, nil
+	}
+
+	// Users without username or password (e.g. API key users) cannot log in
+	if username == nil || password == nil || *username != v.Username {
+		v.CheckDummyPassword(ctx)
+		return false, nil
+	}
+
+	return CheckPassword(ctx, v.Hasher, password, v.Password), nil
+}
+
+func (v *PasswordValidator) CheckDummyPassword(ctx *fiber.Ctx) {
+	CheckDummyPassword(ctx, v.Hasher, v.Password)
+}
@@ -0,0 +1,110 @@
+package auth
+
+import (
+	"github.com/gofiber/fiber/v2"
+)
+
+// Keys in fiber.Ctx locals that are filled after successful authentication
+const (
+	LocalPrincipal   = "auth_principal"
+	LocalUserID      = "user_id"
+	LocalUserRole    = "user_role"
+	LocalPermissions = "user_permissions"
+	LocalAuthType    = "auth_type"
+	LocalAPIKey      = "api_key"
+	LocalActorID     = "actor_id" // user id of the admin of an impersonated request
+)
+
+// Principal is the authenticated identity of one request. It is created per
+// request and stored in fiber.Ctx locals, never shared between requests.
+type Principal struct {
+	UserId       string
+	Username     string
+	AuthType     string // name of the validator, e.g. "jwt", "apikey", "basic"
+	Groups       []string
+	Roles        []string // RBAC roles, empty for ABAC users
+	Permissions  []string // roles the user is permitted with ("permissions" in access.yaml)
+	Scopes       []string // actions a scoped credential is limited to, nil when not limited
+	CredentialId string   // id of the credential, e.g. the API key id
+	MFA          bool     // a second factor was verified for this request or its session
+	User         IUserAuthInfo
+	Resource     IResourceInfo // matched resource, nil when the path has no resource
+	Actor        *Principal    // authenticated admin of an impersonated request, nil otherwise
+}
+
+func NewPrincipal(authType string, user IUserAuthInfo) *Principal {
+	p := &Principal{
+		AuthType: authType,
+		User:     user,
+	}
+
+	switch u := user.(type) {
+	case *UserAuthInfoRBAC:
+		p.UserId = u.UserId
+		if u.Username != nil {
+			p.Username = *u.Username
+		}
+		p.Groups = u.Groups
+		p.Roles = u.Roles
+		p.Permissions = u.Roles
+	case *UserAuthInfoABAC:
+		p.UserId = u.UserId
+		if u.Username != nil {
+			p.Username = *u.Username
+		}
+		p.Groups = u.Groups
+	}
+
+	if p.UserId == "" {
+		p.UserId = p.Username
+	}
+
+	return p
+}
+
+// IPrincipalExtender is implemented by validators that add credential details,
+// like API key scopes, to the principal
+type IPrincipalExtender interface {
+	ExtendPrincipal(ctx *fiber.Ctx, principal *Principal)
+}
+
+// SetPrincipal stores the principal and the flat values read by the middleware
+// helpers, and puts it into the user context for the row security of queries
+func SetPrincipal(ctx *fiber.Ctx, p *Principal) {
+	ctx.Locals(LocalPrincipal, p)
+	ctx.SetUserContext(ContextWithPrincipal(ctx.UserContext(), p))
+	ctx.Locals(LocalUserID, p.UserId)
+	ctx.Locals(LocalUserRole, p.Roles)
+	ctx.Locals(LocalPermissions, p.Permissions)
+	ctx.Locals(LocalAuthType, p.AuthType)
+	if p.Actor != nil {
+		ctx.Locals(LocalActorID, p.Actor.UserId)
+	}
+}
+
+// Name returns the username for logs, audit events and response headers. The
+// user id of a user without name can be a plain API key, so only a hash of it
+// is returned, like the identity of the lockout.
+func (p *Principal) Name() string {
+	if p.Username != "" {
+		return p.Username
+	}
+	if p.UserId == "" {
+		return ""
+	}
+	return hashedUserName(p.UserId)
+}
+
+// hashedUserName names a user by a hash of its user id, for logs
+func hashedUserName(userId string) string {
+	return "user:" + hashCode(userId)[:16]
+}
+
+// GetPrincipal returns the principal of the current request, nil when not authenticated
+func GetPrincipal(ctx *fiber.Ctx) *Principal {
+	p, ok := ctx.Locals(LocalPrincipal).(*Principal)
+	if !ok {
+		return nil
+	}
+	return p
+}
@@ -0,0 +1,340 @@
+package auth
+
+import (
+	"container/list"
+	"context"
+	"sync"
+	"time"
+
+	"github.com/webcore-go/webcore/infra/logger"
+	"github.com/webcore-go/webcore/port"
+)
+
+// Kinds of revocations
+const (
+	RevokeToken        = "jti"           // one token by its id
+	RevokeIssuedBefore = "issued_before" // every token of a subject issued before a time
+	RevokeSubject      = "subject"       // every token of a subject, including new ones, until the entry expires
+)
+
+// RevocationEntry revokes one token, or the tokens of a subject
+type RevocationEntry struct {
+	Kind      string    `json:"kind"`
+	Value     string    `json:"value"`           // token id or subject
+	Before    time.Time `json:"before,omitzero"` // RevokeIssuedBefore: tokens issued before are rejected
+	RevokedAt time.Time `json:"revoked_at"`
+	ExpiresAt time.Time `json:"expires_at,omitzero"` // zero keeps the entry until it is removed
+	Reason    string    `json:"reason,omitempty"`
+}
+
+// RevocationToken identifies a verified token or session for the revocation check
+type RevocationToken struct {
+	ID       string // jti or session id
+	Subject  string
+	IssuedAt time.Time // zero when the token has no iat, such tokens are rejected by RevokeIssuedBefore
+}
+
+// UserSubject returns the subject a user is revoked under: the username, or
+// the user id when the user has no name. JWT, session, mTLS and HMAC
+// credentials are all checked against it.
+func UserSubject(user IUserAuthInfo) string {
+	switch u := user.(type) {
+	case *UserAuthInfoRBAC:
+		if u.Username != nil && *u.Username != "" {
+			return *u.Username
+		}
+		return u.UserId
+	case *UserAuthInfoABAC:
+		if u.Username != nil && *u.Username != "" {
+			return *u.Username
+		}
+		return u.UserId
+	}
+	return ""
+}
+
+// IRevocationStore keeps the revocations, either in process or in a shared cache
+type IRevocationStore interface {
+	Load(ctx context.Context, key string) (*RevocationEntry, error) // nil when there is no entry
+	Save(ctx context.Context, key string, entry *RevocationEntry, ttl time.Duration) error
+	Delete(ctx context.Context, key string) error
+}
+
+// Revocation rejects tokens and sessions before they expire, e.g. after a
+// logout, a compromised account or a role change
+type Revocation struct {
+	Store       IRevocationStore
+	MaxLifetime time.Duration                // longest lifetime of a token, entries of tokens are kept as long
+	FailClosed  bool                         // reject tokens when the store is unavailable
+	Publish     func(event string, data any) // receives EventTokenRevoked, may be nil
+
+	cache *revocationCache
+}
+
+func NewRevocation(store IRevocationStore, maxLifetime time.Duration) *Revocation {
+	return &Revocation{
+		Store:       store,
+		MaxLifetime: maxLifetime,
+	}
+}
+
+// EnableCache keeps the result of store lookups for ttl in a local LRU of
+// size entries, so a shared store is not asked on every request. Revocations
+// of other instances take effect after at most ttl.
+func (r *Revocation) EnableCache(size int, ttl time.Duration) {
+	if size > 0 && ttl > 0 {
+		r.cache = newRevocationCache(size, ttl)
+	}
+}
+
+// Check returns ErrCredentialsRevoked when the token, its subject or all
+// tokens of the subject issued before the token are revoked
+func (r *Revocation) Check(ctx context.Context, token RevocationToken) error {
+	lookups := []struct {
+		kind  string
+		value string
+	}{
+		{RevokeToken, token.ID},
+		{RevokeSubject, token.Subject},
+		{RevokeIssuedBefore, token.Subject},
+	}
+
+	for _, lookup := range lookups {
+		if lookup.value == "" {
+			continue
+		}
+
+		entry, err := r.load(ctx, lookup.kind, lookup.value)
+		if err != nil {
+			logger.Warn("Load revocation failed", "kind", lookup.kind, "error", err)
+			if r.FailClosed {
+				return ErrCredentialsRevoked.Withf("revocation store unavailable: %v", err)
+			}
+			continue
+		}
+		if entry == nil {
+			continue
+		}
+
+		if entry.Kind == RevokeIssuedBefore && !token.IssuedAt.IsZero() && !token.IssuedAt.Before(entry.Before) {
+			continue
+		}
+		return ErrCredentialsRevoked.Withf("%s %s revoked", lookup.kind, lookup.value)
+	}
+
+	return nil
+}
+
+func (r *Revocation) load(ctx context.Context, kind string, value string) (*RevocationEntry, error) {
+	key := revocationKey(kind, value)
+	if entry, ok := r.cache.get(key); ok {
+		return entry, nil
+	}
+
+	entry, err := r.Store.Load(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	if entry != nil && !entry.ExpiresAt.IsZero() && time.Now().After(entry.ExpiresAt) {
+		entry = nil
+	}
+
+	r.cache.set(key, entry)
+	return entry, nil
+}
+
+// RevokeToken revokes one token until it expires, a zero expiresAt keeps the
+// entry for MaxLifetime
+func (r *Revocation) RevokeToken(ctx context.Context, id string, expiresAt time.Time, reason string) error {
+	if expiresAt.IsZero() {
+		expiresAt = time.Now().Add(r.MaxLifetime)
+	}
+	return r.Revoke(ctx, &RevocationEntry{Kind: RevokeToken, Value: id, ExpiresAt: expiresAt, Reason: reason})
+}
+
+// RevokeIssuedBefore revokes every token of the subject issued before the
+// time, e.g. "log out everywhere" or a role change. New tokens stay valid.
+// The iat of tokens has second precision, so before is rounded up to the next
+// second and tokens issued within that second are revoked as well.
+func (r *Revocation) RevokeIssuedBefore(ctx context.Context, subject string, before time.Time, reason string) error {
+	if rounded := before.Truncate(time.Second); rounded.Before(before) {
+		before = rounded.Add(time.Second)
+	}
+	return r.Revoke(ctx, &RevocationEntry{Kind: RevokeIssuedBefore, Value: subject, Before: before, ExpiresAt: before.Add(r.MaxLifetime), Reason: reason})
+}
+
+// RevokeSubject rejects every token of the subject until expiresAt, a zero
+// expiresAt until the entry is removed
+func (r *Revocation) RevokeSubject(ctx context.Context, subject string, expiresAt time.Time, reason string) error {
+	return r.Revoke(ctx, &RevocationEntry{Kind: RevokeSubject, Value: subject, ExpiresAt: expiresAt, Reason: reason})
+}
+
+// Revoke stores the entry and publishes EventTokenRevoked
+func (r *Revocation) Revoke(ctx context.Context, entry *RevocationEntry) error {
+	if entry.RevokedAt.IsZero() {
+		entry.RevokedAt = time.Now()
+	}
+
+	var ttl time.Duration
+	if !entry.ExpiresAt.IsZero() {
+		ttl = time.Until(entry.ExpiresAt)
+		if ttl <= 0 {
+			// the tokens already expired, nothing to reject
+			return nil
+		}
+	}
+
+	key := revocationKey(entry.Kind, entry.Value)
+	if err := r.Store.Save(ctx, key, entry, ttl); err != nil {
+		return err
+	}
+	r.cache.set(key, entry)
+
+	logger.Info("Authentication revoked", "kind", entry.Kind, "value", entry.Value, "reason", entry.Reason)
+	if r.Publish != nil {
+		r.Publish(EventTokenRevoked, *entry)
+	}
+	return nil
+}
+
+// Get returns the entry of a token id or subject, nil when it is not revoked
+func (r *Revocation) Get(ctx context.Context, kind string, value string) (*RevocationEntry, error) {
+	entry, err := r.Store.Load(ctx, revocationKey(kind, value))
+	if err != nil || entry == nil {
+		return nil, err
+	}
+	if !entry.ExpiresAt.IsZero() && time.Now().After(entry.ExpiresAt) {
+		return nil, nil
+	}
+	return entry, nil
+}
+
+// Remove deletes a revocation, the tokens are accepted again
+func (r *Revocation) Remove(ctx context.Context, kind string, value string) error {
+	key := revocationKey(kind, value)
+	if err := r.Store.Delete(ctx, key); err != nil {
+		return err
+	}
+	r.cache.set(key, nil)
+
+	logger.Info("Authentication revocation removed", "kind", kind, "value", value)
+	return nil
+}
+
+func revocationKey(kind string, value string) string {
+	return "auth:revoked:" + kind + ":" + value
+}
+
+// revocationCache is a LRU of store lookups, nil entries are cached as well
+// because almost every lookup finds no revocation
+type revocationCache struct {
+	mu    sync.Mutex
+	size  int
+	ttl   time.Duration
+	order *list.List // front is the most recently used
+	items map[string]*list.Element
+}
+
+type revocationCacheItem struct {
+	key    string
+	entry  *RevocationEntry
+	loaded time.Time
+}
+
+func newRevocationCache(size int, ttl time.Duration) *revocationCache {
+	return &revocationCache{
+		size:  size,
+		ttl:   ttl,
+		order: list.New(),
+		items: make(map[string]*list.Element, size),
+	}
+}
+
+func (c *revocationCache) get(key string) (*RevocationEntry, bool) {
+	if c == nil {
+		return nil, false
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	element, ok := c.items[key]
+	if !ok {
+		return nil, false
+	}
+
+	item := element.Value.(*revocationCacheItem)
+	if time.Since(item.loaded) > c.ttl || (item.entry != nil && !item.entry.ExpiresAt.IsZero() && time.Now().After(item.entry.ExpiresAt)) {
+		c.order.Remove(element)
+		delete(c.items, key)
+		return nil, false
+	}
+
+	c.order.MoveToFront(element)
+	return item.entry, true
+}
+
+func (c *revocationCache) set(key string, entry *RevocationEntry) {
+	if c == nil {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if element, ok := c.items[key]; ok {
+		element.Value = &revocationCacheItem{key: key, entry: entry, loaded: time.Now()}
+		c.order.MoveToFront(element)
+		return
+	}
+
+	c.items[key] = c.order.PushFront(&revocationCacheItem{key: key, entry: entry, loaded: time.Now()})
+	if c.order.Len() > c.size {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.items, oldest.Value.(*revocationCacheItem).key)
+	}
+}
+
+// MemoryRevocationStore keeps the revocations in process
+type MemoryRevocationStore struct {
+	entries *ttlMap[RevocationEntry]
+}
+
+func NewMemoryRevocationStore() *MemoryRevocationStore {
+	return &MemoryRevocationStore{
+		entries: newTTLMap[RevocationEntry](),
+	}
+}
+
+func (m *MemoryRevocationStore) Load(ctx context.Context, key string) (*RevocationEntry, error) {
+	entry, ok := m.entries.Get(key)
+	if !ok {
+		return nil, nil
+	}
+	return &entry, nil
+}
+
+func (m *MemoryRevocationStore) Save(ctx context.Context, key string, entry *RevocationEntry, ttl time.Duration) error {
+	m.entries.Set(key, *entry, ttl)
+	return nil
+}
+
+func (m *MemoryRevocationStore) Delete(ctx context.Context, key string) error {
+	m.entries.Delete(key)
+	return nil
+}
+
+// CacheRevocationStore keeps the revocations in the configured IMemoryCache,
+// so all instances of the application share them
+type CacheRevocationStore struct {
+	cacheJSON[RevocationEntry]
+}
+
+func NewCacheRevocationStore(cache port.IMemoryCache) (*CacheRevocationStore, error) {
+	client, err := cacheClient(cache)
+	if err != nil {
+		return nil, err
+	}
+	return &CacheRevocationStore{cacheJSON[RevocationEntry]{Client: client}}, nil
+}
@@ -0,0 +1,388 @@
+package auth
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+type segmentKind int
+
+const (
+	segmentStatic   segmentKind = iota // "users"
+	segmentComplex                     // ":from-:to", "file.:ext"
+	segmentParam                       // ":id" or optional ":id?"
+	segmentWildcard                    // "*" (zero or more) or "+" (one or more)
+)
+
+// RouteIndex is a segment trie over Fiber route patterns. It supports static
+// segments, ":param", optional ":param?", params mixed with text inside one
+// segment and the greedy "*" / "+" wildcards. When several patterns match,
+// the most specific wins: static before mixed, mixed before param, param
+// before wildcard, compared segment by segment from the left.
+type RouteIndex[T any] struct {
+	root *routeNode[T]
+	size int
+}
+
+// RouteMatch is the result of RouteIndex.Match
+type RouteMatch[T any] struct {
+	Value   T
+	Method  string
+	Pattern string
+	Params  map[string]string
+}
+
+type routeEntry[T any] struct {
+	methods []string // nil matches every method
+	method  string
+	pattern string
+	value   T
+}
+
+type routeNode[T any] struct {
+	kind     segmentKind
+	segment  string
+	name     string
+	optional bool
+	regex    *regexp.Regexp
+	names    []string
+
+	static    map[string]*routeNode[T]
+	complex   []*routeNode[T]
+	params    []*routeNode[T]
+	wildcards []*routeNode[T]
+	entries   []*routeEntry[T]
+}
+
+func NewRouteIndex[T any]() *RouteIndex[T] {
+	return &RouteIndex[T]{
+		root: &routeNode[T]{},
+	}
+}
+
+// Len returns the number of indexed patterns
+func (r *RouteIndex[T]) Len() int {
+	return r.size
+}
+
+// Add indexes a pattern; method may be a single method, "*" (or empty) for
+// all methods, or a list separated by comma, space or "|"
+func (r *RouteIndex[T]) Add(method string, pattern string, value T) error {
+	methods := ParseMethods(method)
+
+	node := r.root
+	for _, segment := range splitPath(pattern) {
+		child, err := node.child(segment)
+		if err != nil {
+			return fmt.Errorf("Invalid route pattern %s: %v", pattern, err)
+		}
+		node = child
+	}
+
+	for _, entry := range node.entries {
+		if entry.methods == nil && methods == nil {
+			return fmt.Errorf("Route %s %s is defined more than once", method, pattern)
+		}
+		for _, m := range methods {
+			if slices.Contains(entry.methods, m) {
+				return fmt.Errorf("Route %s %s is defined more than once", m, pattern)
+			}
+		}
+	}
+
+	node.entries = append(node.entries, &routeEntry[T]{
+		methods: methods,
+		method:  method,
+		pattern: pattern,
+		value:   value,
+	})
+	r.size++
+	return nil
+}
+
+// Match returns the most specific pattern that matches method and path, a
+// HEAD request matches GET patterns unless the path has a HEAD pattern
+func (r *RouteIndex[T]) Match(method string, path string) (*RouteMatch[T], bool) {
+	params := make(map[string]string)
+	entry := r.root.match(strings.ToUpper(method), splitPath(path), params)
+	if entry == nil {
+		return nil, false
+	}
+
+	return &RouteMatch[T]{
+		Value:   entry.value,
+		Method:  entry.method,
+		Pattern: entry.pattern,
+		Params:  params,
+	}, true
+}
+
+// ParseMethods returns nil for "*" or empty, otherwise the upper case method list
+func ParseMethods(method string) []string {
+	fields := strings.FieldsFunc(method, func(r rune) bool {
+		return r == ',' || r == ' ' || r == '|'
+	})
+
+	methods := make([]string, 0, len(fields))
+	for _, field := range fields {
+		if field == "*" {
+			return nil
+		}
+		methods = append(methods, strings.ToUpper(field))
+	}
+
+	if len(methods) == 0 {
+		return nil
+	}
+	return methods
+}
+
+func splitPath(path string) []string {
+	path = strings.TrimPrefix(path, "/")
+	if path == "" {
+		return nil
+	}
+	return strings.Split(path, "/")
+}
+
+var paramNameRegex = regexp.MustCompile(`^:[A-Za-z0-9_]+\??$`)
+
+// child returns the child node for a pattern segment, creating it when needed
+func (n *routeNode[T]) child(segment string) (*routeNode[T], error) {
+	switch {
+	case segment == "*" || segment == "+":
+		for _, c := range n.wildcards {
+			if c.segment == segment {
+				return c, nil
+			}
+		}
+		c := &routeNode[T]{kind: segmentWildcard, segment: segment, name: segment}
+		n.wildcards = append(n.wildcards, c)
+		return c, nil
+
+	case paramNameRegex.MatchString(segment):
+		for _, c := range n.params {
+			if c.segment == segment {
+				return c, nil
+			}
+		}
+		c := &routeNode[T]{
+			kind:     segmentParam,
+			segment:  segment,
+			name:     strings.TrimSuffix(segment[1:], "?"),
+			optional: strings.HasSuffix(segment, "?"),
+		}
+		n.params = append(n.params, c)
+		// required params are tried before optional ones
+		slices.SortStableFunc(n.params, func(a, b *routeNode[T]) int {
+			switch {
+			case a.optional == b.optional:
+				return 0
+			case b.optional:
+				return -1
+			}
+			return 1
+		})
+		return c, nil
+
+	case strings.ContainsAny(segment, ":*+"):
+		for _, c := range n.complex {
+			if c.segment == segment {
+				return c, nil
+			}
+		}
+		regex, names, err := compileSegment(segment)
+		if err != nil {
+			return nil, err
+		}
+		c := &routeNode[T]{kind: segmentComplex, segment: segment, regex: regex, names: names}
+		n.complex = append(n.complex, c)
+		return c, nil
+	}
+
+	if n.static == nil {
+		n.static = make(map[string]*routeNode[T])
+	}
+	c, ok := n.static[segment]
+	if !ok {
+		c = &routeNode[T]{kind: segmentStatic, segment: segment}
+		n.static[segment] = c
+	}
+	return c, nil
+}
+
+// compileSegment turns a segment like ":from-:to" into an anchored regex
+func compileSegment(segment string) (*regexp.Regexp, []string, error) {
+	var expr strings.Builder
+	names := []string{}
+
+	expr.WriteString("^")
+	for i := 0; i < len(segment); {
+		switch ch := segment[i]; {
+		case ch == ':':
+			j := i + 1
+			for j < len(segment) && isParamChar(segment[j]) {
+				j++
+			}
+			if j == i+1 {
+				return nil, nil, fmt.Errorf("empty parameter name in %s", segment)
+			}
+			names = append(names, segment[i+1:j])
+			if j < len(segment) && segment[j] == '?' {
+				expr.WriteString("(.*?)")
+				j++
+			} else {
+				expr.WriteString("(.+?)")
+			}
+			i = j
+		case ch == '*':
+			names = append(names, "*")
+			expr.WriteString("(.*)")
+			i++
+		case ch == '+':
+			names = append(names, "+")
+			expr.WriteString("(.+)")
+			i++
+		default:
+			expr.WriteString(regexp.QuoteMeta(string(ch)))
+			i++
+		}
+	}
+	expr.WriteString("$")
+
+	regex, err := regexp.Compile(expr.String())
+	return regex, names, err
+}
+
+func isParamChar(ch byte) bool {
+	return ch == '_' || (ch >= '0' && ch <= '9') || (ch >= 'a' && ch <= 'z') || (ch >= 'A' && ch <= 'Z')
+}
+
+// entry returns the entry for the method, exact methods win over "*". HEAD
+// falls back to GET like the Get routes of Fiber, which also serve HEAD.
+func (n *routeNode[T]) entry(method string) *routeEntry[T] {
+	var get, wildcard *routeEntry[T]
+	for _, e := range n.entries {
+		if e.methods == nil {
+			if wildcard == nil {
+				wildcard = e
+			}
+			continue
+		}
+		if slices.Contains(e.methods, method) {
+			return e
+		}
+		if method == fiber.MethodHead && get == nil && slices.Contains(e.methods, fiber.MethodGet) {
+			get = e
+		}
+	}
+	if get != nil {
+		return get
+	}
+	return wildcard
+}
+
+func (n *routeNode[T]) match(method string, segments []string, params map[string]string) *routeEntry[T] {
+	if len(segments) == 0 {
+		if e := n.entry(method); e != nil {
+			return e
+		}
+
+		// optional params and "*" may match nothing
+		for _, c := range n.params {
+			if c.optional {
+				if e := c.match(method, segments, params); e != nil {
+					params[c.name] = ""
+					return e
+				}
+			}
+		}
+		for _, c := range n.wildcards {
+			if c.segment == "*" {
+				if e := c.match(method, segments, params); e != nil {
+					params[c.name] = ""
+					return e
+				}
+			}
+		}
+		return nil
+	}
+
+	segment := segments[0]
+	rest := segments[1:]
+
+	if c, ok := n.static[segment]; ok {
+		if e := c.match(method, rest, params); e != nil {
+			return e
+		}
+	}
+
+	for _, c := range n.complex {
+		values := c.regex.FindStringSubmatch(segment)
+		if values == nil {
+			continue
+		}
+		if e := c.match(method, rest, params); e != nil {
+			for i, name := range c.names {
+				params[name] = values[i+1]
+			}
+			return e
+		}
+	}
+
+	for _, c := range n.params {
+		if segment != "" {
+			if e := c.match(method, rest, params); e != nil {
+				params[c.name] = segment
+				return e
+			}
+		}
+		if c.optional {
+			if e := c.match(method, segments, params); e != nil {
+				params[c.name] = ""
+				return e
+			}
+		}
+	}
+
+	for _, c := range n.wildcards {
+		// greedy: consume as many segments as possible first
+		for k := len(segments); k >= 0; k-- {
+			value := strings.Join(segments[:k], "/")
+			if c.segment == "+" && value == "" {
+				continue
+			}
+			if e := c.match(method, segments[k:], params); e != nil {
+				params[c.name] = value
+				return e
+			}
+		}
+	}
+
+	return nil
+}
+
+var pathParamsCache sync.Map
+
+// PathParams extracts the parameters of a single pattern from the request path
+func PathParams(pattern string, path string) map[string]string {
+	cached, ok := pathParamsCache.Load(pattern)
+	if !ok {
+		index := NewRouteIndex[struct{}]()
+		if err := index.Add("*", pattern, struct{}{}); err != nil {
+			return make(map[string]string)
+		}
+		cached, _ = pathParamsCache.LoadOrStore(pattern, index)
+	}
+
+	match, ok := cached.(*RouteIndex[struct{}]).Match("GET", path)
+	if !ok {
+		return make(map[string]string)
+	}
+	return match.Params
+}
@@ -0,0 +1,407 @@
+package auth
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/webcore-go/webcore/infra/logger"
+	"github.com/webcore-go/webcore/port"
+)
+
+type principalContextKey struct{}
+type systemContextKey struct{}
+
+// ContextWithPrincipal returns ctx carrying the principal, SetPrincipal puts
+// it into the user context of the request
+func ContextWithPrincipal(ctx context.Context, principal *Principal) context.Context {
+	return context.WithValue(ctx, principalContextKey{}, principal)
+}
+
+// PrincipalFromContext returns the principal of ctx, nil when there is none
+func PrincipalFromContext(ctx context.Context) *Principal {
+	principal, _ := ctx.Value(principalContextKey{}).(*Principal)
+	return principal
+}
+
+// SystemContext marks ctx for system jobs (migrations, schedulers, consumers)
+// that read and write all rows. The reason is logged with every query, use it
+// only where no user is behind the query.
+func SystemContext(ctx context.Context, reason string) context.Context {
+	return context.WithValue(ctx, systemContextKey{}, reason)
+}
+
+// IsSystemContext reports whether ctx was created by SystemContext
+func IsSystemContext(ctx context.Context) bool {
+	_, ok := ctx.Value(systemContextKey{}).(string)
+	return ok
+}
+
+// Operators of row policies
+const (
+	RowOpEqual = "="  // the column equals the principal value
+	RowOpIn    = "in" // the column is one of the principal values, e.g. a list attribute
+)
+
+// RowPolicy restricts the rows of a table to those of the principal. Value is
+// a path of the principal: id, username, groups, roles, permissions or
+// attributes.<name> of ABAC users.
+type RowPolicy struct {
+	Column      string
+	Op          string   // RowOpEqual or RowOpIn
+	Value       string   // principal path, e.g. "id" or "attributes.tenants"
+	BypassRoles []string // principals with one of the roles see all rows
+}
+
+// ParseRowPolicy reads "<column> = principal.<path>" or
+// "<column> in principal.<path>", e.g. "tenant_id in principal.attributes.tenants"
+func ParseRowPolicy(rule string) (*RowPolicy, error) {
+	fields := strings.Fields(rule)
+	if len(fields) != 3 {
+		return nil, fmt.Errorf("Row policy %q must have the form '<column> = principal.<path>'", rule)
+	}
+
+	op := strings.ToLower(fields[1])
+	if op != RowOpEqual && op != RowOpIn {
+		return nil, fmt.Errorf("Row policy %q has unknown operator %s, use = or in", rule, fields[1])
+	}
+
+	value, found := strings.CutPrefix(fields[2], "principal.")
+	if !found || value == "" {
+		return nil, fmt.Errorf("Row policy %q must compare with principal.<path>", rule)
+	}
+
+	return &RowPolicy{Column: fields[0], Op: op, Value: value}, nil
+}
+
+// Filter returns the expression of the policy for the principal. ok is false
+// when the principal has no value, so it must not see any row.
+func (p *RowPolicy) Filter(principal *Principal) (expression port.DbExpression, ok bool) {
+	value, found := principal.rowAttributes().Get(p.Value)
+	if !found || value == nil {
+		return port.DbExpression{}, false
+	}
+
+	if p.Op == RowOpIn {
+		values := toList(value)
+		if values == nil {
+			values = []any{value}
+		}
+		if len(values) == 0 {
+			return port.DbExpression{}, false
+		}
+		return port.DbExpression{Expr: p.Column, Op: "IN", Args: values}, true
+	}
+
+	if toList(value) != nil {
+		return port.DbExpression{}, false
+	}
+	return port.DbExpression{Expr: p.Column, Op: "=", Args: []any{value}}, true
+}
+
+// bypasses reports whether the principal sees all rows of the policy
+func (p *RowPolicy) bypasses(principal *Principal) bool {
+	return slices.ContainsFunc(principal.Roles, func(role string) bool {
+		return slices.Contains(p.BypassRoles, role)
+	})
+}
+
+// rowAttributes are the values a row policy can refer to
+func (p *Principal) rowAttributes() Attributes {
+	attrs := Attributes{
+		"id":          p.UserId,
+		"username":    p.Username,
+		"groups":      p.Groups,
+		"roles":       p.Roles,
+		"permissions": p.Permissions,
+	}
+	if user, ok := p.User.(*UserAuthInfoABAC); ok {
+		attrs["attributes"] = user.Attributes
+	}
+	return attrs
+}
+
+// RowSecurity holds the row policies of the tables, declared by the modules.
+// Policies of one table are combined with AND, tables without policies are
+// not filtered.
+type RowSecurity struct {
+	mu       sync.RWMutex
+	policies map[string][]*RowPolicy
+}
+
+func NewRowSecurity() *RowSecurity {
+	return &RowSecurity{policies: map[string][]*RowPolicy{}}
+}
+
+// Add registers policies of a table
+func (r *RowSecurity) Add(table string, policies ...*RowPolicy) error {
+	for _, policy := range policies {
+		if policy.Column == "" || policy.Value == "" || (policy.Op != RowOpEqual && policy.Op != RowOpIn) {
+			return fmt.Errorf("Row policy of table %s requires column, value and operator = or in", table)
+		}
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.policies[table] = append(r.policies[table], policies...)
+	return nil
+}
+
+// Register parses the rules with ParseRowPolicy and adds them to the table
+func (r *RowSecurity) Register(table string, rules ...string) error {
+	policies := make([]*RowPolicy, 0, len(rules))
+	for _, rule := range rules {
+		policy, err := ParseRowPolicy(rule)
+		if err != nil {
+			return err
+		}
+		policies = append(policies, policy)
+	}
+	return r.Add(table, policies...)
+}
+
+// Policies returns the policies of a table
+func (r *RowSecurity) Policies(table string) []*RowPolicy {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.policies[table]
+}
+
+// Filters returns the expressions the principal of ctx adds to queries of the
+// table. visible is false when the principal cannot see any row. Without
+// principal and outside of SystemContext the query is rejected, so a
+// forgotten context never reads the rows of all users.
+func (r *RowSecurity) Filters(ctx context.Context, table string) (filters []port.DbExpression, visible bool, err error) {
+	policies := r.Policies(table)
+	if len(policies) == 0 {
+		return nil, true, nil
+	}
+
+	if reason, ok := ctx.Value(systemContextKey{}).(string); ok {
+		logger.Debug("Row security bypassed", "table", table, "reason", reason)
+		return nil, true, nil
+	}
+
+	principal := PrincipalFromContext(ctx)
+	if principal == nil {
+		return nil, false, ErrCredentialsMissing.Withf("Table %s has row policies, the query requires a principal or a system context", table)
+	}
+
+	for _, policy := range policies {
+		if policy.bypasses(principal) {
+			continue
+		}
+		filter, ok := policy.Filter(principal)
+		if !ok {
+			return nil, false, nil
+		}
+		filters = append(filters, filter)
+	}
+	return filters, true, nil
+}
+
+// CheckData rejects inserted or updated columns of a map or struct that the
+// policies of the table set to a value the principal cannot see, e.g. moving
+// a row to another tenant. Other data is rejected on tables with policies,
+// because its columns cannot be checked.
+func (r *RowSecurity) CheckData(ctx context.Context, table string, data any) error {
+	filters, visible, err := r.Filters(ctx, table)
+	if err != nil {
+		return err
+	}
+	if !visible {
+		return ErrForbidden.Withf("No rows of table %s are visible", table)
+	}
+	if len(filters) == 0 {
+		return nil
+	}
+
+	values, ok := dataColumns(data)
+	if !ok {
+		return ErrForbidden.Withf("Data of type %T cannot be checked against the row policies of table %s, use a map or struct", data, table)
+	}
+
+	for _, filter := range filters {
+		value, ok := values[filter.Expr]
+		if ok && !slices.ContainsFunc(filter.Args, func(arg any) bool { return equalValues(arg, value) }) {
+			return ErrForbidden.Withf("Column %s of table %s cannot be set to %v", filter.Expr, table, value)
+		}
+	}
+	return nil
+}
+
+// dataColumns returns the columns of a map, or of a struct by the db, bson or
+// json tags of its fields (the field name without tag), false for other data
+func dataColumns(data any) (map[string]any, bool) {
+	switch d := data.(type) {
+	case map[string]any:
+		return d, true
+	case port.DbMap:
+		return d, true
+	}
+
+	v := reflect.ValueOf(data)
+	for v.Kind() == reflect.Pointer || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return nil, false
+		}
+		v = v.Elem()
+	}
+	if v.Kind() != reflect.Struct {
+		return nil, false
+	}
+
+	values := map[string]any{}
+	structColumns(v, values)
+	return values, true
+}
+
+func structColumns(v reflect.Value, values map[string]any) {
+	for i := 0; i < v.NumField(); i++ {
+		field := v.Type().Field(i)
+		if !field.IsExported() {
+			continue
+		}
+
+		name, options := "", ""
+		for _, tag := range []string{"db", "bson", "json"} {
+			if value, ok := field.Tag.Lookup(tag); ok {
+				name, options, _ = strings.Cut(value, ",")
+				break
+			}
+		}
+		if name == "-" {
+			continue
+		}
+
+		value := v.Field(i)
+		// columns of embedded structs belong to the row itself
+		if field.Anonymous && name == "" {
+			for value.Kind() == reflect.Pointer && !value.IsNil() {
+				value = value.Elem()
+			}
+			if value.Kind() == reflect.Struct {
+				structColumns(value, values)
+				continue
+			}
+		}
+
+		if name == "" {
+			name = field.Name
+		}
+		// a nil pointer is written as NULL, with omitempty it is not written
+		if value.Kind() == reflect.Pointer {
+			if value.IsNil() {
+				if !strings.Contains(options, "omitempty") {
+					values[name] = nil
+				}
+				continue
+			}
+			value = value.Elem()
+		}
+		values[name] = value.Interface()
+	}
+}
+
+// SecureDatabase adds the row policies of the principal in the context to
+// Count, Find, FindOne, Update and Delete of the wrapped database. Inserted
+// and updated maps and structs must stay within the rows of the principal.
+type SecureDatabase struct {
+	port.IDatabase
+	Security *RowSecurity
+}
+
+func NewSecureDatabase(database port.IDatabase, security *RowSecurity) *SecureDatabase {
+	return &SecureDatabase{IDatabase: database, Security: security}
+}
+
+// filter appends the row filters to the filter of the caller
+func (d *SecureDatabase) filter(ctx context.Context, table string, filter []port.DbExpression) ([]port.DbExpression, bool, error) {
+	filters, visible, err := d.Security.Filters(ctx, table)
+	if err != nil || !visible || len(filters) == 0 {
+		return filter, visible, err
+	}
+	return append(slices.Clone(filter), filters...), true, nil
+}
+
+func (d *SecureDatabase) Count(ctx context.Context, table string, filter []port.DbExpression) (int64, error) {
+	filter, visible, err := d.filter(ctx, table, filter)
+	if err != nil || !visible {
+		return 0, err
+	}
+	return d.IDatabase.Count(ctx, table, filter)
+}
+
+func (d *SecureDatabase) Find(ctx context.Context, results any, table string, column []string, filter []port.DbExpression, sort map[string]int, limit int64, skip int64) error {
+	filter, visible, err := d.filter(ctx, table, filter)
+	if err != nil {
+		return err
+	}
+	if !visible {
+		// an empty result, as for a filter without matches
+		if v := reflect.ValueOf(results); v.Kind() == reflect.Pointer && v.Elem().Kind() == reflect.Slice {
+			v.Elem().Set(reflect.MakeSlice(v.Elem().Type(), 0, 0))
+		}
+		return nil
+	}
+	return d.IDatabase.Find(ctx, results, table, column, filter, sort, limit, skip)
+}
+
+func (d *SecureDatabase) FindOne(ctx context.Context, result any, table string, column []string, filter []port.DbExpression, sort map[string]int) error {
+	filter, visible, err := d.filter(ctx, table, filter)
+	if err != nil {
+		return err
+	}
+	if !visible {
+		return fmt.Errorf("No row of table %s found", table)
+	}
+	return d.IDatabase.FindOne(ctx, result, table, column, filter, sort)
+}
+
+func (d *SecureDatabase) InsertOne(ctx context.Context, table string, data any) (any, error) {
+	if err := d.Security.CheckData(ctx, table, data); err != nil {
+		return nil, err
+	}
+	return d.IDatabase.InsertOne(ctx, table, data)
+}
+
+func (d *SecureDatabase) Update(ctx context.Context, table string, filter []port.DbExpression, data any) (int64, error) {
+	filter, visible, err := d.filter(ctx, table, filter)
+	if err != nil || !visible {
+		return 0, err
+	}
+	if err := d.Security.CheckData(ctx, table, data); err != nil {
+		return 0, err
+	}
+	return d.IDatabase.Update(ctx, table, filter, data)
+}
+
+func (d *SecureDatabase) UpdateOne(ctx context.Context, table string, filter []port.DbExpression, data any) (int64, error) {
+	filter, visible, err := d.filter(ctx, table, filter)
+	if err != nil || !visible {
+		return 0, err
+	}
+	if err := d.Security.CheckData(ctx, table, data); err != nil {
+		return 0, err
+	}
+	return d.IDatabase.UpdateOne(ctx, table, filter, data)
+}
+
+func (d *SecureDatabase) Delete(ctx context.Context, table string, filter []port.DbExpression) (int64, error) {
+	filter, visible, err := d.filter(ctx, table, filter)
+	if err != nil || !visible {
+		return 0, err
+	}
+	return d.IDatabase.Delete(ctx, table, filter)
+}
+
+func (d *SecureDatabase) DeleteOne(ctx context.Context, table string, filter []port.DbExpression) (int64, error) {
+	filter, visible, err := d.filter(ctx, table, filter)
+	if err != nil || !visible {
+		return 0, err
+	}
+	return d.IDatabase.DeleteOne(ctx, table, filter)
+}
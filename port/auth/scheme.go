@@ -0,0 +1,304 @@
+package auth
+
+import (
+	"errors"
+	"slices"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// IAuthScheme is one active authentication type (jwt, apikey, basic, ...)
+type IAuthScheme interface {
+	Name() string
+	HasCredential(ctx *fiber.Ctx) bool
+	Authenticate(ctx *fiber.Ctx) (*Principal, error)
+	Authorize(ctx *fiber.Ctx, principal *Principal) error
+}
+
+// ICredentialDetector is implemented by validators that can tell cheaply
+// whether a request carries their kind of credential
+type ICredentialDetector interface {
+	HasCredential(ctx *fiber.Ctx) bool
+}
+
+// IRouteRegistrar is implemented by schemes that serve endpoints below the
+// protected prefix, e.g. API key management
+type IRouteRegistrar interface {
+	RegisterRoutes(root fiber.Router)
+}
+
+// SchemeChain authenticates a request with the first scheme that accepts it
+type SchemeChain struct {
+	Schemes  []IAuthScheme // in the order of auth.type
+	Security *SecurityRegistry
+	Audit    *Auditor // records failures and decisions, nil when auditing is off
+	Lockout  *Lockout // counts failed attempts, nil when brute-force protection is off
+
+	Impersonation *Impersonation // runs requests of admins as another user, nil when auth.impersonation.enabled is false
+}
+
+func NewSchemeChain(schemes []IAuthScheme, security *SecurityRegistry) *SchemeChain {
+	return &SchemeChain{
+		Schemes:  schemes,
+		Security: security,
+	}
+}
+
+// schemesFor returns the schemes allowed for the route, a route or group
+// scheme list overrides the configured order
+func (s *SchemeChain) schemesFor(method string, path string) []IAuthScheme {
+	if s.Security == nil {
+		return s.Schemes
+	}
+
+	names := s.Security.Schemes(method, path)
+	if len(names) == 0 {
+		return s.Schemes
+	}
+
+	schemes := make([]IAuthScheme, 0, len(names))
+	for _, name := range names {
+		idx := slices.IndexFunc(s.Schemes, func(scheme IAuthScheme) bool {
+			return scheme.Name() == name
+		})
+		if idx >= 0 {
+			schemes = append(schemes, s.Schemes[idx])
+		}
+	}
+	return schemes
+}
+
+// Authenticate picks the schemes whose credential is present in the request,
+// or tries every scheme in turn when none is recognized. On failure the
+// scheme of the reported error is returned, nil when no credential was found.
+func (s *SchemeChain) Authenticate(ctx *fiber.Ctx) (*Principal, IAuthScheme, error) {
+	schemes := s.schemesFor(ctx.Method(), ctx.Path())
+	if len(schemes) == 0 {
+		return nil, nil, ErrForbidden.Withf("no authentication type is enabled for this route")
+	}
+
+	candidates := make([]IAuthScheme, 0, len(schemes))
+	for _, scheme := range schemes {
+		if scheme.HasCredential(ctx) {
+			candidates = append(candidates, scheme)
+		}
+	}
+	detected := len(candidates) > 0
+	if !detected {
+		candidates = schemes
+	}
+
+	var err1 error
+	var failed IAuthScheme
+	for _, scheme := range candidates {
+		principal, err := scheme.Authenticate(ctx)
+		if err == nil {
+			return principal, scheme, nil
+		}
+
+		if err1 == nil {
+			err1, failed = err, scheme
+		}
+	}
+
+	authErr := AsAuthError(err1, ErrCredentialsInvalid)
+	if !detected && errors.Is(authErr, ErrCredentialsMissing) {
+		return nil, nil, authErr
+	}
+	return nil, failed, authErr
+}
+
+// DryRun authenticates the credential of an explained request without side
+// effects, see IsDryRun. The lockout applies as in the middleware, so the
+// explain endpoint is no way around it to guess credentials.
+func (s *SchemeChain) DryRun(ctx *fiber.Ctx) (*Principal, error) {
+	ctx.Locals(LocalDryRun, true)
+
+	var identities []string
+	if s.Lockout != nil {
+		identities = s.attemptIdentities(ctx)
+		if err := s.Lockout.Check(ctx, identities); err != nil {
+			return nil, AsAuthError(err, ErrTooManyAttempts)
+		}
+	}
+
+	principal, scheme, err := s.Authenticate(ctx)
+	if err != nil {
+		authErr := AsAuthError(err, ErrCredentialsInvalid)
+		if s.Lockout != nil && len(identities) > 0 && authErr.IsCountedFailure() {
+			name := ""
+			if scheme != nil {
+				name = scheme.Name()
+			}
+			s.Lockout.Fail(ctx, name, identities)
+		}
+		return nil, authErr
+	}
+	return principal, nil
+}
+
+// hasCredential reports whether any scheme of the route recognizes a credential
+func (s *SchemeChain) hasCredential(ctx *fiber.Ctx) bool {
+	return slices.ContainsFunc(s.schemesFor(ctx.Method(), ctx.Path()), func(scheme IAuthScheme) bool {
+		return scheme.HasCredential(ctx)
+	})
+}
+
+// attemptIdentities returns the identities of the guessable credentials in the request
+func (s *SchemeChain) attemptIdentities(ctx *fiber.Ctx) []string {
+	var identities []string
+	for _, scheme := range s.schemesFor(ctx.Method(), ctx.Path()) {
+		identifier, ok := scheme.(IAttemptIdentifier)
+		if !ok || !scheme.HasCredential(ctx) {
+			continue
+		}
+
+		if identity := identifier.AttemptIdentity(ctx); identity != "" {
+			identities = append(identities, identity)
+		}
+	}
+	return identities
+}
+
+// challenges returns a WWW-Authenticate challenge of every scheme of the
+// route, the failed scheme describes the error
+func (s *SchemeChain) challenges(ctx *fiber.Ctx, failed IAuthScheme, err *AuthError) []string {
+	var challenges []string
+	for _, scheme := range s.schemesFor(ctx.Method(), ctx.Path()) {
+		challenger, ok := scheme.(IChallenger)
+		if !ok {
+			continue
+		}
+
+		if scheme == failed {
+			challenges = append(challenges, challenger.Challenge(err))
+		} else {
+			challenges = append(challenges, challenger.Challenge(nil))
+		}
+	}
+	return challenges
+}
+
+func (s *SchemeChain) Handler() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		start := time.Now()
+		if s.Audit != nil {
+			c.Locals(LocalAuditor, s.Audit)
+		}
+
+		// public routes of modules, groups and auth.public skip authentication
+		if s.Security != nil && s.Security.IsPublic(c.Method(), c.Path()) {
+			return c.Next()
+		}
+
+		// optional routes authenticate only requests that carry a credential,
+		// the route middleware still needs the challenges when it requires a user
+		if s.Security != nil && s.Security.IsOptional(c.Method(), c.Path()) && !s.hasCredential(c) {
+			c.Locals(LocalChallenges, s.challenges(c, nil, nil))
+			return c.Next()
+		}
+
+		// locked identities and banned IPs are rejected before the credential is checked
+		var identities []string
+		if s.Lockout != nil {
+			identities = s.attemptIdentities(c)
+			if err := s.Lockout.Check(c, identities); err != nil {
+				authErr := AsAuthError(err, ErrTooManyAttempts)
+				s.audit(c, start, nil, nil, authErr)
+				return authErr.Respond(c, nil)
+			}
+		}
+
+		principal, scheme, err := s.Authenticate(c)
+		if err != nil {
+			authErr := AsAuthError(err, ErrCredentialsInvalid)
+			if s.Lockout != nil && len(identities) > 0 && authErr.IsCountedFailure() {
+				name := ""
+				if scheme != nil {
+					name = scheme.Name()
+				}
+				s.Lockout.Fail(c, name, identities)
+			}
+			s.audit(c, start, nil, scheme, authErr)
+			// tokens without the scopes required by the scheme itself, e.g. auth.oidc.required_scopes
+			if errors.Is(authErr, ErrInsufficientScope) {
+				if challenger, ok := scheme.(IChallenger); ok {
+					return authErr.Respond(c, []string{challenger.Challenge(authErr)})
+				}
+			}
+			if !authErr.IsUnauthorized() {
+				return authErr.Respond(c, nil)
+			}
+			return authErr.Respond(c, s.challenges(c, scheme, authErr))
+		}
+
+		// the impersonated user is authorized, the admin stays in principal.Actor
+		if s.Impersonation != nil {
+			if target := s.Impersonation.Target(c); target != "" {
+				impersonated, err := s.impersonate(c, principal, scheme, target)
+				if err != nil {
+					authErr := AsAuthError(err, ErrImpersonationDenied)
+					s.audit(c, start, principal, scheme, authErr)
+					return authErr.Respond(c, nil)
+				}
+				principal = impersonated
+			}
+		}
+
+		if err := scheme.Authorize(c, principal); err != nil {
+			authErr := AsAuthError(err, ErrForbidden)
+			s.audit(c, start, principal, scheme, authErr)
+			if errors.Is(authErr, ErrInsufficientScope) {
+				if challenger, ok := scheme.(IChallenger); ok {
+					return authErr.Respond(c, []string{challenger.Challenge(authErr)})
+				}
+			}
+			return authErr.Respond(c, nil)
+		}
+
+		if s.Lockout != nil {
+			s.Lockout.Succeed(c, identities)
+		}
+
+		s.audit(c, start, principal, scheme, nil)
+		SetPrincipal(c, principal)
+		return c.Next()
+	}
+}
+
+// impersonate checks that the route allows impersonation and loads the
+// target user through the scheme that authenticated the admin
+func (s *SchemeChain) impersonate(c *fiber.Ctx, actor *Principal, scheme IAuthScheme, target string) (*Principal, error) {
+	if s.Security != nil && s.Security.ForbidsImpersonation(c.Method(), c.Path()) {
+		return nil, ErrImpersonationDenied.Withf("Route does not allow impersonation")
+	}
+
+	finder, ok := scheme.(IPrincipalFinder)
+	if !ok {
+		return nil, ErrImpersonationDenied.Withf("Authentication type %s cannot impersonate", scheme.Name())
+	}
+
+	return s.Impersonation.Impersonate(c, actor, finder, target)
+}
+
+// audit records the outcome of the middleware, err is nil when the request is allowed
+func (s *SchemeChain) audit(ctx *fiber.Ctx, start time.Time, principal *Principal, scheme IAuthScheme, err *AuthError) {
+	if s.Audit == nil {
+		return
+	}
+
+	decision := DecisionAllow
+	if err != nil {
+		decision = DecisionDeny
+	}
+
+	event := NewAuditEvent(ctx, start, decision).WithPrincipal(principal)
+	if principal == nil && scheme != nil {
+		event.Scheme = scheme.Name()
+	}
+	if err != nil {
+		event.WithError(err)
+	}
+	s.Audit.Record(event)
+}
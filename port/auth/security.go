@@ -0,0 +1,259 @@
+package auth
+
+import (
+	"slices"
+	"strings"
+	"sync"
+)
+
+// RouteSecurity is the security metadata a module declares on a route. It is
+// checked against the principal after the store based authorization passed.
+type RouteSecurity struct {
+	Public          bool     // no authentication required, the auth middleware is skipped
+	Optional        bool     // anonymous requests pass, credentials are still verified when present
+	Schemes         []string // allowed authentication types (validator names), empty allows all
+	Roles           []string // the user needs at least one of the roles
+	Permissions     []string // the user needs all of the permissions
+	Action          string   // ABAC action evaluated against the user policies
+	Scopes          []string // required scopes of scoped credentials (API keys)
+	MFA             bool     // the principal needs a verified second factor (step-up)
+	NoImpersonation bool     // impersonated requests are rejected, e.g. for payment or credential changes
+}
+
+// HasRule reports whether the metadata decides who may call the route, as
+// opposed to metadata that only selects authentication schemes
+func (s *RouteSecurity) HasRule() bool {
+	return s.Public || s.Optional || len(s.Roles) > 0 || len(s.Permissions) > 0 || s.Action != ""
+}
+
+// ErrNotAuthenticated is returned by RouteSecurity.Check when there is no principal
+var ErrNotAuthenticated error = ErrCredentialsMissing
+
+// Check verifies the principal of the request against the route requirements
+func (s *RouteSecurity) Check(principal *Principal, request *AccessRequest) error {
+	if s.Public {
+		return nil
+	}
+
+	if principal == nil {
+		// anonymous access only when the route has no other requirement
+		if s.Optional && len(s.Roles) == 0 && len(s.Permissions) == 0 && s.Action == "" && !s.MFA {
+			return nil
+		}
+		return ErrNotAuthenticated
+	}
+
+	if s.NoImpersonation && principal.Actor != nil {
+		return ErrImpersonationDenied.Withf("Route does not allow impersonation")
+	}
+
+	if len(s.Schemes) > 0 && !slices.Contains(s.Schemes, principal.AuthType) {
+		return ErrForbidden.Withf("authentication type %s is not allowed for this route", principal.AuthType)
+	}
+
+	if len(s.Roles) > 0 && !slices.ContainsFunc(principal.Roles, func(role string) bool {
+		return slices.Contains(s.Roles, role)
+	}) {
+		return ErrForbidden.Withf("one of roles %v required", s.Roles)
+	}
+
+	for _, permission := range s.Permissions {
+		if !slices.Contains(principal.Permissions, permission) {
+			return ErrForbidden.Withf("permission %s required", permission)
+		}
+	}
+
+	// scoped credentials are limited to their scopes, other principals are not
+	if principal.Scopes != nil {
+		for _, scope := range s.Scopes {
+			if !ScopeAllows(principal.Scopes, scope) {
+				return ErrInsufficientScope.WithScope(scope)
+			}
+		}
+		if s.Action != "" && !ScopeAllows(principal.Scopes, s.Action) {
+			return ErrInsufficientScope.WithScope(s.Action)
+		}
+	}
+
+	if s.Action != "" {
+		if err := s.checkAction(principal, request); err != nil {
+			return err
+		}
+	}
+
+	// checked last, a second factor does not help a principal that is denied anyway
+	if s.MFA && !principal.MFA {
+		return ErrMFARequired.Withf("Route requires a second factor")
+	}
+
+	return nil
+}
+
+// checkAction evaluates the ABAC policies of the user, together with the
+// policies of the matched store resource, for the route action
+func (s *RouteSecurity) checkAction(principal *Principal, request *AccessRequest) error {
+	user, ok := principal.User.(*UserAuthInfoABAC)
+	if !ok {
+		return ErrForbidden.Withf("action %s requires ABAC access control", s.Action)
+	}
+
+	resource := &ResourceInfoABAC{
+		Action: s.Action,
+		Path:   request.Path,
+		Method: request.Method,
+	}
+
+	policies := slices.Clone(user.Policies)
+	if matched, ok := principal.Resource.(*ResourceInfoABAC); ok {
+		policies = append(policies, matched.PermittedPolicies...)
+		resource.Attributes = matched.Attributes
+	}
+
+	granted, err := EvaluatePolicies(policies, s.Action, NewAttributes(user, request, resource))
+	if err != nil {
+		return ErrForbidden.With(err)
+	}
+
+	if !granted {
+		return ErrForbidden.Withf("action %s denied by policies", s.Action)
+	}
+
+	return nil
+}
+
+// SecurityRegistry indexes the security metadata of module routes, route
+// groups and the configured allowlist by their full path. For schemes, route
+// metadata wins over group metadata.
+type SecurityRegistry struct {
+	mu     sync.RWMutex
+	index  *RouteIndex[*RouteSecurity]
+	groups *RouteIndex[*RouteSecurity]
+	rules  *RouteIndex[*RouteSecurity]
+}
+
+func NewSecurityRegistry() *SecurityRegistry {
+	return &SecurityRegistry{
+		index:  NewRouteIndex[*RouteSecurity](),
+		groups: NewRouteIndex[*RouteSecurity](),
+		rules:  NewRouteIndex[*RouteSecurity](),
+	}
+}
+
+func (r *SecurityRegistry) Register(method string, path string, security *RouteSecurity) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.index.Add(method, path, security)
+}
+
+// RegisterGroup applies the metadata to every route below the prefix
+func (r *SecurityRegistry) RegisterGroup(prefix string, security *RouteSecurity) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.groups.Add("*", strings.TrimSuffix(prefix, "/")+"/*", security)
+}
+
+// Allow adds an allowlist rule, used for auth.public and auth.optional
+func (r *SecurityRegistry) Allow(method string, pattern string, security *RouteSecurity) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.rules.Add(method, pattern, security)
+}
+
+// Match returns the security metadata of the route that serves method and path
+func (r *SecurityRegistry) Match(method string, path string) (*RouteSecurity, bool) {
+	return r.match(r.index, method, path)
+}
+
+// MatchGroup returns the security metadata of the innermost group of the path
+func (r *SecurityRegistry) MatchGroup(method string, path string) (*RouteSecurity, bool) {
+	return r.match(r.groups, method, path)
+}
+
+// MatchRule returns the allowlist rule of the path
+func (r *SecurityRegistry) MatchRule(method string, path string) (*RouteSecurity, bool) {
+	return r.match(r.rules, method, path)
+}
+
+func (r *SecurityRegistry) match(index *RouteIndex[*RouteSecurity], method string, path string) (*RouteSecurity, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	match, ok := index.Match(method, path)
+	if !ok {
+		return nil, false
+	}
+
+	return match.Value, true
+}
+
+// lookup returns the route, group and allowlist metadata that apply to the path
+func (r *SecurityRegistry) lookup(method string, path string) []*RouteSecurity {
+	list := make([]*RouteSecurity, 0, 3)
+	for _, match := range []func(string, string) (*RouteSecurity, bool){r.Match, r.MatchGroup, r.MatchRule} {
+		if security, ok := match(method, path); ok {
+			list = append(list, security)
+		}
+	}
+	return list
+}
+
+// IsPublic reports whether the route of method and path does not require authentication
+func (r *SecurityRegistry) IsPublic(method string, path string) bool {
+	return slices.ContainsFunc(r.lookup(method, path), func(security *RouteSecurity) bool {
+		return security.Public
+	})
+}
+
+// IsOptional reports whether the route of method and path accepts anonymous requests
+// and authenticates only requests with credentials
+func (r *SecurityRegistry) IsOptional(method string, path string) bool {
+	return slices.ContainsFunc(r.lookup(method, path), func(security *RouteSecurity) bool {
+		return security.Optional
+	})
+}
+
+// ForbidsImpersonation reports whether the route, its group or the allowlist
+// rejects impersonated requests for method and path
+func (r *SecurityRegistry) ForbidsImpersonation(method string, path string) bool {
+	return slices.ContainsFunc(r.lookup(method, path), func(security *RouteSecurity) bool {
+		return security.NoImpersonation
+	})
+}
+
+// IsCovered reports whether the route, its group or the allowlist has an
+// authorization rule for method and path
+func (r *SecurityRegistry) IsCovered(method string, path string) bool {
+	return slices.ContainsFunc(r.lookup(method, path), func(security *RouteSecurity) bool {
+		return security.HasRule()
+	})
+}
+
+// Actions returns the actions and scopes the route, its group and the
+// allowlist require. RouteSecurity.Check limits scoped credentials to them.
+func (r *SecurityRegistry) Actions(method string, path string) []string {
+	var actions []string
+	for _, security := range r.lookup(method, path) {
+		actions = append(actions, security.Scopes...)
+		if security.Action != "" {
+			actions = append(actions, security.Action)
+		}
+	}
+	return actions
+}
+
+// Schemes returns the authentication types allowed for the route, empty
+// when the route and its group keep the configured auth.type list
+func (r *SecurityRegistry) Schemes(method string, path string) []string {
+	if security, ok := r.Match(method, path); ok && len(security.Schemes) > 0 {
+		return security.Schemes
+	}
+
+	if security, ok := r.MatchGroup(method, path); ok {
+		return security.Schemes
+	}
+
+	return nil
+}
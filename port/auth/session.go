@@ -0,0 +1,105 @@
+package auth
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/webcore-go/webcore/port"
+)
+
+// Session is a server-side login of the session scheme. The plain id only
+// lives in the cookie, the store knows the session by the hash of the id.
+type Session struct {
+	Id         string     `json:"-"`
+	UserId     string     `json:"user_id"`
+	Username   string     `json:"username,omitempty"`
+	CSRFToken  string     `json:"csrf_token"`
+	Privileges string     `json:"privileges"` // hash of groups and roles, a change rotates the session
+	CreatedAt  time.Time  `json:"created_at"`
+	LastSeenAt time.Time  `json:"last_seen_at"`
+	MFAAt      *time.Time `json:"mfa_at,omitempty"` // last verified second factor, nil without step-up
+	IP         string     `json:"ip,omitempty"`
+	UserAgent  string     `json:"user_agent,omitempty"`
+}
+
+// Hash returns the id the session is stored and revoked under
+func (s *Session) Hash() string {
+	return HashSessionId(s.Id)
+}
+
+// Subject returns the revocation subject, the username or the user id when
+// the user has no name, like UserSubject
+func (s *Session) Subject() string {
+	if s.Username != "" {
+		return s.Username
+	}
+	return s.UserId
+}
+
+// HashSessionId returns the hex SHA-256 of a plain session id
+func HashSessionId(id string) string {
+	sum := sha256.Sum256([]byte(id))
+	return hex.EncodeToString(sum[:])
+}
+
+// PrivilegeHash fingerprints groups and roles, the order does not matter
+func PrivilegeHash(groups []string, roles []string) string {
+	sortedGroups := slices.Sorted(slices.Values(groups))
+	sortedRoles := slices.Sorted(slices.Values(roles))
+	sum := sha256.Sum256([]byte(strings.Join(sortedGroups, ",") + "|" + strings.Join(sortedRoles, ",")))
+	return hex.EncodeToString(sum[:8])
+}
+
+// ISessionStore keeps the sessions, either in process or in a shared cache
+type ISessionStore interface {
+	Load(ctx context.Context, key string) (*Session, error) // nil when there is no session
+	Save(ctx context.Context, key string, session *Session, ttl time.Duration) error
+	Delete(ctx context.Context, key string) error
+}
+
+// MemorySessionStore keeps the sessions in process
+type MemorySessionStore struct {
+	entries *ttlMap[Session]
+}
+
+func NewMemorySessionStore() *MemorySessionStore {
+	return &MemorySessionStore{
+		entries: newTTLMap[Session](),
+	}
+}
+
+func (m *MemorySessionStore) Load(ctx context.Context, key string) (*Session, error) {
+	session, ok := m.entries.Get(key)
+	if !ok {
+		return nil, nil
+	}
+	return &session, nil
+}
+
+func (m *MemorySessionStore) Save(ctx context.Context, key string, session *Session, ttl time.Duration) error {
+	m.entries.Set(key, *session, ttl)
+	return nil
+}
+
+func (m *MemorySessionStore) Delete(ctx context.Context, key string) error {
+	m.entries.Delete(key)
+	return nil
+}
+
+// CacheSessionStore keeps the sessions in the configured IMemoryCache, so
+// all instances of the application share them
+type CacheSessionStore struct {
+	cacheJSON[Session]
+}
+
+func NewCacheSessionStore(cache port.IMemoryCache) (*CacheSessionStore, error) {
+	client, err := cacheClient(cache)
+	if err != nil {
+		return nil, err
+	}
+	return &CacheSessionStore{cacheJSON[Session]{Client: client}}, nil
+}
@@ -1,6 +1,7 @@
 package auth
 
 import (
+	"errors"
 	"fmt"
 
 	"github.com/gofiber/fiber/v2"
@@ -8,16 +9,34 @@ import (
 )
 
 type IStore interface {
-	GetUserAuthInfo(ctx *fiber.Ctx, validator IAuthValidator) (IUserAuthInfo, error)
+	GetUserAuthInfo(ctx *fiber.Ctx, validator IAuthValidator, userKey string) (IUserAuthInfo, error)
 	GetResourceInfo(method string, path string) (IResourceInfo, error)
 }
 
+// IStoreWrapper returns the loaded user and resource to the caller instead of
+// keeping them, because one wrapper serves all concurrent requests
 type IStoreWrapper interface {
-	CheckUser(ctx *fiber.Ctx, validator IAuthValidator) error
-	GetLoadedUser() IUserAuthInfo
+	CheckUser(ctx *fiber.Ctx, validator IAuthValidator, userKey string) (IUserAuthInfo, error)
+	CheckResource(method string, path string) (IResourceInfo, error)
+}
+
+// IUserResolver is implemented by validators whose credential already carries
+// the user identity (e.g. JWT claims), so the store does not need to be queried.
+// Returning a nil user falls back to the store lookup.
+type IUserResolver interface {
+	ResolveUser(ctx *fiber.Ctx) (IUserAuthInfo, error)
+}
+
+// UserLookup names a user field and the value a store can query directly
+type UserLookup struct {
+	Field string // "key" (UserId) or "user" (Username)
+	Value string
+}
 
-	CheckResource(method string, path string) (bool, error)
-	GetLoadedResource() IResourceInfo
+// IUserLookupProvider is implemented by validators that know which user field
+// their credential identifies, so large stores can query instead of scanning all users.
+type IUserLookupProvider interface {
+	UserLookups(ctx *fiber.Ctx, userKey string) []UserLookup
 }
 
 type IAuthStore interface {
@@ -25,9 +44,7 @@ type IAuthStore interface {
 }
 
 type StoreWrapper struct {
-	Store    IStore
-	User     IUserAuthInfo
-	Resource IResourceInfo
+	Store IStore
 }
 
 func NewStoreWrapper(store IStore) *StoreWrapper {
@@ -36,32 +53,54 @@ func NewStoreWrapper(store IStore) *StoreWrapper {
 	}
 }
 
-func (u *StoreWrapper) CheckUser(ctx *fiber.Ctx, validator IAuthValidator) error {
-	userKey := validator.GetValue()
-	info, err := u.Store.GetUserAuthInfo(ctx, validator) // mencari user aktif
-	if err != nil {
-		return fmt.Errorf("User not found: %s", userKey)
+func (u *StoreWrapper) CheckUser(ctx *fiber.Ctx, validator IAuthValidator, userKey string) (IUserAuthInfo, error) {
+	if resolver, ok := validator.(IUserResolver); ok {
+		info, err := resolver.ResolveUser(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		if info != nil {
+			return u.resolveRoles(info), nil
+		}
+	}
+
+	info, err := u.Store.GetUserAuthInfo(ctx, validator, userKey) // mencari user aktif
+	if errors.Is(err, ErrStoreUnavailable) {
+		return nil, err
+	}
+	if err != nil || info == nil {
+		return nil, fmt.Errorf("User not found")
 	}
 
-	u.User = info
-	return nil
+	return u.resolveRoles(info), nil
 }
 
-func (u *StoreWrapper) CheckResource(method string, path string) (bool, error) {
-	info, err := u.Store.GetResourceInfo(method, path) // mencari user aktif
-	if err != nil {
-		logger.Info(err.Error(), "method", method, "path", path)
-		return false, err
+// resolveRoles replaces the roles of an RBAC user with the effective roles of
+// the store hierarchy. The store user is shared, so a copy is returned.
+func (u *StoreWrapper) resolveRoles(info IUserAuthInfo) IUserAuthInfo {
+	provider, ok := u.Store.(IRoleHierarchyProvider)
+	if !ok {
+		return info
 	}
 
-	u.Resource = info
-	return true, nil
-}
+	hierarchy := provider.RoleHierarchy()
+	user, ok := info.(*UserAuthInfoRBAC)
+	if hierarchy == nil || !ok {
+		return info
+	}
 
-func (u *StoreWrapper) GetLoadedUser() IUserAuthInfo {
-	return u.User
+	resolved := *user
+	resolved.Roles = hierarchy.EffectiveRoles(user.UserId, user.Groups, user.Roles)
+	return &resolved
 }
 
-func (u *StoreWrapper) GetLoadedResource() IResourceInfo {
-	return u.Resource
+func (u *StoreWrapper) CheckResource(method string, path string) (IResourceInfo, error) {
+	info, err := u.Store.GetResourceInfo(method, path) // mencari resource
+	if err != nil {
+		logger.Info(err.Error(), "method", method, "path", path)
+		return nil, err
+	}
+
+	return info, nil
 }
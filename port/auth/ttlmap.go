@@ -0,0 +1,177 @@
+package auth
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/webcore-go/webcore/app/helper"
+	"github.com/webcore-go/webcore/port"
+)
+
+// ttlMap is an in-process map whose entries expire, the base of the memory stores
+type ttlMap[T any] struct {
+	mu      sync.Mutex
+	entries map[string]ttlEntry[T]
+	sweep   time.Time
+}
+
+type ttlEntry[T any] struct {
+	value   T
+	expires time.Time // zero never expires
+}
+
+func newTTLMap[T any]() *ttlMap[T] {
+	return &ttlMap[T]{
+		entries: make(map[string]ttlEntry[T]),
+	}
+}
+
+func (m *ttlMap[T]) Get(key string) (T, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	entry, ok := m.entries[key]
+	if !ok || (!entry.expires.IsZero() && time.Now().After(entry.expires)) {
+		var zero T
+		return zero, false
+	}
+	return entry.value, true
+}
+
+// Set stores the value, a ttl of 0 keeps it until it is deleted
+func (m *ttlMap[T]) Set(key string, value T, ttl time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	entry := ttlEntry[T]{value: value}
+	if ttl > 0 {
+		entry.expires = now.Add(ttl)
+	}
+	m.entries[key] = entry
+	m.sweepExpired(now)
+}
+
+// SetIfAbsent stores the value unless the key exists, false when it exists
+func (m *ttlMap[T]) SetIfAbsent(key string, value T, ttl time.Duration) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	if entry, ok := m.entries[key]; ok && (entry.expires.IsZero() || !now.After(entry.expires)) {
+		return false
+	}
+
+	entry := ttlEntry[T]{value: value}
+	if ttl > 0 {
+		entry.expires = now.Add(ttl)
+	}
+	m.entries[key] = entry
+	m.sweepExpired(now)
+	return true
+}
+
+// Update replaces the value computed by update under the lock of the map, so
+// concurrent read-modify-write cycles do not lose changes. update receives
+// the current value and whether it exists, and returns false to keep it.
+func (m *ttlMap[T]) Update(key string, update func(value T, ok bool) (T, time.Duration, bool)) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	entry, ok := m.entries[key]
+	if ok && !entry.expires.IsZero() && now.After(entry.expires) {
+		entry, ok = ttlEntry[T]{}, false
+	}
+
+	value, ttl, changed := update(entry.value, ok)
+	if !changed {
+		return
+	}
+
+	entry = ttlEntry[T]{value: value}
+	if ttl > 0 {
+		entry.expires = now.Add(ttl)
+	}
+	m.entries[key] = entry
+	m.sweepExpired(now)
+}
+
+// sweepExpired removes expired entries once a minute, so random keys do not grow the map
+func (m *ttlMap[T]) sweepExpired(now time.Time) {
+	if now.Sub(m.sweep) <= time.Minute {
+		return
+	}
+
+	m.sweep = now
+	for k, e := range m.entries {
+		if !e.expires.IsZero() && now.After(e.expires) {
+			delete(m.entries, k)
+		}
+	}
+}
+
+func (m *ttlMap[T]) Delete(key string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.entries, key)
+}
+
+// ICacheClient is the key value access a memory cache library needs for the
+// lockout counters and revocations. The library or its client (GetClient) has
+// to implement it.
+type ICacheClient interface {
+	Get(ctx context.Context, key string) ([]byte, error) // nil when the key does not exist
+	Set(ctx context.Context, key string, value []byte, ttl time.Duration) error
+	Delete(ctx context.Context, key string) error
+}
+
+// ICacheAdder is implemented by memory caches with an atomic "set if not
+// exists" (e.g. redis SETNX), used for the nonces of signed requests
+type ICacheAdder interface {
+	SetIfAbsent(ctx context.Context, key string, value []byte, ttl time.Duration) (bool, error)
+}
+
+// cacheJSON stores values as JSON in a memory cache library
+type cacheJSON[T any] struct {
+	Client ICacheClient
+}
+
+func (c *cacheJSON[T]) Load(ctx context.Context, key string) (*T, error) {
+	data, err := c.Client.Get(ctx, key)
+	if err != nil || data == nil {
+		return nil, err
+	}
+
+	var value T
+	if err := helper.JSONUnmarshal(data, &value); err != nil {
+		return nil, err
+	}
+	return &value, nil
+}
+
+func (c *cacheJSON[T]) Save(ctx context.Context, key string, value *T, ttl time.Duration) error {
+	data, err := helper.JSONMarshal(value)
+	if err != nil {
+		return err
+	}
+	return c.Client.Set(ctx, key, data, ttl)
+}
+
+func (c *cacheJSON[T]) Delete(ctx context.Context, key string) error {
+	return c.Client.Delete(ctx, key)
+}
+
+// cacheClient returns the ICacheClient of a memory cache library
+func cacheClient(cache port.IMemoryCache) (ICacheClient, error) {
+	if client, ok := cache.(ICacheClient); ok {
+		return client, nil
+	}
+	if client, ok := cache.GetClient().(ICacheClient); ok {
+		return client, nil
+	}
+	return nil, fmt.Errorf("Memory cache library does not implement auth.ICacheClient")
+}